@@ -39,6 +39,22 @@ const (
 	// an error while generating a data secret; those kind of errors are usually due to misconfigurations
 	// and user intervention is required to get them fixed.
 	DataSecretGenerationFailedReason = "DataSecretGenerationFailed"
+
+	// RegistryCredentialsUnavailableReason (Severity=Warning) documents a MicroK8sConfig controller that cannot
+	// read the credentials of a container registry, because the referenced secret is missing or incomplete.
+	RegistryCredentialsUnavailableReason = "RegistryCredentialsUnavailable"
+
+	// FileContentUnavailableReason (Severity=Warning) documents a MicroK8sConfig controller that cannot read
+	// the content of an extra file, because the referenced secret or configmap, or its key, is missing.
+	FileContentUnavailableReason = "FileContentUnavailable"
+
+	// PerMachineJoinTokensUnsupportedReason (Severity=Error) documents a MachinePool that cannot join its cluster,
+	// because the cluster uses per-machine join tokens.
+	PerMachineJoinTokensUnsupportedReason = "PerMachineJoinTokensUnsupported"
+
+	// WaitingForSnapRevisionReason (Severity=Info) documents a bootstrap secret generation process waiting for the
+	// machine that initialized the cluster to publish the revision of the MicroK8s snap it installed.
+	WaitingForSnapRevisionReason = "WaitingForSnapRevision"
 )
 
 const (
@@ -49,4 +65,54 @@ const (
 	// by the users.
 	// IMPORTANT: This condition won't be re-created after clusterctl move.
 	CertificatesAvailableCondition clusterv1.ConditionType = "CertificatesAvailable"
+
+	// CertificatesGenerationFailedReason (Severity=Warning) documents a MicroK8sConfig controller detecting
+	// an error while reading or generating the cluster CA; those kind of errors are usually temporary and
+	// the controller automatically recovers from them.
+	CertificatesGenerationFailedReason = "CertificatesGenerationFailed"
+
+	// InvalidCAReason (Severity=Error) documents a MicroK8sConfig controller detecting that the provided
+	// cluster CA is missing, does not match its private key, is not a CA certificate or is expired.
+	// User intervention is required to get it fixed.
+	InvalidCAReason = "InvalidCA"
+)
+
+const (
+	// DataSecretUpToDateCondition documents whether the bootstrap data secret reflects the current spec of
+	// the MicroK8sConfig.
+	//
+	// NOTE: The bootstrap data is regenerated when the spec changes before the infrastructure of the owner is
+	// provisioned. Changes after that point are not applied to existing machines.
+	DataSecretUpToDateCondition clusterv1.ConditionType = "DataSecretUpToDate"
+
+	// ConfigChangedAfterProvisioningReason (Severity=Warning) documents a MicroK8sConfig whose spec changed after
+	// the infrastructure of its owner was provisioned, so the change is not applied to the existing machine.
+	ConfigChangedAfterProvisioningReason = "ConfigChangedAfterProvisioning"
+)
+
+const (
+	// InstallSucceededCondition documents that MicroK8s was installed on the machine, as reported by the machine.
+	//
+	// NOTE: The bootstrap progress conditions are only set if the manager is configured to receive progress
+	// reports from the machines.
+	InstallSucceededCondition clusterv1.ConditionType = "InstallSucceeded"
+
+	// JoinSucceededCondition documents that the machine joined the cluster, as reported by the machine. It is not
+	// set for the control plane node that initializes the cluster.
+	JoinSucceededCondition clusterv1.ConditionType = "JoinSucceeded"
+
+	// AddonsEnabledCondition documents that the addons were enabled, as reported by the machine. It is only set
+	// for the control plane node that initializes the cluster.
+	AddonsEnabledCondition clusterv1.ConditionType = "AddonsEnabled"
+
+	// WaitingForProgressReportReason (Severity=Info) documents a bootstrap step that the machine has not reported
+	// yet, e.g. because it is still being provisioned.
+	WaitingForProgressReportReason = "WaitingForProgressReport"
+
+	// BootstrapStepFailedReason (Severity=Warning) documents a bootstrap step that failed on the machine. Steps
+	// that are retried, like joining the cluster, may still succeed later.
+	BootstrapStepFailedReason = "BootstrapStepFailed"
 )
+
+// ConfigHashAnnotation is set on the bootstrap data secret and holds a hash of the inputs the data was rendered from.
+const ConfigHashAnnotation = "bootstrap.cluster.x-k8s.io/config-hash"
@@ -17,11 +17,51 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
-// JoinConfiguration contains elements describing a particular node.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// JoinConfiguration contains elements describing a particular node. It is used by the control plane and
+// worker nodes that join the cluster. Fields that are not set fall back to those of the InitConfiguration.
+type JoinConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ExtraWriteFiles is a list of extra files to inject with cloud-init.
+	// +optional
+	ExtraWriteFiles []CloudInitWriteFile `json:"extraWriteFiles,omitempty"`
+
+	// ExtraKubeletArgs is a list of extra arguments to add to the kubelet.
+	// +optional
+	ExtraKubeletArgs []string `json:"extraKubeletArgs,omitempty"`
+
+	// NodeLabels are the labels that the kubelet registers the node with, e.g. "topology.kubernetes.io/zone".
+	// Labels in the kubernetes.io and k8s.io namespaces are restricted to those that the kubelet may set.
+	// +optional
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+
+	// NodeTaints are the taints that the kubelet registers the node with.
+	// +optional
+	NodeTaints []corev1.Taint `json:"nodeTaints,omitempty"`
+
+	// BootCommands is a list of commands to run during boot.
+	// These will be injected into the `bootcmd` section of cloud-init.
+	// +optional
+	BootCommands []string `json:"bootCommands,omitempty"`
+
+	// PreRunCommands is a list of commands to run before installing MicroK8s.
+	// These will be injected into the `runcmd` section of cloud-init.
+	// +optional
+	PreRunCommands []string `json:"preRunCommands,omitempty"`
+
+	// PostRunCommands is a list of commands to run after installing MicroK8s.
+	// These will be injected into the `runcmd` section of cloud-init.
+	// +optional
+	PostRunCommands []string `json:"postRunCommands,omitempty"`
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // ClusterConfiguration contains cluster-wide configuration for a kubeadm cluster.
@@ -37,6 +77,257 @@ type ClusterConfiguration struct {
 	// +kubebuilder:default:=true
 	// +optional
 	PortCompatibilityRemap bool `json:"portCompatibilityRemap,omitempty"`
+
+	// ClusterAgentPort is the port that the cluster agent binds to. It takes precedence over
+	// PortCompatibilityRemap. Defaults to 30000 if PortCompatibilityRemap is set, or 25000 otherwise.
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=65535
+	ClusterAgentPort int32 `json:"clusterAgentPort,omitempty"`
+
+	// DqlitePort is the port that dqlite binds to. It takes precedence over PortCompatibilityRemap.
+	// Defaults to 2379 if PortCompatibilityRemap is set, or 19001 otherwise.
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=65535
+	DqlitePort int32 `json:"dqlitePort,omitempty"`
+
+	// APIServerPort is the port that the kube-apiserver binds to. Defaults to 6443.
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=65535
+	APIServerPort int32 `json:"apiServerPort,omitempty"`
+
+	// NativeAPIServerPort configures the apiserver port only through the MicroK8s service arguments.
+	// By default, port 16443 is also redirected to the apiserver port with iptables NAT rules, which
+	// are persisted by installing iptables-persistent with apt-get. Enable this on images that are not
+	// Debian-based or that have no access to a package mirror.
+	// +optional
+	NativeAPIServerPort bool `json:"nativeAPIServerPort,omitempty"`
+
+	// WorkerAPIServerProxy selects the kube-apiserver addresses that the apiserver proxy of the worker nodes
+	// uses: the control plane endpoint ("lb"), the control plane nodes discovered when the worker joins
+	// ("all-control-planes"), or both ("both"). Defaults to "lb".
+	// +optional
+	// +kubebuilder:validation:Enum=lb;all-control-planes;both
+	WorkerAPIServerProxy string `json:"workerAPIServerProxy,omitempty"`
+
+	// PodCIDR is the CIDR of the pod network, e.g. "10.1.0.0/16". Dual-stack clusters set an IPv4 and an
+	// IPv6 CIDR separated by a comma, e.g. "10.1.0.0/16,fd01::/64". Defaults to the pod CIDR of MicroK8s.
+	// +optional
+	PodCIDR string `json:"podCIDR,omitempty"`
+
+	// ServiceCIDR is the CIDR of the service network, e.g. "10.152.183.0/24". Dual-stack clusters set an IPv4
+	// and an IPv6 CIDR separated by a comma, e.g. "10.152.183.0/24,fd98::/108". Defaults to the service CIDR
+	// of MicroK8s.
+	// +optional
+	ServiceCIDR string `json:"serviceCIDR,omitempty"`
+
+	// ClusterDomain is the DNS domain of the cluster, e.g. "cluster.example.com". Defaults to "cluster.local".
+	// +optional
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+
+	// CertSANs are extra IP addresses and DNS names of the server certificate of the control plane nodes,
+	// e.g. a private VIP in addition to the control plane endpoint. DNS names may be wildcards, e.g.
+	// "*.k8s.example.com".
+	// +optional
+	CertSANs []string `json:"certSANs,omitempty"`
+
+	// CNI is the CNI of the cluster. "calico-vxlan" and "calico-ipip" configure the encapsulation of Calico,
+	// "calico-none" routes pod traffic with BGP, "cilium" enables the cilium addon instead of Calico, and
+	// "none" removes Calico so that a CNI can be installed by the user, e.g. with postRunCommands. Defaults to
+	// Calico with VXLAN, or IPinIP if initConfiguration.IPinIP is set.
+	// +kubebuilder:validation:Enum=calico-vxlan;calico-ipip;calico-none;cilium;none
+	// +optional
+	CNI string `json:"cni,omitempty"`
+
+	// JoinAddressTypes are the types of the addresses of the control plane machines that nodes join the
+	// cluster through, in order of preference. Defaults to InternalIP, ExternalIP.
+	// +optional
+	JoinAddressTypes []clusterv1.MachineAddressType `json:"joinAddressTypes,omitempty"`
+
+	// CASecretRef references a secret in the namespace of the MicroK8sConfig that holds the cluster CA,
+	// for example a corporate intermediate CA. The PEM-encoded certificate and private key are read from
+	// the "tls.crt" and "tls.key" entries, or from the "crt" and "key" entries of the secret.
+	// +optional
+	CASecretRef *corev1.LocalObjectReference `json:"caSecretRef,omitempty"`
+
+	// CertificateAuthority configures the self-signed CA that is generated when no CA is provided.
+	// +optional
+	CertificateAuthority *CertificateAuthority `json:"certificateAuthority,omitempty"`
+
+	// PerMachineJoinTokens issues a distinct, short-lived join token for every joining Machine instead of
+	// registering a single long-lived join token on the control plane. Issued tokens are revoked once the
+	// Machine is running. This is decided by the MicroK8sConfig of the control plane node that initializes
+	// the cluster and applies to all nodes; it is ignored for joining nodes. MachinePools cannot join clusters
+	// that use per-machine join tokens.
+	// +optional
+	PerMachineJoinTokens bool `json:"perMachineJoinTokens,omitempty"`
+
+	// The per-machine join token issued for the Machine will expire after the specified seconds, defaults to 1 hour
+	// +optional
+	// +kubebuilder:validation:Minimum:=60
+	PerMachineJoinTokenTTLInSecs int64 `json:"perMachineJoinTokenTTLInSecs,omitempty"`
+}
+
+const (
+	// KeyAlgorithmRSA2048 generates a 2048-bit RSA key.
+	KeyAlgorithmRSA2048 = "RSA-2048"
+
+	// KeyAlgorithmRSA4096 generates a 4096-bit RSA key.
+	KeyAlgorithmRSA4096 = "RSA-4096"
+
+	// KeyAlgorithmECDSAP256 generates an ECDSA key on the P-256 curve.
+	KeyAlgorithmECDSAP256 = "ECDSA-P256"
+)
+
+// CertificateAuthority configures the generated cluster CA.
+type CertificateAuthority struct {
+	// Subject of the CA certificate, defaults to the subject of the MicroK8s CA
+	// +optional
+	Subject *CertificateSubject `json:"subject,omitempty"`
+
+	// The algorithm (RSA-2048, RSA-4096 or ECDSA-P256) of the CA private key, defaults to RSA-2048
+	// +optional
+	// +kubebuilder:validation:Enum=RSA-2048;RSA-4096;ECDSA-P256
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+
+	// The CA certificate will expire after the specified days, defaults to 10 years
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	ValidityInDays int32 `json:"validityInDays,omitempty"`
+}
+
+// CertificateSubject is the distinguished name of a certificate.
+type CertificateSubject struct {
+	// CommonName of the certificate.
+	// +optional
+	CommonName string `json:"commonName,omitempty"`
+
+	// Organization of the certificate.
+	// +optional
+	Organization []string `json:"organization,omitempty"`
+
+	// OrganizationalUnit of the certificate.
+	// +optional
+	OrganizationalUnit []string `json:"organizationalUnit,omitempty"`
+
+	// Country of the certificate.
+	// +optional
+	Country []string `json:"country,omitempty"`
+
+	// Province of the certificate.
+	// +optional
+	Province []string `json:"province,omitempty"`
+
+	// Locality of the certificate.
+	// +optional
+	Locality []string `json:"locality,omitempty"`
+}
+
+// Addon is a MicroK8s addon to enable.
+type Addon struct {
+	// Name of the addon, e.g. "metallb".
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Arguments of the addon, e.g. "10.0.0.1-10.0.0.10" for metallb.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[-a-zA-Z0-9.,:;/=@_+]*$`
+	Arguments string `json:"arguments,omitempty"`
+
+	// Repository is the addon repository that provides the addon, e.g. "core" or "community".
+	// By default, the addon is looked up in all repositories.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Repository string `json:"repository,omitempty"`
+
+	// TimeoutSeconds is the time to wait for the addon to be enabled. By default, there is no timeout.
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// AddonRepository is a MicroK8s addon repository.
+type AddonRepository struct {
+	// Name of the addon repository. Addons can refer to it as their repository.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Repository is the URL of the git repository or the local path that holds the addons.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^[-a-zA-Z0-9.,:/@_+~=%]+$`
+	Repository string `json:"repository"`
+
+	// Reference is the git branch or tag to check out.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[-a-zA-Z0-9._/]*$`
+	Reference string `json:"reference,omitempty"`
+}
+
+// SnapRefresh controls when snapd refreshes the snaps of a machine.
+type SnapRefresh struct {
+	// Hold holds the refreshes of all snaps indefinitely. Requires snapd 2.58+.
+	// +optional
+	Hold bool `json:"hold,omitempty"`
+
+	// HoldUntil holds the refreshes of all snaps until the given time.
+	// +optional
+	HoldUntil *metav1.Time `json:"holdUntil,omitempty"`
+
+	// Timer is the window in which snaps are refreshed, in the format of the snapd refresh.timer option,
+	// e.g. "sat,02:00-04:00".
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-z0-9,:~./-]*$`
+	Timer string `json:"timer,omitempty"`
+}
+
+// Installation configures installing MicroK8s without access to the snap store.
+type Installation struct {
+	// Snap is the MicroK8s snap to install instead of a snap from the snap store. It is either the path of a
+	// snap file that is already present on the machine image, or an http(s) URL to download the snap from.
+	// The snap must provide the Kubernetes version of the machine.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^(/|https?://)[-a-zA-Z0-9.,:/@_+~=%?&]*$`
+	Snap string `json:"snap,omitempty"`
+
+	// Assertion is the assertion of the snap, either a path on the machine image or an http(s) URL.
+	// If not set, the snap is installed without signature verification.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^(/|https?://)[-a-zA-Z0-9.,:/@_+~=%?&]*$`
+	Assertion string `json:"assertion,omitempty"`
+
+	// ImageBundles is a list of image tarballs to import after MicroK8s is installed, so that the images of
+	// the cluster need not be pulled from a registry. Each is either a path on the machine image or an http(s) URL.
+	// +optional
+	ImageBundles []string `json:"imageBundles,omitempty"`
+}
+
+// Registry configures how containerd pulls images from a container registry.
+type Registry struct {
+	// Host is the registry, e.g. "docker.io" or "registry.example.com:5000". Use "_default" to configure
+	// all registries that are not configured otherwise.
+	// +kubebuilder:validation:Pattern=`^(_default|[a-zA-Z0-9]([-a-zA-Z0-9.]*[a-zA-Z0-9])?(:[0-9]+)?)$`
+	Host string `json:"host"`
+
+	// Mirrors is a list of http(s) endpoints to pull the images of the registry from, in order of preference,
+	// e.g. "https://harbor.example.com/v2/dockerhub". Images are pulled from the registry itself if no mirror
+	// serves them.
+	// +optional
+	Mirrors []string `json:"mirrors,omitempty"`
+
+	// CABundle is a PEM-encoded bundle of CA certificates to verify the registry and its mirrors.
+	// +optional
+	CABundle string `json:"caBundle,omitempty"`
+
+	// InsecureSkipVerify disables the verification of the TLS certificates of the registry and its mirrors.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+
+	// CredentialsSecretRef references a secret in the namespace of the MicroK8sConfig that holds the
+	// "username" and "password" used to authenticate to the registry and its mirrors.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -62,10 +353,32 @@ type InitConfiguration struct {
 	// +optional
 	NoProxy string `json:"noProxy,omitempty"`
 
-	// List of addons to be enabled upon cluster creation
+	// Registries configures how containerd pulls images from container registries, e.g. through mirrors.
+	// +optional
+	Registries []Registry `json:"registries,omitempty"`
+
+	// List of addons to be enabled upon cluster creation.
+	// Deprecated: Use AddonConfigs, which supports addon arguments, repositories and timeouts.
 	// +optional
 	Addons []string `json:"addons,omitempty"`
 
+	// AddonConfigs is the list of addons to be enabled upon cluster creation, in order.
+	// They are enabled after the addons listed in Addons.
+	// +optional
+	AddonConfigs []Addon `json:"addonConfigs,omitempty"`
+
+	// DisableDefaultDNS disables the dns addon, which is otherwise enabled unless it is listed in the addons.
+	// +optional
+	DisableDefaultDNS bool `json:"disableDefaultDNS,omitempty"`
+
+	// AddonRepositories is the list of addon repositories to add before the addons are enabled.
+	// +optional
+	AddonRepositories []AddonRepository `json:"addonRepositories,omitempty"`
+
+	// DisableCommunityAddons does not add the community addon repository, e.g. for air-gapped sites.
+	// +optional
+	DisableCommunityAddons bool `json:"disableCommunityAddons,omitempty"`
+
 	// The optional IPinIP configuration
 	// +optional
 	IPinIP bool `json:"IPinIP,omitempty"`
@@ -81,6 +394,25 @@ type InitConfiguration struct {
 	// +kubebuilder:default:=stable
 	RiskLevel string `json:"riskLevel,omitempty"`
 
+	// SnapRevision pins the revision of the MicroK8s snap that is installed on all machines, so that machines
+	// created at different times run the same MicroK8s build. The revision must be available in the channel that
+	// matches the Kubernetes version and risk level. By default, the machine that initializes the cluster installs
+	// the latest revision of the channel, and the joining machines install the same revision, see
+	// status.snapRevision. Revisions differ between architectures, so all machines must share one architecture.
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	SnapRevision int64 `json:"snapRevision,omitempty"`
+
+	// SnapRefresh controls when snapd refreshes the snaps of the machines, including MicroK8s.
+	// By default, snaps are refreshed automatically within their channel.
+	// +optional
+	SnapRefresh *SnapRefresh `json:"snapRefresh,omitempty"`
+
+	// Installation configures installing MicroK8s without access to the snap store, e.g. on air-gapped sites.
+	// By default, MicroK8s is installed from the snap store channel that matches the Kubernetes version.
+	// +optional
+	Installation *Installation `json:"installation,omitempty"`
+
 	// The snap store proxy domain
 	// +optional
 	SnapstoreProxyDomain string `json:"snapstoreProxyDomain,omitempty"`
@@ -105,6 +437,43 @@ type InitConfiguration struct {
 	// +optional
 	ExtraKubeletArgs []string `json:"extraKubeletArgs,omitempty"`
 
+	// NodeLabels are the labels that the kubelet registers the node with, e.g. "topology.kubernetes.io/zone".
+	// Labels in the kubernetes.io and k8s.io namespaces are restricted to those that the kubelet may set.
+	// +optional
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+
+	// NodeTaints are the taints that the kubelet registers the node with.
+	// +optional
+	NodeTaints []corev1.Taint `json:"nodeTaints,omitempty"`
+
+	// ExtraAPIServerArgs configures the arguments of the kube-apiserver.
+	// +optional
+	ExtraAPIServerArgs *ServiceArgs `json:"extraAPIServerArgs,omitempty"`
+
+	// ExtraControllerManagerArgs configures the arguments of the kube-controller-manager.
+	// +optional
+	ExtraControllerManagerArgs *ServiceArgs `json:"extraControllerManagerArgs,omitempty"`
+
+	// ExtraSchedulerArgs configures the arguments of the kube-scheduler.
+	// +optional
+	ExtraSchedulerArgs *ServiceArgs `json:"extraSchedulerArgs,omitempty"`
+
+	// ExtraKubeProxyArgs configures the arguments of the kube-proxy.
+	// +optional
+	ExtraKubeProxyArgs *ServiceArgs `json:"extraKubeProxyArgs,omitempty"`
+
+	// ExtraContainerdArgs configures the arguments of containerd.
+	// +optional
+	ExtraContainerdArgs *ServiceArgs `json:"extraContainerdArgs,omitempty"`
+
+	// ExtraK8sDqliteArgs configures the arguments of k8s-dqlite.
+	// +optional
+	ExtraK8sDqliteArgs *ServiceArgs `json:"extraK8sDqliteArgs,omitempty"`
+
+	// ExtraClusterAgentArgs configures the arguments of the MicroK8s cluster agent.
+	// +optional
+	ExtraClusterAgentArgs *ServiceArgs `json:"extraClusterAgentArgs,omitempty"`
+
 	// BootCommands is a list of commands to run during boot.
 	// These will be injected into the `bootcmd` section of cloud-init.
 	BootCommands []string `json:"bootCommands,omitempty"`
@@ -120,10 +489,31 @@ type InitConfiguration struct {
 	PostRunCommands []string `json:"postRunCommands,omitempty"`
 }
 
+// ServiceArgs configures the command-line arguments of a MicroK8s service.
+type ServiceArgs struct {
+	// Args is a list of arguments to add, e.g. "--profiling=false". An argument replaces any
+	// existing argument of the service with the same flag.
+	// +optional
+	Args []string `json:"args,omitempty"`
+
+	// Remove is a list of flags to remove from the arguments of the service, e.g. "--profiling".
+	// +optional
+	Remove []string `json:"remove,omitempty"`
+}
+
 // CloudInitWriteFile is a file that will be injected by cloud-init
 type CloudInitWriteFile struct {
 	// Content of the file to create.
-	Content string `json:"content"`
+	// +optional
+	Content string `json:"content,omitempty"`
+	// ContentFrom references a secret or a configmap in the namespace of the MicroK8sConfig that holds
+	// the content of the file. It cannot be set together with Content.
+	// +optional
+	ContentFrom *FileSource `json:"contentFrom,omitempty"`
+	// Encoding is the encoding of the content, "base64" or "gzip+base64". The content is used as-is if empty.
+	// +optional
+	// +kubebuilder:validation:Enum=base64;gzip+base64
+	Encoding Encoding `json:"encoding,omitempty"`
 	// Path where the file should be created.
 	Path string `json:"path"`
 	// Permissions of the file to create, e.g. "0600"
@@ -132,6 +522,46 @@ type CloudInitWriteFile struct {
 	Owner string `json:"owner"`
 }
 
+// FileSource is the source of the content of a file.
+type FileSource struct {
+	// Secret is a key of a secret that holds the content of the file.
+	// +optional
+	Secret *FileSourceKey `json:"secret,omitempty"`
+	// ConfigMap is a key of a configmap that holds the content of the file.
+	// +optional
+	ConfigMap *FileSourceKey `json:"configMap,omitempty"`
+}
+
+// FileSourceKey selects a key of a secret or a configmap.
+type FileSourceKey struct {
+	// Name of the secret or configmap.
+	Name string `json:"name"`
+	// Key that holds the content of the file.
+	Key string `json:"key"`
+}
+
+// Encoding specifies the encoding of the content of a file.
+type Encoding string
+
+const (
+	// Base64 is base64 encoded content.
+	Base64 Encoding = "base64"
+	// GzipBase64 is gzip compressed and base64 encoded content.
+	GzipBase64 Encoding = "gzip+base64"
+)
+
+// Format specifies the output format of the bootstrap data
+// +kubebuilder:validation:Enum=cloud-config;ignition
+type Format string
+
+const (
+	// FormatCloudConfig makes the bootstrap data to be of cloud-config format.
+	FormatCloudConfig Format = "cloud-config"
+
+	// FormatIgnition makes the bootstrap data to be of Ignition format.
+	FormatIgnition Format = "ignition"
+)
+
 // MicroK8sConfigSpec defines the desired state of MicroK8sConfig
 type MicroK8sConfigSpec struct {
 	// InitConfiguration along with ClusterConfiguration are the configurations necessary for the init command
@@ -139,6 +569,15 @@ type MicroK8sConfigSpec struct {
 	ClusterConfiguration *ClusterConfiguration `json:"clusterConfiguration,omitempty"`
 
 	InitConfiguration *InitConfiguration `json:"initConfiguration,omitempty"`
+
+	// JoinConfiguration configures the control plane and worker nodes that join the cluster. Fields that are
+	// not set fall back to those of the InitConfiguration.
+	// +optional
+	JoinConfiguration *JoinConfiguration `json:"joinConfiguration,omitempty"`
+
+	// Format specifies the output format of the bootstrap data, defaults to cloud-config
+	// +optional
+	Format Format `json:"format,omitempty"`
 }
 
 // MicroK8sConfigStatus defines the observed state of MicroK8sConfig
@@ -162,6 +601,12 @@ type MicroK8sConfigStatus struct {
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
+	// SnapRevision is the revision of the MicroK8s snap that the bootstrap data installs on a joining machine.
+	// It is the snapRevision of the spec if set, or else the revision that was installed on the machine that
+	// initialized the cluster. The latest revision of the channel is installed if unset.
+	// +optional
+	SnapRevision int64 `json:"snapRevision,omitempty"`
+
 	// +optional
 	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
 }
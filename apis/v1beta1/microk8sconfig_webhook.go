@@ -0,0 +1,743 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/version"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// DefaultJoinTokenTTLInSecs is the default TTL of the cluster join token (10 years).
+	DefaultJoinTokenTTLInSecs int64 = 315569260
+
+	// DefaultRiskLevel is the default risk level of the MicroK8s snap.
+	DefaultRiskLevel = "stable"
+
+	// DefaultClusterAgentPort is the default port of the cluster agent.
+	DefaultClusterAgentPort int32 = 25000
+	// RemappedClusterAgentPort is the port of the cluster agent if PortCompatibilityRemap is set.
+	RemappedClusterAgentPort int32 = 30000
+	// DefaultDqlitePort is the default port of dqlite.
+	DefaultDqlitePort int32 = 19001
+	// RemappedDqlitePort is the port of dqlite if PortCompatibilityRemap is set.
+	RemappedDqlitePort int32 = 2379
+	// DefaultAPIServerPort is the default port of the kube-apiserver.
+	DefaultAPIServerPort int32 = 6443
+
+	// DefaultPodCIDR is the default CIDR of the pod network of MicroK8s.
+	DefaultPodCIDR = "10.1.0.0/16"
+	// DefaultServiceCIDR is the default CIDR of the service network of MicroK8s.
+	DefaultServiceCIDR = "10.152.183.0/24"
+	// DefaultClusterDomain is the default DNS domain of the cluster.
+	DefaultClusterDomain = "cluster.local"
+
+	// CNICalicoVXLAN is the default Calico of MicroK8s, with VXLAN encapsulation.
+	CNICalicoVXLAN = "calico-vxlan"
+	// CNICalicoIPIP is Calico with IPinIP encapsulation.
+	CNICalicoIPIP = "calico-ipip"
+	// CNICalicoNone is Calico without encapsulation, routing pod traffic with BGP.
+	CNICalicoNone = "calico-none"
+	// CNICilium replaces Calico with the cilium addon.
+	CNICilium = "cilium"
+	// CNINone removes Calico, the CNI is installed by the user, e.g. with post-run commands.
+	CNINone = "none"
+
+	// microk8sAPIServerPort is the port that MicroK8s configures for the kube-apiserver.
+	microk8sAPIServerPort int32 = 16443
+)
+
+var (
+	addonNameRegexp        = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	addonArgumentsRegexp   = regexp.MustCompile(`^[-a-zA-Z0-9.,:;/=@_+]*$`)
+	addonRepositoryRegexp  = regexp.MustCompile(`^[-a-zA-Z0-9.,:/@_+~=%]+$`)
+	gitReferenceRegexp     = regexp.MustCompile(`^[-a-zA-Z0-9._/]*$`)
+	installSourceRegexp    = regexp.MustCompile(`^(/|https?://)[-a-zA-Z0-9.,:/@_+~=%?&]*$`)
+	registryHostRegexp     = regexp.MustCompile(`^(_default|[a-zA-Z0-9]([-a-zA-Z0-9.]*[a-zA-Z0-9])?(:[0-9]+)?)$`)
+	registryMirrorRegexp   = regexp.MustCompile(`^https?://[-a-zA-Z0-9.:/@_+~=%]+$`)
+	serviceArgRegexp       = regexp.MustCompile(`^--[a-zA-Z0-9][-a-zA-Z0-9._]*([= ].*)?$`)
+	serviceFlagRegexp      = regexp.MustCompile(`^--[a-zA-Z0-9][-a-zA-Z0-9._]*$`)
+	snapRefreshTimerRegexp = regexp.MustCompile(`^[a-z0-9,:~./-]*$`)
+)
+
+// kubeletNodeLabels are the labels in the kubernetes.io and k8s.io namespaces that the kubelet may
+// register the node with. See https://kubernetes.io/docs/reference/access-authn-authz/admission-controllers/#noderestriction
+var kubeletNodeLabels = map[string]struct{}{
+	"kubernetes.io/hostname":                   {},
+	"kubernetes.io/arch":                       {},
+	"kubernetes.io/os":                         {},
+	"beta.kubernetes.io/arch":                  {},
+	"beta.kubernetes.io/os":                    {},
+	"beta.kubernetes.io/instance-type":         {},
+	"node.kubernetes.io/instance-type":         {},
+	"failure-domain.beta.kubernetes.io/region": {},
+	"failure-domain.beta.kubernetes.io/zone":   {},
+	"topology.kubernetes.io/region":            {},
+	"topology.kubernetes.io/zone":              {},
+}
+
+func (c *MicroK8sConfig) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(c).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-bootstrap-cluster-x-k8s-io-v1beta1-microk8sconfig,mutating=true,failurePolicy=fail,sideEffects=None,groups=bootstrap.cluster.x-k8s.io,resources=microk8sconfigs,verbs=create;update,versions=v1beta1,name=mmicrok8sconfig.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-bootstrap-cluster-x-k8s-io-v1beta1-microk8sconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=bootstrap.cluster.x-k8s.io,resources=microk8sconfigs,verbs=create;update,versions=v1beta1,name=vmicrok8sconfig.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &MicroK8sConfig{}
+var _ webhook.Validator = &MicroK8sConfig{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type.
+func (c *MicroK8sConfig) Default() {
+	DefaultMicroK8sConfigSpec(&c.Spec)
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
+func (c *MicroK8sConfig) ValidateCreate() error {
+	return c.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+func (c *MicroK8sConfig) ValidateUpdate(old runtime.Object) error {
+	return c.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+func (c *MicroK8sConfig) ValidateDelete() error {
+	return nil
+}
+
+func (c *MicroK8sConfig) validate() error {
+	if allErrs := ValidateMicroK8sConfigSpec(&c.Spec, field.NewPath("spec")); len(allErrs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("MicroK8sConfig").GroupKind(), c.Name, allErrs)
+	}
+	return nil
+}
+
+// DefaultMicroK8sConfigSpec sets the default values of a MicroK8sConfigSpec.
+func DefaultMicroK8sConfigSpec(spec *MicroK8sConfigSpec) {
+	if spec.InitConfiguration == nil {
+		spec.InitConfiguration = &InitConfiguration{}
+	}
+	if spec.InitConfiguration.JoinTokenTTLInSecs == 0 {
+		spec.InitConfiguration.JoinTokenTTLInSecs = DefaultJoinTokenTTLInSecs
+	}
+	if spec.InitConfiguration.RiskLevel == "" {
+		spec.InitConfiguration.RiskLevel = DefaultRiskLevel
+	}
+
+	if spec.ClusterConfiguration == nil {
+		spec.ClusterConfiguration = &ClusterConfiguration{PortCompatibilityRemap: true}
+	}
+
+	if spec.Format == "" {
+		spec.Format = FormatCloudConfig
+	}
+}
+
+// ValidateMicroK8sConfigSpec validates a MicroK8sConfigSpec.
+//
+// NOTE: The Kubernetes version is set on the owner of the MicroK8sConfig, so version-dependent settings
+// (e.g. strict confinement requires v1.25+) are validated with ValidateKubernetesVersion when the bootstrap data
+// is generated.
+func ValidateMicroK8sConfigSpec(spec *MicroK8sConfigSpec, pathPrefix *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if c := spec.ClusterConfiguration; c != nil {
+		clusterPath := pathPrefix.Child("clusterConfiguration")
+		allErrs = append(allErrs, validateClusterPorts(c, clusterPath)...)
+		allErrs = append(allErrs, validateCertificateAuthority(c, clusterPath)...)
+		allErrs = append(allErrs, validateClusterNetwork(c, clusterPath)...)
+		allErrs = append(allErrs, validateCertSANs(c.CertSANs, clusterPath.Child("certSANs"))...)
+		allErrs = append(allErrs, validateJoinAddressTypes(c.JoinAddressTypes, clusterPath.Child("joinAddressTypes"))...)
+	}
+
+	if c := spec.InitConfiguration; c != nil {
+		initPath := pathPrefix.Child("initConfiguration")
+		allErrs = append(allErrs, validateAddons(c, initPath)...)
+		allErrs = append(allErrs, validateAddonRepositories(c.AddonRepositories, initPath.Child("addonRepositories"))...)
+		allErrs = append(allErrs, validateSnapRefresh(c.SnapRefresh, initPath.Child("snapRefresh"))...)
+		allErrs = append(allErrs, validateInstallation(c, initPath)...)
+		allErrs = append(allErrs, validateRegistries(c.Registries, initPath.Child("registries"))...)
+		allErrs = append(allErrs, validateServiceArgs(c, initPath)...)
+		allErrs = append(allErrs, validateNodeLabels(c.NodeLabels, initPath.Child("nodeLabels"))...)
+		allErrs = append(allErrs, validateNodeTaints(c.NodeTaints, initPath.Child("nodeTaints"))...)
+		allErrs = append(allErrs, validateWriteFiles(c.ExtraWriteFiles, initPath.Child("extraWriteFiles"))...)
+	}
+	allErrs = append(allErrs, validateCNI(spec, pathPrefix)...)
+
+	if c := spec.JoinConfiguration; c != nil {
+		joinPath := pathPrefix.Child("joinConfiguration")
+		allErrs = append(allErrs, validateWriteFiles(c.ExtraWriteFiles, joinPath.Child("extraWriteFiles"))...)
+		allErrs = append(allErrs, validateNodeLabels(c.NodeLabels, joinPath.Child("nodeLabels"))...)
+		allErrs = append(allErrs, validateNodeTaints(c.NodeTaints, joinPath.Child("nodeTaints"))...)
+	}
+
+	return allErrs
+}
+
+// validateClusterPorts validates that the cluster agent, dqlite and kube-apiserver ports do not conflict.
+func validateClusterPorts(c *ClusterConfiguration, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	clusterAgentPort, dqlitePort, apiServerPort := ClusterPorts(c)
+	if clusterAgentPort == dqlitePort {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("dqlitePort"), dqlitePort, "must not be the port of the cluster agent"))
+	}
+	if apiServerPort == clusterAgentPort || apiServerPort == dqlitePort {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("apiServerPort"), apiServerPort, "must not be the port of the cluster agent or dqlite"))
+	}
+	if clusterAgentPort == microk8sAPIServerPort || dqlitePort == microk8sAPIServerPort {
+		allErrs = append(allErrs, field.Forbidden(fldPath, fmt.Sprintf("port %d is reserved for the kube-apiserver", microk8sAPIServerPort)))
+	}
+	return allErrs
+}
+
+// validateCertificateAuthority validates that the CA of the cluster is set inline or from a secret, not both.
+func validateCertificateAuthority(c *ClusterConfiguration, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if c.CASecretRef != nil && c.CertificateAuthority != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("certificateAuthority"), "cannot be set together with caSecretRef"))
+	}
+	if c.CASecretRef != nil && c.CASecretRef.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("caSecretRef", "name"), "must be set"))
+	}
+	return allErrs
+}
+
+// validateCertSANs validates the extra SANs of the server certificate. SANs that only differ in their notation,
+// e.g. of an IPv6 address, are duplicates.
+func validateCertSANs(sans []string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := make(map[string]struct{}, len(sans))
+	for i, san := range sans {
+		parsed, err := ParseCertSAN(san)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), san, err.Error()))
+			continue
+		}
+		if _, ok := seen[parsed]; ok {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), san))
+		}
+		seen[parsed] = struct{}{}
+	}
+	return allErrs
+}
+
+// validateJoinAddressTypes validates that each machine address type is listed once.
+func validateJoinAddressTypes(addressTypes []clusterv1.MachineAddressType, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := make(map[clusterv1.MachineAddressType]struct{}, len(addressTypes))
+	for i, addressType := range addressTypes {
+		if _, ok := seen[addressType]; ok {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), addressType))
+		}
+		seen[addressType] = struct{}{}
+	}
+	return allErrs
+}
+
+// validateAddons validates the addons of the deprecated list of addon strings and the list of addon configs.
+func validateAddons(c *InitConfiguration, initPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := make(map[string]struct{}, len(c.Addons)+len(c.AddonConfigs))
+	for i, s := range c.Addons {
+		allErrs = append(allErrs, validateAddon(AddonFromString(s), initPath.Child("addons").Index(i), seen)...)
+	}
+	for i, addon := range c.AddonConfigs {
+		allErrs = append(allErrs, validateAddon(addon, initPath.Child("addonConfigs").Index(i), seen)...)
+		if c.DisableCommunityAddons && addon.Repository == "community" {
+			allErrs = append(allErrs, field.Invalid(initPath.Child("addonConfigs").Index(i).Child("repository"), addon.Repository, "cannot be used when disableCommunityAddons is set"))
+		}
+	}
+	return allErrs
+}
+
+// validateAddonRepositories validates the addon repositories. The names of the repositories shipped with
+// MicroK8s are reserved.
+func validateAddonRepositories(repositories []AddonRepository, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := make(map[string]struct{}, len(repositories))
+	for i, r := range repositories {
+		repositoryPath := fldPath.Index(i)
+		if !IsAddonName(r.Name) {
+			allErrs = append(allErrs, field.Invalid(repositoryPath.Child("name"), r.Name, "must be a valid addon repository name, e.g. \"internal\""))
+		}
+		switch r.Name {
+		case "core", "community":
+			allErrs = append(allErrs, field.Invalid(repositoryPath.Child("name"), r.Name, "is reserved for the repositories shipped with MicroK8s"))
+		}
+		if _, ok := seen[r.Name]; ok {
+			allErrs = append(allErrs, field.Duplicate(repositoryPath.Child("name"), r.Name))
+		}
+		seen[r.Name] = struct{}{}
+		if !IsAddonRepositoryURL(r.Repository) {
+			allErrs = append(allErrs, field.Invalid(repositoryPath.Child("repository"), r.Repository, "must be a git repository URL or an absolute path"))
+		}
+		if !IsGitReference(r.Reference) {
+			allErrs = append(allErrs, field.Invalid(repositoryPath.Child("reference"), r.Reference, "must be a git branch or tag"))
+		}
+	}
+	return allErrs
+}
+
+// validateSnapRefresh validates when snapd refreshes snaps.
+func validateSnapRefresh(r *SnapRefresh, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if r == nil {
+		return nil
+	}
+	if r.Hold && r.HoldUntil != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("holdUntil"), "cannot be set together with hold"))
+	}
+	if !IsSnapRefreshTimer(r.Timer) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("timer"), r.Timer, "must be a snapd refresh timer, e.g. \"sat,02:00-04:00\""))
+	}
+	return allErrs
+}
+
+// validateInstallation validates installing MicroK8s from a snap file and importing image bundles.
+func validateInstallation(c *InitConfiguration, initPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	in := c.Installation
+	if in == nil {
+		return nil
+	}
+	installationPath := initPath.Child("installation")
+	if in.Snap != "" && c.SnapRevision != 0 {
+		allErrs = append(allErrs, field.Forbidden(initPath.Child("snapRevision"), "cannot be set together with installation.snap"))
+	}
+	if in.Snap != "" && !IsInstallSource(in.Snap) {
+		allErrs = append(allErrs, field.Invalid(installationPath.Child("snap"), in.Snap, "must be an absolute path or an http(s) URL"))
+	}
+	if in.Assertion != "" {
+		if in.Snap == "" {
+			allErrs = append(allErrs, field.Forbidden(installationPath.Child("assertion"), "cannot be set without snap"))
+		} else if !IsInstallSource(in.Assertion) {
+			allErrs = append(allErrs, field.Invalid(installationPath.Child("assertion"), in.Assertion, "must be an absolute path or an http(s) URL"))
+		}
+	}
+	for i, bundle := range in.ImageBundles {
+		if !IsInstallSource(bundle) {
+			allErrs = append(allErrs, field.Invalid(installationPath.Child("imageBundles").Index(i), bundle, "must be an absolute path or an http(s) URL"))
+		}
+	}
+	return allErrs
+}
+
+// validateRegistries validates the container registries. Each registry host is configured once.
+func validateRegistries(registries []Registry, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := make(map[string]struct{}, len(registries))
+	for i, r := range registries {
+		registryPath := fldPath.Index(i)
+		if !IsRegistryHost(r.Host) {
+			allErrs = append(allErrs, field.Invalid(registryPath.Child("host"), r.Host, "must be a registry host, e.g. \"docker.io\", or \"_default\""))
+		}
+		if _, ok := seen[r.Host]; ok {
+			allErrs = append(allErrs, field.Duplicate(registryPath.Child("host"), r.Host))
+		}
+		seen[r.Host] = struct{}{}
+		for j, mirror := range r.Mirrors {
+			if !IsRegistryMirror(mirror) {
+				allErrs = append(allErrs, field.Invalid(registryPath.Child("mirrors").Index(j), mirror, "must be an http(s) URL"))
+			}
+		}
+		if r.CredentialsSecretRef != nil && r.CredentialsSecretRef.Name == "" {
+			allErrs = append(allErrs, field.Required(registryPath.Child("credentialsSecretRef", "name"), "must be set"))
+		}
+	}
+	return allErrs
+}
+
+// validateServiceArgs validates the extra arguments of the MicroK8s services.
+func validateServiceArgs(c *InitConfiguration, initPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, service := range []struct {
+		name string
+		args *ServiceArgs
+	}{
+		{"extraAPIServerArgs", c.ExtraAPIServerArgs},
+		{"extraControllerManagerArgs", c.ExtraControllerManagerArgs},
+		{"extraSchedulerArgs", c.ExtraSchedulerArgs},
+		{"extraKubeProxyArgs", c.ExtraKubeProxyArgs},
+		{"extraContainerdArgs", c.ExtraContainerdArgs},
+		{"extraK8sDqliteArgs", c.ExtraK8sDqliteArgs},
+		{"extraClusterAgentArgs", c.ExtraClusterAgentArgs},
+	} {
+		if service.args == nil {
+			continue
+		}
+		for i, arg := range service.args.Args {
+			if !IsServiceArg(arg) {
+				allErrs = append(allErrs, field.Invalid(initPath.Child(service.name, "args").Index(i), arg, "must be of the form --flag=value"))
+			}
+		}
+		for i, flag := range service.args.Remove {
+			if !IsServiceFlag(flag) {
+				allErrs = append(allErrs, field.Invalid(initPath.Child(service.name, "remove").Index(i), flag, "must be of the form --flag"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// ValidateKubernetesVersion checks that MicroK8s can be installed for the Kubernetes version and confinement.
+func ValidateKubernetesVersion(kubernetesVersion string, confinement string) error {
+	v, err := version.ParseSemantic(kubernetesVersion)
+	if err != nil {
+		return fmt.Errorf("kubernetes version %q is not a semantic version: %w", kubernetesVersion, err)
+	}
+	if confinement == "strict" && v.Minor() < 25 {
+		return fmt.Errorf("strict confinement is only available for microk8s v1.25+, but version is %s", kubernetesVersion)
+	}
+	return nil
+}
+
+// ClusterPorts returns the ports of the cluster agent, dqlite and the kube-apiserver of a cluster configuration.
+func ClusterPorts(c *ClusterConfiguration) (clusterAgentPort int32, dqlitePort int32, apiServerPort int32) {
+	clusterAgentPort, dqlitePort, apiServerPort = RemappedClusterAgentPort, RemappedDqlitePort, DefaultAPIServerPort
+	if c == nil {
+		return
+	}
+	if !c.PortCompatibilityRemap {
+		clusterAgentPort, dqlitePort = DefaultClusterAgentPort, DefaultDqlitePort
+	}
+	if c.ClusterAgentPort != 0 {
+		clusterAgentPort = c.ClusterAgentPort
+	}
+	if c.DqlitePort != 0 {
+		dqlitePort = c.DqlitePort
+	}
+	if c.APIServerPort != 0 {
+		apiServerPort = c.APIServerPort
+	}
+	return
+}
+
+// validateClusterNetwork validates the pod and service CIDRs and the DNS domain of the cluster. The pod and
+// service networks must not overlap, including with the defaults of MicroK8s if only one of them is set.
+func validateClusterNetwork(c *ClusterConfiguration, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	podCIDR, serviceCIDR := c.PodCIDR, c.ServiceCIDR
+	if podCIDR == "" {
+		podCIDR = DefaultPodCIDR
+	}
+	if serviceCIDR == "" {
+		serviceCIDR = DefaultServiceCIDR
+	}
+	podNets, err := ParseDualStackCIDRs(podCIDR)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("podCIDR"), c.PodCIDR, err.Error()))
+	}
+	serviceNets, err := ParseDualStackCIDRs(serviceCIDR)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("serviceCIDR"), c.ServiceCIDR, err.Error()))
+	}
+	for _, podNet := range podNets {
+		for _, serviceNet := range serviceNets {
+			if podNet.Contains(serviceNet.IP) || serviceNet.Contains(podNet.IP) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("podCIDR"), podCIDR, fmt.Sprintf("must not overlap with the service CIDR %s", serviceNet)))
+			}
+		}
+	}
+	if c.ClusterDomain != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(c.ClusterDomain) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("clusterDomain"), c.ClusterDomain, msg))
+		}
+	}
+	return allErrs
+}
+
+// validateCNI validates the CNI of the cluster against the IPinIP setting and the addons, which must not
+// contradict it.
+func validateCNI(spec *MicroK8sConfigSpec, pathPrefix *field.Path) field.ErrorList {
+	if spec.ClusterConfiguration == nil || spec.ClusterConfiguration.CNI == "" || spec.InitConfiguration == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	cni, c := spec.ClusterConfiguration.CNI, spec.InitConfiguration
+	initPath := pathPrefix.Child("initConfiguration")
+	if c.IPinIP && cni != CNICalicoIPIP {
+		allErrs = append(allErrs, field.Forbidden(initPath.Child("IPinIP"), fmt.Sprintf("cannot be set with CNI %q", cni)))
+	}
+
+	hasCiliumAddon := false
+	for _, addon := range []struct {
+		path   *field.Path
+		addons []Addon
+	}{
+		{initPath.Child("addons"), addonsFromStrings(c.Addons)},
+		{initPath.Child("addonConfigs"), c.AddonConfigs},
+	} {
+		for i, a := range addon.addons {
+			if a.Name != CNICilium {
+				continue
+			}
+			hasCiliumAddon = true
+			if cni != CNICilium {
+				allErrs = append(allErrs, field.Invalid(addon.path.Index(i), a.Name, fmt.Sprintf("cannot be enabled with CNI %q", cni)))
+			}
+		}
+	}
+	if cni == CNICilium && c.DisableCommunityAddons && !hasCiliumAddon {
+		allErrs = append(allErrs, field.Forbidden(initPath.Child("disableCommunityAddons"), fmt.Sprintf("cannot be set with CNI %q, unless the cilium addon is enabled from another repository", cni)))
+	}
+	return allErrs
+}
+
+// addonsFromStrings parses the addons of an init configuration.
+func addonsFromStrings(addons []string) []Addon {
+	result := make([]Addon, 0, len(addons))
+	for _, s := range addons {
+		result = append(result, AddonFromString(s))
+	}
+	return result
+}
+
+// ParseDualStackCIDRs parses the pod or service CIDR of a cluster configuration. This is an IPv4 CIDR,
+// optionally followed by a comma and an IPv6 CIDR for dual-stack clusters.
+func ParseDualStackCIDRs(cidrs string) ([]*net.IPNet, error) {
+	parts := strings.Split(cidrs, ",")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("must be an IPv4 CIDR, optionally followed by an IPv6 CIDR")
+	}
+	result := make([]*net.IPNet, 0, len(parts))
+	for i, part := range parts {
+		ip, ipNet, err := net.ParseCIDR(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CIDR", part)
+		}
+		if !ip.Equal(ipNet.IP) {
+			return nil, fmt.Errorf("%q is not the network address of the CIDR, did you mean %q?", part, ipNet.String())
+		}
+		if isIPv4 := ip.To4() != nil; isIPv4 != (i == 0) {
+			return nil, fmt.Errorf("must be an IPv4 CIDR, optionally followed by an IPv6 CIDR")
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
+}
+
+// ParseCertSAN parses a subject alternative name of the server certificate, which is an IP address or a
+// (wildcard) DNS name. It returns the SAN as "IP:<address>" or "DNS:<name>".
+func ParseCertSAN(san string) (string, error) {
+	if ip := net.ParseIP(san); ip != nil {
+		return "IP:" + ip.String(), nil
+	}
+	if strings.HasPrefix(san, "*.") {
+		if errs := validation.IsWildcardDNS1123Subdomain(san); len(errs) > 0 {
+			return "", fmt.Errorf("must be an IP address or a DNS name: %s", strings.Join(errs, ", "))
+		}
+	} else if errs := validation.IsDNS1123Subdomain(san); len(errs) > 0 {
+		return "", fmt.Errorf("must be an IP address or a DNS name: %s", strings.Join(errs, ", "))
+	}
+	// a top-level domain is never numeric, so this is most likely a mistyped IPv4 address
+	if tld := san[strings.LastIndex(san, ".")+1:]; strings.Trim(tld, "0123456789") == "" {
+		return "", fmt.Errorf("must be an IP address or a DNS name")
+	}
+	return "DNS:" + san, nil
+}
+
+// validateWriteFiles validates the extra files to inject with cloud-init.
+func validateWriteFiles(files []CloudInitWriteFile, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, f := range files {
+		filePath := fldPath.Index(i)
+		if f.Path == "" {
+			allErrs = append(allErrs, field.Required(filePath.Child("path"), "must be set"))
+		} else if !path.IsAbs(f.Path) {
+			allErrs = append(allErrs, field.Invalid(filePath.Child("path"), f.Path, "must be an absolute path"))
+		}
+		if from := f.ContentFrom; from != nil {
+			if f.Content != "" {
+				allErrs = append(allErrs, field.Forbidden(filePath.Child("contentFrom"), "cannot be set together with content"))
+			}
+			if (from.Secret == nil) == (from.ConfigMap == nil) {
+				allErrs = append(allErrs, field.Invalid(filePath.Child("contentFrom"), "", "must reference either a secret or a configMap"))
+			}
+		}
+		if f.Permissions != "" {
+			if m, err := strconv.ParseUint(f.Permissions, 8, 32); err != nil || m > 07777 {
+				allErrs = append(allErrs, field.Invalid(filePath.Child("permissions"), f.Permissions, "must be an octal file mode, e.g. \"0600\""))
+			}
+		}
+	}
+	return allErrs
+}
+
+// IsRestrictedNodeLabel returns true if the kubelet may not register a node with the label, because it is in
+// the kubernetes.io or k8s.io namespaces. Labels in the kubelet.kubernetes.io and node.kubernetes.io namespaces,
+// and well-known labels like "topology.kubernetes.io/zone" are allowed.
+func IsRestrictedNodeLabel(key string) bool {
+	if _, ok := kubeletNodeLabels[key]; ok {
+		return false
+	}
+	namespace, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return false
+	}
+	for _, allowed := range []string{"kubelet.kubernetes.io", "node.kubernetes.io"} {
+		if namespace == allowed || strings.HasSuffix(namespace, "."+allowed) {
+			return false
+		}
+	}
+	for _, restricted := range []string{"kubernetes.io", "k8s.io"} {
+		if namespace == restricted || strings.HasSuffix(namespace, "."+restricted) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateNodeLabels validates the labels that the kubelet registers the node with.
+func validateNodeLabels(labels map[string]string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for key, value := range labels {
+		for _, msg := range validation.IsQualifiedName(key) {
+			allErrs = append(allErrs, field.Invalid(fldPath, key, msg))
+		}
+		if IsRestrictedNodeLabel(key) {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Key(key), "labels in the kubernetes.io and k8s.io namespaces cannot be set by the kubelet"))
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(key), value, msg))
+		}
+	}
+	return allErrs
+}
+
+// validateNodeTaints validates the taints that the kubelet registers the node with.
+func validateNodeTaints(taints []corev1.Taint, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, taint := range taints {
+		taintPath := fldPath.Index(i)
+		for _, msg := range validation.IsQualifiedName(taint.Key) {
+			allErrs = append(allErrs, field.Invalid(taintPath.Child("key"), taint.Key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(taint.Value) {
+			allErrs = append(allErrs, field.Invalid(taintPath.Child("value"), taint.Value, msg))
+		}
+		switch taint.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			allErrs = append(allErrs, field.NotSupported(taintPath.Child("effect"), taint.Effect, []string{
+				string(corev1.TaintEffectNoSchedule), string(corev1.TaintEffectPreferNoSchedule), string(corev1.TaintEffectNoExecute),
+			}))
+		}
+	}
+	return allErrs
+}
+
+// validateAddon validates an addon. seen is used to detect addons that are enabled more than once.
+func validateAddon(addon Addon, fldPath *field.Path, seen map[string]struct{}) field.ErrorList {
+	var allErrs field.ErrorList
+	if !IsAddonName(addon.Name) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("name"), addon.Name, "must be a valid addon name, e.g. \"metallb\""))
+	}
+	if addon.Repository != "" && !IsAddonName(addon.Repository) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("repository"), addon.Repository, "must be a valid addon repository name, e.g. \"community\""))
+	}
+	if !IsAddonArguments(addon.Arguments) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("arguments"), addon.Arguments, "must only contain alphanumeric characters and any of \"-.,:;/=@_+\""))
+	}
+	if _, ok := seen[addon.Name]; ok {
+		allErrs = append(allErrs, field.Duplicate(fldPath.Child("name"), addon.Name))
+	}
+	seen[addon.Name] = struct{}{}
+	return allErrs
+}
+
+// AddonFromString parses an addon in the format "[repository/]name[:arguments]",
+// as accepted by "microk8s enable".
+func AddonFromString(s string) Addon {
+	var addon Addon
+	s, addon.Arguments, _ = strings.Cut(s, ":")
+	if repository, name, ok := strings.Cut(s, "/"); ok {
+		addon.Repository, addon.Name = repository, name
+	} else {
+		addon.Name = s
+	}
+	return addon
+}
+
+// IsAddonName returns true if s is a valid name of an addon or an addon repository.
+func IsAddonName(s string) bool {
+	return addonNameRegexp.MatchString(s)
+}
+
+// IsAddonArguments returns true if s are valid arguments of an addon, which are passed to "microk8s enable"
+// without quoting.
+func IsAddonArguments(s string) bool {
+	return addonArgumentsRegexp.MatchString(s)
+}
+
+// IsAddonRepositoryURL returns true if s is a valid git repository URL or local path of an addon repository.
+func IsAddonRepositoryURL(s string) bool {
+	return addonRepositoryRegexp.MatchString(s)
+}
+
+// IsGitReference returns true if s is a valid git branch or tag. An empty reference is the default branch.
+func IsGitReference(s string) bool {
+	return gitReferenceRegexp.MatchString(s)
+}
+
+// IsInstallSource returns true if s is an absolute path or an http(s) URL that a snap, an assertion or an
+// image bundle can be installed from.
+func IsInstallSource(s string) bool {
+	return installSourceRegexp.MatchString(s)
+}
+
+// IsSnapRefreshTimer returns true if s only contains the characters of a snapd refresh timer, e.g.
+// "sat,02:00-04:00". An empty timer is the snapd default.
+func IsSnapRefreshTimer(s string) bool {
+	return snapRefreshTimerRegexp.MatchString(s)
+}
+
+// IsServiceArg returns true if s is an argument of a MicroK8s service of the form "--flag=value".
+func IsServiceArg(s string) bool {
+	return serviceArgRegexp.MatchString(s)
+}
+
+// IsServiceFlag returns true if s is a flag of a MicroK8s service of the form "--flag".
+func IsServiceFlag(s string) bool {
+	return serviceFlagRegexp.MatchString(s)
+}
+
+// IsRegistryHost returns true if s is a container registry host, e.g. "docker.io", or "_default".
+func IsRegistryHost(s string) bool {
+	return registryHostRegexp.MatchString(s)
+}
+
+// IsRegistryMirror returns true if s is an http(s) URL of a container registry mirror.
+func IsRegistryMirror(s string) bool {
+	return registryMirrorRegexp.MatchString(s)
+}
@@ -0,0 +1,636 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func TestMicroK8sConfigDefault(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &MicroK8sConfig{}
+	c.Default()
+
+	g.Expect(c.Spec.InitConfiguration).NotTo(BeNil())
+	g.Expect(c.Spec.InitConfiguration.JoinTokenTTLInSecs).To(Equal(DefaultJoinTokenTTLInSecs))
+	g.Expect(c.Spec.InitConfiguration.RiskLevel).To(Equal("stable"))
+	g.Expect(c.Spec.ClusterConfiguration).To(Equal(&ClusterConfiguration{PortCompatibilityRemap: true}))
+	g.Expect(c.Spec.Format).To(Equal(FormatCloudConfig))
+
+	c = &MicroK8sConfig{Spec: MicroK8sConfigSpec{
+		ClusterConfiguration: &ClusterConfiguration{PortCompatibilityRemap: false},
+		InitConfiguration:    &InitConfiguration{RiskLevel: "edge"},
+		Format:               FormatIgnition,
+	}}
+	c.Default()
+	g.Expect(c.Spec.ClusterConfiguration.PortCompatibilityRemap).To(BeFalse())
+	g.Expect(c.Spec.InitConfiguration.RiskLevel).To(Equal("edge"))
+	g.Expect(c.Spec.Format).To(Equal(FormatIgnition))
+}
+
+func TestMicroK8sConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		spec      MicroK8sConfigSpec
+		expectErr bool
+	}{
+		{
+			name: "Empty",
+		},
+		{
+			name: "ExtraWriteFiles",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{{Path: "/etc/file", Permissions: "0644"}, {Path: "/etc/other"}},
+			}},
+		},
+		{
+			name: "ExtraWriteFilesNonOctalPermissions",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{{Path: "/etc/file", Permissions: "rw-r--r--"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ExtraWriteFilesInvalidMode",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{{Path: "/etc/file", Permissions: "17777"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ExtraWriteFilesRelativePath",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{{Path: "etc/file"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ExtraWriteFilesContentFrom",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{
+					{Path: "/etc/tls.key", ContentFrom: &FileSource{Secret: &FileSourceKey{Name: "tls", Key: "tls.key"}}},
+					{Path: "/etc/config.gz", ContentFrom: &FileSource{ConfigMap: &FileSourceKey{Name: "config", Key: "config.gz"}}, Encoding: GzipBase64},
+				},
+			}},
+		},
+		{
+			name: "ExtraWriteFilesContentAndContentFrom",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{{Path: "/etc/file", Content: "content", ContentFrom: &FileSource{Secret: &FileSourceKey{Name: "tls", Key: "tls.key"}}}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ExtraWriteFilesContentFromSecretAndConfigMap",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{{Path: "/etc/file", ContentFrom: &FileSource{
+					Secret:    &FileSourceKey{Name: "tls", Key: "tls.key"},
+					ConfigMap: &FileSourceKey{Name: "config", Key: "config"},
+				}}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ExtraWriteFilesContentFromEmpty",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{{Path: "/etc/file", ContentFrom: &FileSource{}}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "Addons",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				Addons:       []string{"dns", "community/istio", "metallb:10.0.0.1-10.0.0.10"},
+				AddonConfigs: []Addon{{Name: "ingress", Repository: "core", TimeoutSeconds: 300}},
+			}},
+		},
+		{
+			name: "AddonsInvalidName",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				Addons: []string{"dns; reboot"},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "AddonsInvalidArguments",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				AddonConfigs: []Addon{{Name: "metallb", Arguments: "$(reboot)"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "AddonsDuplicate",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				Addons:       []string{"dns"},
+				AddonConfigs: []Addon{{Name: "dns", Arguments: "1.1.1.1"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "AddonRepositories",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				AddonRepositories: []AddonRepository{
+					{Name: "internal", Repository: "git@git.example.com:team/addons.git", Reference: "main"},
+					{Name: "local", Repository: "/opt/addons"},
+				},
+				AddonConfigs:           []Addon{{Name: "monitoring", Repository: "internal"}},
+				DisableCommunityAddons: true,
+			}},
+		},
+		{
+			name: "AddonRepositoriesReservedName",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				AddonRepositories: []AddonRepository{{Name: "community", Repository: "https://git.example.com/addons.git"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "AddonRepositoriesDuplicate",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				AddonRepositories: []AddonRepository{{Name: "internal", Repository: "/opt/a"}, {Name: "internal", Repository: "/opt/b"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "AddonRepositoriesInvalidRepository",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				AddonRepositories: []AddonRepository{{Name: "internal", Repository: "https://example.com/`reboot`"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "CommunityAddonWithDisableCommunityAddons",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				AddonConfigs:           []Addon{{Name: "istio", Repository: "community"}},
+				DisableCommunityAddons: true,
+			}},
+			expectErr: true,
+		},
+		{
+			name: "Installation",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				Installation: &Installation{
+					Snap:         "https://files.example.com/microk8s_4094.snap",
+					Assertion:    "/opt/microk8s_4094.assert",
+					ImageBundles: []string{"/opt/images.tar"},
+				},
+			}},
+		},
+		{
+			name: "SnapRefresh",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				SnapRefresh: &SnapRefresh{Hold: true, Timer: "sat,02:00-04:00"},
+			}},
+		},
+		{
+			name: "SnapRefreshHoldAndHoldUntil",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				SnapRefresh: &SnapRefresh{Hold: true, HoldUntil: &metav1.Time{}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "SnapRevisionWithInstallationSnap",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				SnapRevision: 4094,
+				Installation: &Installation{Snap: "/opt/microk8s_4094.snap"},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "InstallationAssertionWithoutSnap",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				Installation: &Installation{Assertion: "/opt/microk8s_4094.assert"},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "InstallationRelativeImageBundle",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				Installation: &Installation{ImageBundles: []string{"images.tar"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "Ports",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				ClusterAgentPort: 31000,
+				DqlitePort:       31001,
+				APIServerPort:    31002,
+			}},
+		},
+		{
+			name: "PortsConflictWithRemap",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				PortCompatibilityRemap: true,
+				DqlitePort:             30000,
+			}},
+			expectErr: true,
+		},
+		{
+			name: "PortsConflictWithAPIServer",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				ClusterAgentPort: 6443,
+			}},
+			expectErr: true,
+		},
+		{
+			name: "PortsReservedAPIServerPort",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				DqlitePort: 16443,
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ClusterNetwork",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				PodCIDR:          "10.2.0.0/16,fd01::/64",
+				ServiceCIDR:      "10.153.0.0/16",
+				JoinAddressTypes: []clusterv1.MachineAddressType{clusterv1.MachineInternalDNS, clusterv1.MachineInternalIP},
+			}},
+		},
+		{
+			name: "PodCIDRInvalid",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				PodCIDR: "10.2.0.0",
+			}},
+			expectErr: true,
+		},
+		{
+			name: "PodCIDRIPv6First",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				PodCIDR: "fd01::/64,10.2.0.0/16",
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ServiceCIDRNotNetworkAddress",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				ServiceCIDR: "10.153.0.1/16",
+			}},
+			expectErr: true,
+		},
+		{
+			name: "PodCIDROverlapsServiceCIDR",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				PodCIDR:     "10.0.0.0/8",
+				ServiceCIDR: "10.96.0.0/12",
+			}},
+			expectErr: true,
+		},
+		{
+			name: "PodCIDROverlapsDefaultServiceCIDR",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				PodCIDR: "10.152.0.0/16",
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ServiceCIDROverlapsIPv6PodCIDR",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				PodCIDR:     "10.2.0.0/16,fd01::/48",
+				ServiceCIDR: "10.153.0.0/16,fd01::/108",
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ClusterDomain",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				ClusterDomain: "cluster.example.com",
+			}},
+		},
+		{
+			name: "ClusterDomainInvalid",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				ClusterDomain: "Cluster_Local",
+			}},
+			expectErr: true,
+		},
+		{
+			name: "CertSANs",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				CertSANs: []string{"10.0.0.100", "k8s.example.com", "fd00::100", "*.k8s.example.com"},
+			}},
+		},
+		{
+			name: "CertSANsInvalid",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				CertSANs: []string{"10.0.0.100", "https://k8s.example.com", "10.0.0.256"},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "CertSANsDuplicate",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				CertSANs: []string{"fd00::100", "fd00:0::100"},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "CNICilium",
+			spec: MicroK8sConfigSpec{
+				ClusterConfiguration: &ClusterConfiguration{CNI: "cilium"},
+				InitConfiguration:    &InitConfiguration{Addons: []string{"community/cilium:--some-arg"}},
+			},
+		},
+		{
+			name: "CNICalicoIPIP",
+			spec: MicroK8sConfigSpec{
+				ClusterConfiguration: &ClusterConfiguration{CNI: "calico-ipip"},
+				InitConfiguration:    &InitConfiguration{IPinIP: true},
+			},
+		},
+		{
+			name: "CNIWithIPinIP",
+			spec: MicroK8sConfigSpec{
+				ClusterConfiguration: &ClusterConfiguration{CNI: "calico-vxlan"},
+				InitConfiguration:    &InitConfiguration{IPinIP: true},
+			},
+			expectErr: true,
+		},
+		{
+			name: "CNIWithCiliumAddon",
+			spec: MicroK8sConfigSpec{
+				ClusterConfiguration: &ClusterConfiguration{CNI: "none"},
+				InitConfiguration:    &InitConfiguration{AddonConfigs: []Addon{{Name: "cilium", Repository: "community"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "CNICiliumWithoutCommunityAddons",
+			spec: MicroK8sConfigSpec{
+				ClusterConfiguration: &ClusterConfiguration{CNI: "cilium"},
+				InitConfiguration:    &InitConfiguration{DisableCommunityAddons: true},
+			},
+			expectErr: true,
+		},
+		{
+			name: "JoinAddressTypesDuplicate",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				JoinAddressTypes: []clusterv1.MachineAddressType{clusterv1.MachineExternalDNS, clusterv1.MachineExternalDNS},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ServiceArgs",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraAPIServerArgs:    &ServiceArgs{Args: []string{"--profiling=false", "--audit-log-path /var/log/audit.log"}, Remove: []string{"--insecure-port"}},
+				ExtraClusterAgentArgs: &ServiceArgs{Remove: []string{"--min-tls-version"}},
+			}},
+		},
+		{
+			name: "ServiceArgsInvalidArg",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraSchedulerArgs: &ServiceArgs{Args: []string{"profiling=false"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "ServiceArgsInvalidRemove",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				ExtraK8sDqliteArgs: &ServiceArgs{Remove: []string{"--storage-dir=/var"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "Registries",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				Registries: []Registry{
+					{Host: "docker.io", Mirrors: []string{"https://harbor.example.com/v2/dockerhub"}, CredentialsSecretRef: &corev1.LocalObjectReference{Name: "harbor"}},
+					{Host: "registry.example.com:5000", InsecureSkipVerify: true},
+					{Host: "_default", Mirrors: []string{"http://10.0.0.10:5000"}},
+				},
+			}},
+		},
+		{
+			name: "RegistriesDuplicate",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				Registries: []Registry{{Host: "docker.io"}, {Host: "docker.io"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "RegistriesInvalidMirror",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				Registries: []Registry{{Host: "docker.io", Mirrors: []string{"harbor.example.com"}}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "NodeLabelsAndTaints",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				NodeLabels: map[string]string{"node-role": "gpu", "topology.kubernetes.io/zone": "zone-a", "node.kubernetes.io/pool": "a100"},
+				NodeTaints: []corev1.Taint{{Key: "nvidia.com/gpu", Value: "present", Effect: corev1.TaintEffectNoSchedule}},
+			}},
+		},
+		{
+			name: "NodeLabelsRestricted",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				NodeLabels: map[string]string{"node-role.kubernetes.io/worker": ""},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "NodeLabelsInvalidValue",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				NodeLabels: map[string]string{"pool": "a,b"},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "NodeTaintsInvalidEffect",
+			spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{
+				NodeTaints: []corev1.Taint{{Key: "gpu", Effect: "Never"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "JoinConfiguration",
+			spec: MicroK8sConfigSpec{JoinConfiguration: &JoinConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{{Path: "/etc/file", Content: "content", Permissions: "0600"}},
+				NodeLabels:      map[string]string{"node-role": "worker"},
+				NodeTaints:      []corev1.Taint{{Key: "dedicated", Effect: corev1.TaintEffectNoExecute}},
+			}},
+		},
+		{
+			name: "JoinConfigurationExtraWriteFilesRelativePath",
+			spec: MicroK8sConfigSpec{JoinConfiguration: &JoinConfiguration{
+				ExtraWriteFiles: []CloudInitWriteFile{{Path: "etc/file", Content: "content"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "JoinConfigurationNodeLabelsRestricted",
+			spec: MicroK8sConfigSpec{JoinConfiguration: &JoinConfiguration{
+				NodeLabels: map[string]string{"node-role.kubernetes.io/worker": ""},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "CASecretRefWithCertificateAuthority",
+			spec: MicroK8sConfigSpec{ClusterConfiguration: &ClusterConfiguration{
+				CASecretRef:          &corev1.LocalObjectReference{Name: "ca"},
+				CertificateAuthority: &CertificateAuthority{ValidityInDays: 10},
+			}},
+			expectErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := &MicroK8sConfig{Spec: tc.spec}
+			if tc.expectErr {
+				g.Expect(c.ValidateCreate()).NotTo(Succeed())
+				g.Expect(c.ValidateUpdate(c.DeepCopy())).NotTo(Succeed())
+			} else {
+				g.Expect(c.ValidateCreate()).To(Succeed())
+				g.Expect(c.ValidateUpdate(c.DeepCopy())).To(Succeed())
+			}
+		})
+	}
+}
+
+func TestMicroK8sConfigTemplateValidate(t *testing.T) {
+	newTemplate := func(addons ...string) *MicroK8sConfigTemplate {
+		tmpl := &MicroK8sConfigTemplate{Spec: MicroK8sConfigTemplateSpec{Template: MicroK8sConfigTemplateResource{
+			Spec: MicroK8sConfigSpec{InitConfiguration: &InitConfiguration{Addons: addons}},
+		}}}
+		tmpl.Default()
+		return tmpl
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(newTemplate("dns").ValidateCreate()).To(Succeed())
+
+		tmpl := newTemplate()
+		tmpl.Spec.Template.Spec.InitConfiguration.ExtraWriteFiles = []CloudInitWriteFile{{Path: "/etc/file", Permissions: "abc"}}
+		g.Expect(tmpl.ValidateCreate()).NotTo(Succeed())
+	})
+
+	t.Run("Immutable", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(newTemplate("dns").ValidateUpdate(newTemplate("dns"))).To(Succeed())
+		g.Expect(newTemplate("dns", "ingress").ValidateUpdate(newTemplate("dns"))).NotTo(Succeed())
+	})
+
+	t.Run("ImmutableWithoutDefaults", func(t *testing.T) {
+		g := NewWithT(t)
+
+		old := &MicroK8sConfigTemplate{}
+		g.Expect(newTemplate().ValidateUpdate(old)).To(Succeed())
+	})
+}
+
+func TestValidateKubernetesVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		version     string
+		confinement string
+		expectErr   bool
+	}{
+		{name: "Classic", version: "v1.24.0"},
+		{name: "Strict", version: "v1.25.0", confinement: "strict"},
+		{name: "StrictUnsupported", version: "v1.24.0", confinement: "strict", expectErr: true},
+		{name: "NotSemver", version: "latest", expectErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := ValidateKubernetesVersion(tc.version, tc.confinement)
+			if tc.expectErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestAddonFromString(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		expected Addon
+	}{
+		{s: "dns", expected: Addon{Name: "dns"}},
+		{s: "metallb:10.0.0.1-10.0.0.10", expected: Addon{Name: "metallb", Arguments: "10.0.0.1-10.0.0.10"}},
+		{s: "community/istio", expected: Addon{Name: "istio", Repository: "community"}},
+		{s: "core/dns:1.1.1.1,8.8.8.8", expected: Addon{Name: "dns", Repository: "core", Arguments: "1.1.1.1,8.8.8.8"}},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(AddonFromString(tc.s)).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestIsRestrictedNodeLabel(t *testing.T) {
+	for _, tc := range []struct {
+		key        string
+		restricted bool
+	}{
+		{key: "node-role", restricted: false},
+		{key: "example.com/pool", restricted: false},
+		{key: "topology.kubernetes.io/zone", restricted: false},
+		{key: "kubernetes.io/hostname", restricted: false},
+		{key: "node.kubernetes.io/pool", restricted: false},
+		{key: "pool.kubelet.kubernetes.io/gpu", restricted: false},
+		{key: "kubernetes.io/pool", restricted: true},
+		{key: "node-role.kubernetes.io/worker", restricted: true},
+		{key: "k8s.io/pool", restricted: true},
+		{key: "example.k8s.io/pool", restricted: true},
+	} {
+		t.Run(tc.key, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(IsRestrictedNodeLabel(tc.key)).To(Equal(tc.restricted))
+		})
+	}
+}
+
+func TestClusterPorts(t *testing.T) {
+	for _, tc := range []struct {
+		name                                        string
+		config                                      *ClusterConfiguration
+		clusterAgentPort, dqlitePort, apiServerPort int32
+	}{
+		{name: "Nil", config: nil, clusterAgentPort: 30000, dqlitePort: 2379, apiServerPort: 6443},
+		{name: "Default", config: &ClusterConfiguration{}, clusterAgentPort: 25000, dqlitePort: 19001, apiServerPort: 6443},
+		{name: "Remap", config: &ClusterConfiguration{PortCompatibilityRemap: true}, clusterAgentPort: 30000, dqlitePort: 2379, apiServerPort: 6443},
+		{
+			name:             "Explicit",
+			config:           &ClusterConfiguration{PortCompatibilityRemap: true, ClusterAgentPort: 31000, DqlitePort: 31001, APIServerPort: 31002},
+			clusterAgentPort: 31000, dqlitePort: 31001, apiServerPort: 31002,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterAgentPort, dqlitePort, apiServerPort := ClusterPorts(tc.config)
+			g.Expect(clusterAgentPort).To(Equal(tc.clusterAgentPort))
+			g.Expect(dqlitePort).To(Equal(tc.dqlitePort))
+			g.Expect(apiServerPort).To(Equal(tc.apiServerPort))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func (t *MicroK8sConfigTemplate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(t).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-bootstrap-cluster-x-k8s-io-v1beta1-microk8sconfigtemplate,mutating=true,failurePolicy=fail,sideEffects=None,groups=bootstrap.cluster.x-k8s.io,resources=microk8sconfigtemplates,verbs=create;update,versions=v1beta1,name=mmicrok8sconfigtemplate.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-bootstrap-cluster-x-k8s-io-v1beta1-microk8sconfigtemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=bootstrap.cluster.x-k8s.io,resources=microk8sconfigtemplates,verbs=create;update,versions=v1beta1,name=vmicrok8sconfigtemplate.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &MicroK8sConfigTemplate{}
+var _ webhook.Validator = &MicroK8sConfigTemplate{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type.
+func (t *MicroK8sConfigTemplate) Default() {
+	DefaultMicroK8sConfigSpec(&t.Spec.Template.Spec)
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
+func (t *MicroK8sConfigTemplate) ValidateCreate() error {
+	if allErrs := ValidateMicroK8sConfigSpec(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec")); len(allErrs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("MicroK8sConfigTemplate").GroupKind(), t.Name, allErrs)
+	}
+	return nil
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+// The template is immutable, as changes would not be rolled out to the machines created from it.
+func (t *MicroK8sConfigTemplate) ValidateUpdate(old runtime.Object) error {
+	oldTemplate, ok := old.(*MicroK8sConfigTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a MicroK8sConfigTemplate but got a %T", old))
+	}
+
+	// templates created before defaulting was introduced are compared with their defaulted spec
+	oldSpec := oldTemplate.Spec.Template.Spec.DeepCopy()
+	DefaultMicroK8sConfigSpec(oldSpec)
+	if !reflect.DeepEqual(oldSpec, &t.Spec.Template.Spec) {
+		return apierrors.NewInvalid(GroupVersion.WithKind("MicroK8sConfigTemplate").GroupKind(), t.Name, field.ErrorList{
+			field.Forbidden(field.NewPath("spec", "template", "spec"), "MicroK8sConfigTemplate spec.template.spec field is immutable. Please create a new resource instead."),
+		})
+	}
+	return nil
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+func (t *MicroK8sConfigTemplate) ValidateDelete() error {
+	return nil
+}
@@ -22,13 +22,109 @@ limitations under the License.
 package v1beta1
 
 import (
+	"k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	apiv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Addon) DeepCopyInto(out *Addon) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Addon.
+func (in *Addon) DeepCopy() *Addon {
+	if in == nil {
+		return nil
+	}
+	out := new(Addon)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AddonRepository) DeepCopyInto(out *AddonRepository) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AddonRepository.
+func (in *AddonRepository) DeepCopy() *AddonRepository {
+	if in == nil {
+		return nil
+	}
+	out := new(AddonRepository)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateAuthority) DeepCopyInto(out *CertificateAuthority) {
+	*out = *in
+	if in.Subject != nil {
+		in, out := &in.Subject, &out.Subject
+		*out = new(CertificateSubject)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateAuthority.
+func (in *CertificateAuthority) DeepCopy() *CertificateAuthority {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateAuthority)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateSubject) DeepCopyInto(out *CertificateSubject) {
+	*out = *in
+	if in.Organization != nil {
+		in, out := &in.Organization, &out.Organization
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OrganizationalUnit != nil {
+		in, out := &in.OrganizationalUnit, &out.OrganizationalUnit
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Country != nil {
+		in, out := &in.Country, &out.Country
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Province != nil {
+		in, out := &in.Province, &out.Province
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Locality != nil {
+		in, out := &in.Locality, &out.Locality
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateSubject.
+func (in *CertificateSubject) DeepCopy() *CertificateSubject {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateSubject)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudInitWriteFile) DeepCopyInto(out *CloudInitWriteFile) {
 	*out = *in
+	if in.ContentFrom != nil {
+		in, out := &in.ContentFrom, &out.ContentFrom
+		*out = new(FileSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudInitWriteFile.
@@ -45,6 +141,26 @@ func (in *CloudInitWriteFile) DeepCopy() *CloudInitWriteFile {
 func (in *ClusterConfiguration) DeepCopyInto(out *ClusterConfiguration) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
+	if in.CertSANs != nil {
+		in, out := &in.CertSANs, &out.CertSANs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.JoinAddressTypes != nil {
+		in, out := &in.JoinAddressTypes, &out.JoinAddressTypes
+		*out = make([]apiv1beta1.MachineAddressType, len(*in))
+		copy(*out, *in)
+	}
+	if in.CASecretRef != nil {
+		in, out := &in.CASecretRef, &out.CASecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.CertificateAuthority != nil {
+		in, out := &in.CertificateAuthority, &out.CertificateAuthority
+		*out = new(CertificateAuthority)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterConfiguration.
@@ -65,25 +181,143 @@ func (in *ClusterConfiguration) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileSource) DeepCopyInto(out *FileSource) {
+	*out = *in
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(FileSourceKey)
+		**out = **in
+	}
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(FileSourceKey)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileSource.
+func (in *FileSource) DeepCopy() *FileSource {
+	if in == nil {
+		return nil
+	}
+	out := new(FileSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileSourceKey) DeepCopyInto(out *FileSourceKey) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileSourceKey.
+func (in *FileSourceKey) DeepCopy() *FileSourceKey {
+	if in == nil {
+		return nil
+	}
+	out := new(FileSourceKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InitConfiguration) DeepCopyInto(out *InitConfiguration) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
+	if in.Registries != nil {
+		in, out := &in.Registries, &out.Registries
+		*out = make([]Registry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Addons != nil {
 		in, out := &in.Addons, &out.Addons
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.AddonConfigs != nil {
+		in, out := &in.AddonConfigs, &out.AddonConfigs
+		*out = make([]Addon, len(*in))
+		copy(*out, *in)
+	}
+	if in.AddonRepositories != nil {
+		in, out := &in.AddonRepositories, &out.AddonRepositories
+		*out = make([]AddonRepository, len(*in))
+		copy(*out, *in)
+	}
+	if in.SnapRefresh != nil {
+		in, out := &in.SnapRefresh, &out.SnapRefresh
+		*out = new(SnapRefresh)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Installation != nil {
+		in, out := &in.Installation, &out.Installation
+		*out = new(Installation)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ExtraWriteFiles != nil {
 		in, out := &in.ExtraWriteFiles, &out.ExtraWriteFiles
 		*out = make([]CloudInitWriteFile, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.ExtraKubeletArgs != nil {
 		in, out := &in.ExtraKubeletArgs, &out.ExtraKubeletArgs
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.NodeLabels != nil {
+		in, out := &in.NodeLabels, &out.NodeLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NodeTaints != nil {
+		in, out := &in.NodeTaints, &out.NodeTaints
+		*out = make([]v1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExtraAPIServerArgs != nil {
+		in, out := &in.ExtraAPIServerArgs, &out.ExtraAPIServerArgs
+		*out = new(ServiceArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraControllerManagerArgs != nil {
+		in, out := &in.ExtraControllerManagerArgs, &out.ExtraControllerManagerArgs
+		*out = new(ServiceArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraSchedulerArgs != nil {
+		in, out := &in.ExtraSchedulerArgs, &out.ExtraSchedulerArgs
+		*out = new(ServiceArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraKubeProxyArgs != nil {
+		in, out := &in.ExtraKubeProxyArgs, &out.ExtraKubeProxyArgs
+		*out = new(ServiceArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraContainerdArgs != nil {
+		in, out := &in.ExtraContainerdArgs, &out.ExtraContainerdArgs
+		*out = new(ServiceArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraK8sDqliteArgs != nil {
+		in, out := &in.ExtraK8sDqliteArgs, &out.ExtraK8sDqliteArgs
+		*out = new(ServiceArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraClusterAgentArgs != nil {
+		in, out := &in.ExtraClusterAgentArgs, &out.ExtraClusterAgentArgs
+		*out = new(ServiceArgs)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.BootCommands != nil {
 		in, out := &in.BootCommands, &out.BootCommands
 		*out = make([]string, len(*in))
@@ -119,6 +353,91 @@ func (in *InitConfiguration) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Installation) DeepCopyInto(out *Installation) {
+	*out = *in
+	if in.ImageBundles != nil {
+		in, out := &in.ImageBundles, &out.ImageBundles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Installation.
+func (in *Installation) DeepCopy() *Installation {
+	if in == nil {
+		return nil
+	}
+	out := new(Installation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JoinConfiguration) DeepCopyInto(out *JoinConfiguration) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	if in.ExtraWriteFiles != nil {
+		in, out := &in.ExtraWriteFiles, &out.ExtraWriteFiles
+		*out = make([]CloudInitWriteFile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExtraKubeletArgs != nil {
+		in, out := &in.ExtraKubeletArgs, &out.ExtraKubeletArgs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeLabels != nil {
+		in, out := &in.NodeLabels, &out.NodeLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NodeTaints != nil {
+		in, out := &in.NodeTaints, &out.NodeTaints
+		*out = make([]v1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BootCommands != nil {
+		in, out := &in.BootCommands, &out.BootCommands
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PreRunCommands != nil {
+		in, out := &in.PreRunCommands, &out.PreRunCommands
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PostRunCommands != nil {
+		in, out := &in.PostRunCommands, &out.PostRunCommands
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JoinConfiguration.
+func (in *JoinConfiguration) DeepCopy() *JoinConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(JoinConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *JoinConfiguration) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MicroK8sConfig) DeepCopyInto(out *MicroK8sConfig) {
 	*out = *in
@@ -184,13 +503,18 @@ func (in *MicroK8sConfigSpec) DeepCopyInto(out *MicroK8sConfigSpec) {
 	if in.ClusterConfiguration != nil {
 		in, out := &in.ClusterConfiguration, &out.ClusterConfiguration
 		*out = new(ClusterConfiguration)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.InitConfiguration != nil {
 		in, out := &in.InitConfiguration, &out.InitConfiguration
 		*out = new(InitConfiguration)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.JoinConfiguration != nil {
+		in, out := &in.JoinConfiguration, &out.JoinConfiguration
+		*out = new(JoinConfiguration)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MicroK8sConfigSpec.
@@ -335,3 +659,72 @@ func (in *MicroK8sConfigTemplateStatus) DeepCopy() *MicroK8sConfigTemplateStatus
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Registry) DeepCopyInto(out *Registry) {
+	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Registry.
+func (in *Registry) DeepCopy() *Registry {
+	if in == nil {
+		return nil
+	}
+	out := new(Registry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceArgs) DeepCopyInto(out *ServiceArgs) {
+	*out = *in
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Remove != nil {
+		in, out := &in.Remove, &out.Remove
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceArgs.
+func (in *ServiceArgs) DeepCopy() *ServiceArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapRefresh) DeepCopyInto(out *SnapRefresh) {
+	*out = *in
+	if in.HoldUntil != nil {
+		in, out := &in.HoldUntil, &out.HoldUntil
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapRefresh.
+func (in *SnapRefresh) DeepCopy() *SnapRefresh {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapRefresh)
+	in.DeepCopyInto(out)
+	return out
+}
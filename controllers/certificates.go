@@ -0,0 +1,300 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/cloudinit"
+)
+
+// errInvalidCA is returned when the provided cluster CA cannot be used.
+var errInvalidCA = errors.New("invalid cluster CA")
+
+// getCA returns the cluster CA certificate and key. The CA is read from the secret referenced by
+// caSecretRef if set, otherwise the "<cluster>-ca" secret is used, generating a new CA if needed.
+func (r *MicroK8sConfigReconciler) getCA(ctx context.Context, scope *Scope) (cert *string, key *string, err error) {
+	var caConfig *bootstrapclusterxk8siov1beta1.CertificateAuthority
+	if c := scope.Config.Spec.ClusterConfiguration; c != nil {
+		if c.CASecretRef != nil {
+			return r.getCAFromSecretRef(ctx, scope, c.CASecretRef.Name)
+		}
+		caConfig = c.CertificateAuthority
+	}
+
+	// See if the CA cert exists. If not create it.
+	secrets := &corev1.SecretList{}
+	err = r.Client.List(ctx, secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := false
+	for _, s := range secrets.Items {
+		if s.Name == scope.Cluster.Name+"-ca" {
+			found = true
+		}
+	}
+
+	if !found {
+		commonName, err := cloudinit.KubernetesServiceIP(serviceCIDR(scope.Config))
+		if err != nil {
+			return nil, nil, err
+		}
+		newcrt, newkey, err := generateCA(caConfig, commonName, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+		caSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: scope.Cluster.Namespace,
+				Name:      scope.Cluster.Name + "-ca",
+			},
+			Data: map[string][]byte{
+				"crt": []byte(*newcrt),
+				"key": []byte(*newkey),
+			},
+		}
+		err = r.Client.Create(ctx, caSecret)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	readCASecret := &corev1.Secret{}
+	err = r.Client.Get(ctx,
+		types.NamespacedName{
+			Namespace: scope.Cluster.Namespace,
+			Name:      scope.Cluster.Name + "-ca",
+		},
+		readCASecret,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certstr := string(readCASecret.Data["crt"])
+	keystr := string(readCASecret.Data["key"])
+	if err := validateCA(certstr, keystr, time.Now()); err != nil {
+		return nil, nil, errors.Wrapf(err, "secret %s/%s", readCASecret.Namespace, readCASecret.Name)
+	}
+	return &certstr, &keystr, nil
+}
+
+// getCAFromSecretRef reads and validates a user-supplied CA. The CA is also stored in the "<cluster>-ca"
+// secret, which is where the rest of the cluster lifecycle (e.g. the control plane provider) expects it.
+func (r *MicroK8sConfigReconciler) getCAFromSecretRef(ctx context.Context, scope *Scope, name string) (cert *string, key *string, err error) {
+	refSecret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: scope.Config.Namespace, Name: name}, refSecret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil, errors.Wrapf(errInvalidCA, "secret %s/%s referenced by caSecretRef not found", scope.Config.Namespace, name)
+		}
+		return nil, nil, err
+	}
+
+	certstr, keystr := string(refSecret.Data[corev1.TLSCertKey]), string(refSecret.Data[corev1.TLSPrivateKeyKey])
+	if certstr == "" && keystr == "" {
+		certstr, keystr = string(refSecret.Data["crt"]), string(refSecret.Data["key"])
+	}
+	if err := validateCA(certstr, keystr, time.Now()); err != nil {
+		return nil, nil, errors.Wrapf(err, "secret %s/%s referenced by caSecretRef", refSecret.Namespace, refSecret.Name)
+	}
+
+	caSecret := &corev1.Secret{}
+	err = r.Client.Get(ctx, types.NamespacedName{Namespace: scope.Cluster.Namespace, Name: scope.Cluster.Name + "-ca"}, caSecret)
+	switch {
+	case apierrors.IsNotFound(err):
+		caSecret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: scope.Cluster.Namespace,
+				Name:      scope.Cluster.Name + "-ca",
+			},
+			Data: map[string][]byte{
+				"crt": []byte(certstr),
+				"key": []byte(keystr),
+			},
+		}
+		if err := r.Client.Create(ctx, caSecret); err != nil {
+			return nil, nil, err
+		}
+	case err != nil:
+		return nil, nil, err
+	case string(caSecret.Data["crt"]) != certstr || string(caSecret.Data["key"]) != keystr:
+		if caSecret.Data == nil {
+			caSecret.Data = map[string][]byte{}
+		}
+		caSecret.Data["crt"] = []byte(certstr)
+		caSecret.Data["key"] = []byte(keystr)
+		if err := r.Client.Update(ctx, caSecret); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &certstr, &keystr, nil
+}
+
+// validateCA checks that the PEM-encoded certificate and key form a key pair, and that the certificate
+// is a CA certificate that is valid at the given time.
+func validateCA(certPEM string, keyPEM string, now time.Time) error {
+	if certPEM == "" || keyPEM == "" {
+		return errors.Wrap(errInvalidCA, "certificate or private key is missing")
+	}
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return errors.Wrapf(errInvalidCA, "certificate and private key are not a valid key pair: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return errors.Wrapf(errInvalidCA, "failed to parse certificate: %v", err)
+	}
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		return errors.Wrapf(errInvalidCA, "certificate %q is not a CA certificate", cert.Subject.CommonName)
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return errors.Wrapf(errInvalidCA, "certificate %q cannot be used to sign certificates", cert.Subject.CommonName)
+	}
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return errors.Wrapf(errInvalidCA, "certificate %q is only valid between %s and %s", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// generateCA creates a self-signed CA. A nil config generates the default MicroK8s CA, with the IP of the
+// kubernetes service as the common name.
+func generateCA(config *bootstrapclusterxk8siov1beta1.CertificateAuthority, commonName string, now time.Time) (cert *string, key *string, err error) {
+	if config == nil {
+		config = &bootstrapclusterxk8siov1beta1.CertificateAuthority{}
+	}
+
+	subject := pkix.Name{
+		Organization:  []string{"Canonical"},
+		Country:       []string{"GB"},
+		Province:      []string{""},
+		Locality:      []string{"Canonical"},
+		StreetAddress: []string{"Canonical"},
+		CommonName:    commonName,
+	}
+	if s := config.Subject; s != nil {
+		subject = pkix.Name{
+			CommonName:         s.CommonName,
+			Organization:       s.Organization,
+			OrganizationalUnit: s.OrganizationalUnit,
+			Country:            s.Country,
+			Province:           s.Province,
+			Locality:           s.Locality,
+		}
+	}
+
+	notAfter := now.AddDate(10, 0, 0)
+	if config.ValidityInDays > 0 {
+		notAfter = now.AddDate(0, 0, int(config.ValidityInDays))
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// set up our CA certificate
+	ca := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		NotBefore:             now,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	// create our private and public key
+	var (
+		caPrivKey    crypto.Signer
+		caPrivKeyPEM *pem.Block
+	)
+	switch config.KeyAlgorithm {
+	case "", bootstrapclusterxk8siov1beta1.KeyAlgorithmRSA2048, bootstrapclusterxk8siov1beta1.KeyAlgorithmRSA4096:
+		bits := 2048
+		if config.KeyAlgorithm == bootstrapclusterxk8siov1beta1.KeyAlgorithmRSA4096 {
+			bits = 4096
+		}
+		rsaKey, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		caPrivKey = rsaKey
+		caPrivKeyPEM = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}
+	case bootstrapclusterxk8siov1beta1.KeyAlgorithmECDSAP256:
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := x509.MarshalECPrivateKey(ecKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		caPrivKey = ecKey
+		caPrivKeyPEM = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
+	default:
+		return nil, nil, fmt.Errorf("unsupported key algorithm %q", config.KeyAlgorithm)
+	}
+
+	// create the CA
+	caBytes, err := x509.CreateCertificate(rand.Reader, ca, ca, caPrivKey.Public(), caPrivKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// pem encode
+	caPEM := new(bytes.Buffer)
+	err = pem.Encode(caPEM, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: caBytes,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	caPrivKeyPEMBuffer := new(bytes.Buffer)
+	if err := pem.Encode(caPrivKeyPEMBuffer, caPrivKeyPEM); err != nil {
+		return nil, nil, err
+	}
+
+	certstr := caPEM.String()
+	keystr := caPrivKeyPEMBuffer.String()
+	return &certstr, &keystr, nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"fmt"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+// Addon is a MicroK8s addon to enable.
+type Addon struct {
+	// Name is the name of the addon.
+	Name string
+	// Arguments are the arguments of the addon.
+	Arguments string
+	// Repository is the addon repository that provides the addon.
+	Repository string
+	// TimeoutSeconds is the time to wait for the addon to be enabled. No timeout is used if zero.
+	TimeoutSeconds int32
+}
+
+// AddonRepository is a MicroK8s addon repository.
+type AddonRepository struct {
+	// Name is the name of the addon repository.
+	Name string
+	// Repository is the URL of the git repository or the local path that holds the addons.
+	Repository string
+	// Reference is the git branch or tag to check out.
+	Reference string
+}
+
+// AddonRepositoriesFromAPI returns the addon repositories to add.
+func AddonRepositoriesFromAPI(repositories []bootstrapclusterxk8siov1beta1.AddonRepository) []AddonRepository {
+	if len(repositories) == 0 {
+		return nil
+	}
+	result := make([]AddonRepository, 0, len(repositories))
+	for _, r := range repositories {
+		result = append(result, AddonRepository{Name: r.Name, Repository: r.Repository, Reference: r.Reference})
+	}
+	return result
+}
+
+// AddonsFromAPI returns the addons to enable from the deprecated list of addon strings and the list of addon configs.
+func AddonsFromAPI(addons []string, addonConfigs []bootstrapclusterxk8siov1beta1.Addon) []Addon {
+	if len(addons)+len(addonConfigs) == 0 {
+		return nil
+	}
+	result := make([]Addon, 0, len(addons)+len(addonConfigs))
+	for _, s := range addons {
+		addon := bootstrapclusterxk8siov1beta1.AddonFromString(s)
+		result = append(result, Addon{Name: addon.Name, Arguments: addon.Arguments, Repository: addon.Repository})
+	}
+	for _, addon := range addonConfigs {
+		result = append(result, Addon{
+			Name:           addon.Name,
+			Arguments:      addon.Arguments,
+			Repository:     addon.Repository,
+			TimeoutSeconds: addon.TimeoutSeconds,
+		})
+	}
+	return result
+}
+
+// addAddonRepositoriesCommands returns the commands that add the addon repositories.
+func addAddonRepositoriesCommands(repositories []AddonRepository) ([]string, error) {
+	commands := make([]string, 0, len(repositories))
+	for _, r := range repositories {
+		if !bootstrapclusterxk8siov1beta1.IsAddonName(r.Name) {
+			return nil, fmt.Errorf("addon repository name %q is invalid", r.Name)
+		}
+		if !bootstrapclusterxk8siov1beta1.IsAddonRepositoryURL(r.Repository) {
+			return nil, fmt.Errorf("repository %q of addon repository %q is invalid", r.Repository, r.Name)
+		}
+		if !bootstrapclusterxk8siov1beta1.IsGitReference(r.Reference) {
+			return nil, fmt.Errorf("reference %q of addon repository %q is invalid", r.Reference, r.Name)
+		}
+		commands = append(commands, fmt.Sprintf("%s %q %q %q", scriptPath(microk8sAddAddonRepositoryScript), r.Name, r.Repository, r.Reference))
+	}
+	return commands, nil
+}
+
+// enableAddonsArgs returns the quoted arguments of the enable addons script for the addons.
+// The dns addon is enabled last, unless it is part of the addons or disableDefaultDNS is set.
+func enableAddonsArgs(addons []Addon, disableDefaultDNS bool, disableCommunityAddons bool) ([]string, error) {
+	hasDNSAddon := false
+	seen := make(map[string]struct{}, len(addons))
+	args := make([]string, 0, len(addons)+2)
+	if disableCommunityAddons {
+		args = append(args, fmt.Sprintf("%q", "--skip-community"))
+	}
+	for _, addon := range addons {
+		if !bootstrapclusterxk8siov1beta1.IsAddonName(addon.Name) {
+			return nil, fmt.Errorf("addon name %q is invalid", addon.Name)
+		}
+		if addon.Repository != "" && !bootstrapclusterxk8siov1beta1.IsAddonName(addon.Repository) {
+			return nil, fmt.Errorf("addon repository %q of addon %q is invalid", addon.Repository, addon.Name)
+		}
+		if !bootstrapclusterxk8siov1beta1.IsAddonArguments(addon.Arguments) {
+			return nil, fmt.Errorf("arguments %q of addon %q are invalid", addon.Arguments, addon.Name)
+		}
+		if disableCommunityAddons && addon.Repository == "community" {
+			return nil, fmt.Errorf("addon %q cannot be enabled from the community repository, it is disabled", addon.Name)
+		}
+		if addon.TimeoutSeconds < 0 {
+			return nil, fmt.Errorf("timeout %d of addon %q is not a positive number", addon.TimeoutSeconds, addon.Name)
+		}
+		if _, ok := seen[addon.Name]; ok {
+			return nil, fmt.Errorf("addon %q is enabled more than once", addon.Name)
+		}
+		seen[addon.Name] = struct{}{}
+		if addon.Name == "dns" {
+			hasDNSAddon = true
+		}
+
+		if addon.TimeoutSeconds > 0 {
+			args = append(args, fmt.Sprintf("%q", fmt.Sprintf("--timeout=%d", addon.TimeoutSeconds)))
+		}
+		name := addon.Name
+		if addon.Repository != "" {
+			name = addon.Repository + "/" + name
+		}
+		if addon.Arguments != "" {
+			name = name + ":" + addon.Arguments
+		}
+		args = append(args, fmt.Sprintf("%q", name))
+	}
+	if !hasDNSAddon && !disableDefaultDNS {
+		args = append(args, fmt.Sprintf("%q", "dns"))
+	}
+	return args, nil
+}
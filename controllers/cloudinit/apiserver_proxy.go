@@ -0,0 +1,134 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Modes of the apiserver proxy of the worker nodes.
+const (
+	// APIServerProxyLB proxies to the control plane endpoint, usually a load balancer.
+	APIServerProxyLB = "lb"
+	// APIServerProxyAllControlPlanes proxies to all discovered control plane nodes.
+	APIServerProxyAllControlPlanes = "all-control-planes"
+	// APIServerProxyBoth proxies to all discovered control plane nodes and the control plane endpoint.
+	APIServerProxyBoth = "both"
+)
+
+// apiServerProxyProviderPath is where the apiserver proxy configuration of a worker is staged. It replaces
+// /var/snap/microk8s/current/args/traefik/provider.yaml after the node has joined the cluster.
+var apiServerProxyProviderPath = filepath.Join("/var", "tmp", "apiserver-proxy-provider.yaml")
+
+// apiServerProxyProvider is the traefik file provider configuration that the apiserver proxy of the worker
+// nodes reads the kube-apiserver addresses from.
+type apiServerProxyProvider struct {
+	TCP struct {
+		Routers  map[string]apiServerProxyRouter  `yaml:"routers"`
+		Services map[string]apiServerProxyService `yaml:"services"`
+	} `yaml:"tcp"`
+}
+
+type apiServerProxyRouter struct {
+	Rule    string `yaml:"rule"`
+	Service string `yaml:"service"`
+	TLS     struct {
+		Passthrough bool `yaml:"passthrough"`
+	} `yaml:"tls"`
+}
+
+type apiServerProxyService struct {
+	LoadBalancer struct {
+		Servers []apiServerProxyServer `yaml:"servers"`
+	} `yaml:"loadBalancer"`
+}
+
+type apiServerProxyServer struct {
+	Address string `yaml:"address"`
+}
+
+// apiServerProxyAddresses returns the kube-apiserver addresses that the apiserver proxy of a worker uses.
+func apiServerProxyAddresses(mode string, controlPlaneEndpoint string, apiServerPort string, controlPlaneIPs []string) ([]string, error) {
+	var addresses []string
+	switch mode {
+	case "", APIServerProxyLB:
+		return []string{net.JoinHostPort(controlPlaneEndpoint, apiServerPort)}, nil
+	case APIServerProxyAllControlPlanes, APIServerProxyBoth:
+		for _, ip := range controlPlaneIPs {
+			addresses = append(addresses, net.JoinHostPort(ip, apiServerPort))
+		}
+		if mode == APIServerProxyBoth {
+			addresses = append(addresses, net.JoinHostPort(controlPlaneEndpoint, apiServerPort))
+		}
+	default:
+		return nil, fmt.Errorf("apiserver proxy mode %q must be one of %q, %q or %q", mode, APIServerProxyLB, APIServerProxyAllControlPlanes, APIServerProxyBoth)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("apiserver proxy mode %q requires the addresses of the control plane nodes", mode)
+	}
+	return addresses, nil
+}
+
+// renderAPIServerProxyProvider renders the apiserver proxy configuration for the given kube-apiserver addresses.
+func renderAPIServerProxyProvider(addresses []string) (string, error) {
+	router := apiServerProxyRouter{Rule: "HostSNI(`*`)", Service: "kube-apiserver"}
+	router.TLS.Passthrough = true
+	var service apiServerProxyService
+	for _, address := range addresses {
+		service.LoadBalancer.Servers = append(service.LoadBalancer.Servers, apiServerProxyServer{Address: address})
+	}
+
+	var provider apiServerProxyProvider
+	provider.TCP.Routers = map[string]apiServerProxyRouter{"Router-1": router}
+	provider.TCP.Services = map[string]apiServerProxyService{"kube-apiserver": service}
+
+	b, err := yaml.Marshal(provider)
+	if err != nil {
+		return "", fmt.Errorf("failed to render apiserver proxy configuration: %w", err)
+	}
+	return string(b), nil
+}
+
+// configureAPIServerProxy returns the files and commands that point the apiserver proxy of a worker to the
+// kube-apiserver addresses of the given mode. stopRefreshes stops the apiserver proxy from replacing the
+// addresses with those of the control plane nodes it discovers, which is only supported on 1.25+.
+func configureAPIServerProxy(mode string, controlPlaneEndpoint string, apiServerPort string, controlPlaneIPs []string, stopRefreshes bool) ([]File, []string, error) {
+	addresses, err := apiServerProxyAddresses(mode, controlPlaneEndpoint, apiServerPort, controlPlaneIPs)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, err := renderAPIServerProxyProvider(addresses)
+	if err != nil {
+		return nil, nil, err
+	}
+	stopRefreshesArg := "no"
+	if stopRefreshes {
+		stopRefreshesArg = "yes"
+	}
+	return []File{{
+		Content:     provider,
+		Path:        apiServerProxyProviderPath,
+		Permissions: "0644",
+		Owner:       "root:root",
+	}}, []string{
+		fmt.Sprintf("%s %s", scriptPath(configureTraefikScript), stopRefreshesArg),
+	}, nil
+}
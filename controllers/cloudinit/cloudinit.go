@@ -20,6 +20,8 @@ import (
 	"bytes"
 	"fmt"
 	"text/template"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
 )
 
 // File is a file that cloud-init will create.
@@ -32,6 +34,8 @@ type File struct {
 	Permissions string `yaml:"permissions"`
 	// Owner of the file to create, e.g. "root:root"
 	Owner string `yaml:"owner"`
+	// Encoding of the content, "base64" or "gzip+base64". The content is written as-is if empty.
+	Encoding string `yaml:"encoding,omitempty"`
 }
 
 // CloudConfig is cloud-init userdata. The schema matches the examples found in
@@ -58,6 +62,18 @@ func GenerateCloudConfig(config *CloudConfig) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// GenerateBootstrapData renders a CloudConfig in the requested bootstrap data format.
+func GenerateBootstrapData(format bootstrapclusterxk8siov1beta1.Format, config *CloudConfig) ([]byte, error) {
+	switch format {
+	case "", bootstrapclusterxk8siov1beta1.FormatCloudConfig:
+		return GenerateCloudConfig(config)
+	case bootstrapclusterxk8siov1beta1.FormatIgnition:
+		return GenerateIgnition(config)
+	default:
+		return nil, fmt.Errorf("unknown bootstrap data format %q", format)
+	}
+}
+
 func NewBaseCloudConfig() *CloudConfig {
 	writeFiles := make([]File, 0, len(allScripts))
 	for _, script := range allScripts {
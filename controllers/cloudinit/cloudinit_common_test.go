@@ -20,10 +20,12 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
 	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/cloudinit"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestCloudConfigInput(t *testing.T) {
@@ -99,6 +101,12 @@ func TestCloudConfigInput(t *testing.T) {
 			Path:        "/tmp/path",
 			Permissions: "0644",
 			Owner:       "root:root",
+		}, {
+			Content:     "H4sIAAAAAAAA/ypJLS4BAAAA//8DAAx+f9gEAAAA",
+			Encoding:    v1beta1.GzipBase64,
+			Path:        "/tmp/encoded",
+			Permissions: "0600",
+			Owner:       "root:root",
 		}}
 		for _, tc := range []struct {
 			name            string
@@ -142,15 +150,22 @@ func TestCloudConfigInput(t *testing.T) {
 				c, err := tc.makeCloudConfig()
 				g.Expect(err).NotTo(HaveOccurred())
 
-				g.Expect(c.WriteFiles).To(ContainElement(cloudinit.File{
+				g.Expect(c.WriteFiles).To(ContainElements(cloudinit.File{
 					Content:     "contents",
 					Path:        "/tmp/path",
 					Permissions: "0644",
 					Owner:       "root:root",
+				}, cloudinit.File{
+					Content:     "H4sIAAAAAAAA/ypJLS4BAAAA//8DAAx+f9gEAAAA",
+					Path:        "/tmp/encoded",
+					Permissions: "0600",
+					Owner:       "root:root",
+					Encoding:    "gzip+base64",
 				}))
 
-				_, err = cloudinit.GenerateCloudConfig(c)
+				b, err := cloudinit.GenerateCloudConfig(c)
 				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(string(b)).To(ContainSubstring("encoding: gzip+base64"))
 			})
 		}
 	})
@@ -382,4 +397,835 @@ func TestCloudConfigInput(t *testing.T) {
 			})
 		}
 	})
+	t.Run("Installation", func(t *testing.T) {
+		for _, tc := range []struct {
+			name            string
+			makeCloudConfig func(confinement string, installation cloudinit.Installation) (*cloudinit.CloudConfig, error)
+		}{
+			{
+				name: "ControlPlaneInit",
+				makeCloudConfig: func(confinement string, installation cloudinit.Installation) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+						KubernetesVersion: "v1.25.0",
+						Confinement:       confinement,
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						Installation:      installation,
+					})
+				},
+			},
+			{
+				name: "ControlPlaneJoin",
+				makeCloudConfig: func(confinement string, installation cloudinit.Installation) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+						KubernetesVersion: "v1.25.0",
+						Confinement:       confinement,
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						Installation:      installation,
+					})
+				},
+			},
+			{
+				name: "Worker",
+				makeCloudConfig: func(confinement string, installation cloudinit.Installation) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+						KubernetesVersion: "v1.25.0",
+						Confinement:       confinement,
+						Token:             strings.Repeat("a", 32),
+						Installation:      installation,
+					})
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Run("SnapFile", func(t *testing.T) {
+					g := NewWithT(t)
+					c, err := tc.makeCloudConfig("classic", cloudinit.Installation{Snap: "/opt/microk8s.snap", Assertion: "/opt/microk8s.assert"})
+					g.Expect(err).NotTo(HaveOccurred())
+
+					g.Expect(c.RunCommands).To(ContainElement(`/capi-scripts/00-install-microk8s-snap.sh "/opt/microk8s.snap" "/opt/microk8s.assert" "--classic"`))
+					g.Expect(c.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/00-install-microk8s.sh")))
+					g.Expect(c.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/10-import-images.sh")))
+					g.Expect(c.RunCommands).NotTo(ContainElement("/capi-scripts/20-publish-snap-revision.sh"))
+				})
+
+				t.Run("SnapURLStrict", func(t *testing.T) {
+					g := NewWithT(t)
+					c, err := tc.makeCloudConfig("strict", cloudinit.Installation{Snap: "https://files.example.com/microk8s.snap"})
+					g.Expect(err).NotTo(HaveOccurred())
+
+					g.Expect(c.RunCommands).To(ContainElement(`/capi-scripts/00-install-microk8s-snap.sh "https://files.example.com/microk8s.snap" "" ""`))
+				})
+
+				t.Run("ImageBundles", func(t *testing.T) {
+					g := NewWithT(t)
+					c, err := tc.makeCloudConfig("classic", cloudinit.Installation{ImageBundles: []string{"/opt/images.tar", "http://files.example.com/addons.tar"}})
+					g.Expect(err).NotTo(HaveOccurred())
+
+					g.Expect(c.RunCommands).To(ContainElements(
+						`/capi-scripts/00-install-microk8s.sh "--channel 1.25 --classic"`,
+						`/capi-scripts/10-import-images.sh "/opt/images.tar" "http://files.example.com/addons.tar"`,
+					))
+				})
+
+				t.Run("Invalid", func(t *testing.T) {
+					g := NewWithT(t)
+					_, err := tc.makeCloudConfig("classic", cloudinit.Installation{Snap: "microk8s.snap"})
+					g.Expect(err).To(HaveOccurred())
+					_, err = tc.makeCloudConfig("classic", cloudinit.Installation{Assertion: "/opt/microk8s.assert"})
+					g.Expect(err).To(HaveOccurred())
+					_, err = tc.makeCloudConfig("classic", cloudinit.Installation{ImageBundles: []string{"/opt/$(reboot).tar"}})
+					g.Expect(err).To(HaveOccurred())
+				})
+			})
+		}
+	})
+	t.Run("SnapRevision", func(t *testing.T) {
+		for _, tc := range []struct {
+			name            string
+			makeCloudConfig func(snapRevision int64, installation cloudinit.Installation) (*cloudinit.CloudConfig, error)
+		}{
+			{
+				name: "ControlPlaneInit",
+				makeCloudConfig: func(snapRevision int64, installation cloudinit.Installation) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+						KubernetesVersion: "v1.25.0",
+						RiskLevel:         "stable",
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						SnapRevision:      snapRevision,
+						Installation:      installation,
+					})
+				},
+			},
+			{
+				name: "ControlPlaneJoin",
+				makeCloudConfig: func(snapRevision int64, installation cloudinit.Installation) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+						KubernetesVersion: "v1.25.0",
+						RiskLevel:         "stable",
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						SnapRevision:      snapRevision,
+						Installation:      installation,
+					})
+				},
+			},
+			{
+				name: "Worker",
+				makeCloudConfig: func(snapRevision int64, installation cloudinit.Installation) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+						KubernetesVersion: "v1.25.0",
+						RiskLevel:         "stable",
+						Token:             strings.Repeat("a", 32),
+						SnapRevision:      snapRevision,
+						Installation:      installation,
+					})
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+				c, err := tc.makeCloudConfig(4094, cloudinit.Installation{})
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(c.RunCommands).To(ContainElement(`/capi-scripts/00-install-microk8s.sh "--channel 1.25/stable --classic --revision 4094"`))
+
+				_, err = tc.makeCloudConfig(4094, cloudinit.Installation{Snap: "/opt/microk8s.snap"})
+				g.Expect(err).To(HaveOccurred())
+			})
+		}
+	})
+	t.Run("SnapRefresh", func(t *testing.T) {
+		for _, tc := range []struct {
+			name            string
+			makeCloudConfig func(snapRefresh cloudinit.SnapRefresh) (*cloudinit.CloudConfig, error)
+		}{
+			{
+				name: "ControlPlaneInit",
+				makeCloudConfig: func(snapRefresh cloudinit.SnapRefresh) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+						KubernetesVersion: "v1.25.0",
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						SnapRefresh:       snapRefresh,
+					})
+				},
+			},
+			{
+				name: "ControlPlaneJoin",
+				makeCloudConfig: func(snapRefresh cloudinit.SnapRefresh) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+						KubernetesVersion: "v1.25.0",
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						SnapRefresh:       snapRefresh,
+					})
+				},
+			},
+			{
+				name: "Worker",
+				makeCloudConfig: func(snapRefresh cloudinit.SnapRefresh) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+						KubernetesVersion: "v1.25.0",
+						Token:             strings.Repeat("a", 32),
+						SnapRefresh:       snapRefresh,
+					})
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				c, err := tc.makeCloudConfig(cloudinit.SnapRefresh{})
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(c.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/00-configure-snap-refresh.sh")))
+
+				c, err = tc.makeCloudConfig(cloudinit.SnapRefresh{Hold: "2023-01-01T00:00:00Z", Timer: "sat,02:00-04:00"})
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(c.RunCommands).To(ContainElement(`/capi-scripts/00-configure-snap-refresh.sh "2023-01-01T00:00:00Z" "sat,02:00-04:00"`))
+
+				// refreshes are configured before installing MicroK8s
+				var refreshIdx, installIdx int
+				for i, cmd := range c.RunCommands {
+					switch {
+					case strings.HasPrefix(cmd, "/capi-scripts/00-configure-snap-refresh.sh"):
+						refreshIdx = i
+					case strings.HasPrefix(cmd, "/capi-scripts/00-install-microk8s.sh"):
+						installIdx = i
+					}
+				}
+				g.Expect(refreshIdx).To(BeNumerically("<", installIdx))
+
+				_, err = tc.makeCloudConfig(cloudinit.SnapRefresh{Timer: "$(reboot)"})
+				g.Expect(err).To(HaveOccurred())
+			})
+		}
+	})
+	t.Run("NativeAPIServerPort", func(t *testing.T) {
+		packageOrFirewallCommand := `(^|[\s;&|])(apt|apt-get|dpkg|iptables)\s`
+		for _, tc := range []struct {
+			name            string
+			makeCloudConfig func(kubernetesVersion string, native bool) (*cloudinit.CloudConfig, error)
+		}{
+			{
+				name: "ControlPlaneInit",
+				makeCloudConfig: func(kubernetesVersion string, native bool) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+						KubernetesVersion:   kubernetesVersion,
+						Token:               strings.Repeat("a", 32),
+						TokenTTL:            100,
+						APIServerPort:       "6443",
+						NativeAPIServerPort: native,
+					})
+				},
+			},
+			{
+				name: "ControlPlaneJoin",
+				makeCloudConfig: func(kubernetesVersion string, native bool) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+						KubernetesVersion:   kubernetesVersion,
+						Token:               strings.Repeat("a", 32),
+						TokenTTL:            100,
+						APIServerPort:       "6443",
+						NativeAPIServerPort: native,
+					})
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Run("Scripts", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.25.0", false)
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.RunCommands).To(ContainElement(`/capi-scripts/10-configure-apiserver.sh "6443"`))
+					g.Expect(executedLines(c)).To(ContainElement(MatchRegexp(packageOrFirewallCommand)))
+
+					c, err = tc.makeCloudConfig("v1.25.0", true)
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.RunCommands).To(ContainElement(`/capi-scripts/10-configure-apiserver-native.sh "6443"`))
+					g.Expect(c.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/10-configure-apiserver.sh")))
+					for _, line := range executedLines(c) {
+						g.Expect(line).NotTo(MatchRegexp(packageOrFirewallCommand))
+					}
+				})
+
+				t.Run("LaunchConfiguration", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.27.1", false)
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.RunCommands).To(ContainElement(`/capi-scripts/10-configure-apiserver.sh "6443"`))
+					g.Expect(c.WriteFiles).To(ContainElement(And(
+						HaveField("Path", "/var/snap/microk8s/common/.microk8s.yaml"),
+						HaveField("Content", Not(ContainSubstring("--secure-port"))),
+					)))
+
+					c, err = tc.makeCloudConfig("v1.27.1", true)
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/10-configure-apiserver")))
+					g.Expect(c.WriteFiles).To(ContainElement(And(
+						HaveField("Path", "/var/snap/microk8s/common/.microk8s.yaml"),
+						HaveField("Content", ContainSubstring(`--secure-port: "6443"`)),
+					)))
+					for _, line := range executedLines(c) {
+						g.Expect(line).NotTo(MatchRegexp(packageOrFirewallCommand))
+					}
+				})
+			})
+		}
+	})
+	t.Run("LaunchConfiguration", func(t *testing.T) {
+		for _, tc := range []struct {
+			name            string
+			controlPlane    bool
+			makeCloudConfig func(kubernetesVersion string) (*cloudinit.CloudConfig, error)
+		}{
+			{
+				name:         "ControlPlaneInit",
+				controlPlane: true,
+				makeCloudConfig: func(kubernetesVersion string) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+						KubernetesVersion:   kubernetesVersion,
+						Token:               strings.Repeat("a", 32),
+						TokenTTL:            100,
+						ExtraKubeletArgs:    []string{"--max-pods=250", "--fail-swap-on"},
+						ContainerdHTTPProxy: "http://proxy:3128",
+						ContainerdNoProxy:   "10.0.0.0/8",
+					})
+				},
+			},
+			{
+				name:         "ControlPlaneJoin",
+				controlPlane: true,
+				makeCloudConfig: func(kubernetesVersion string) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+						KubernetesVersion:   kubernetesVersion,
+						Token:               strings.Repeat("a", 32),
+						TokenTTL:            100,
+						ExtraKubeletArgs:    []string{"--max-pods=250", "--fail-swap-on"},
+						ContainerdHTTPProxy: "http://proxy:3128",
+						ContainerdNoProxy:   "10.0.0.0/8",
+					})
+				},
+			},
+			{
+				name: "Worker",
+				makeCloudConfig: func(kubernetesVersion string) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+						KubernetesVersion:   kubernetesVersion,
+						Token:               strings.Repeat("a", 32),
+						ExtraKubeletArgs:    []string{"--max-pods=250", "--fail-swap-on"},
+						ContainerdHTTPProxy: "http://proxy:3128",
+						ContainerdNoProxy:   "10.0.0.0/8",
+					})
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Run("Scripts", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.26.3")
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.WriteFiles).To(ContainElement(HaveField("Path", "/var/tmp/extra-kubelet-args")))
+					g.Expect(c.WriteFiles).NotTo(ContainElement(HaveField("Path", "/var/snap/microk8s/common/.microk8s.yaml")))
+					g.Expect(c.RunCommands).To(ContainElements(
+						`/capi-scripts/10-configure-containerd-proxy.sh "http://proxy:3128" "" "10.0.0.0/8"`,
+						"/capi-scripts/10-configure-kubelet.sh",
+					))
+				})
+
+				t.Run("LaunchConfiguration", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.27.1")
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.WriteFiles).NotTo(ContainElement(HaveField("Path", "/var/tmp/extra-kubelet-args")))
+					g.Expect(c.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/10-configure-containerd-proxy.sh")))
+					g.Expect(c.RunCommands).NotTo(ContainElement("/capi-scripts/10-configure-kubelet.sh"))
+
+					var launchConfig string
+					for _, f := range c.WriteFiles {
+						if f.Path == "/var/snap/microk8s/common/.microk8s.yaml" {
+							launchConfig = f.Content
+						}
+					}
+					expected := `version: 0.1.0
+extraKubeletArgs:
+  --fail-swap-on: "true"
+  --max-pods: "250"
+`
+					if tc.controlPlane {
+						expected += `extraKubeAPIServerArgs:
+  --service-node-port-range: 30001-32767
+`
+					}
+					expected += `extraContainerdEnv:
+  HTTP_PROXY: http://proxy:3128
+  NO_PROXY: 10.0.0.0/8
+  http_proxy: http://proxy:3128
+  no_proxy: 10.0.0.0/8
+`
+					g.Expect(launchConfig).To(Equal(expected))
+				})
+			})
+		}
+	})
+	t.Run("ServiceArgs", func(t *testing.T) {
+		for _, tc := range []struct {
+			name            string
+			makeCloudConfig func(kubernetesVersion string, serviceArgs map[string]cloudinit.ServiceArgs) (*cloudinit.CloudConfig, error)
+		}{
+			{
+				name: "ControlPlaneInit",
+				makeCloudConfig: func(kubernetesVersion string, serviceArgs map[string]cloudinit.ServiceArgs) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+						KubernetesVersion: kubernetesVersion,
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						ExtraServiceArgs:  serviceArgs,
+					})
+				},
+			},
+			{
+				name: "ControlPlaneJoin",
+				makeCloudConfig: func(kubernetesVersion string, serviceArgs map[string]cloudinit.ServiceArgs) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+						KubernetesVersion: kubernetesVersion,
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						ExtraServiceArgs:  serviceArgs,
+					})
+				},
+			},
+			{
+				name: "Worker",
+				makeCloudConfig: func(kubernetesVersion string, serviceArgs map[string]cloudinit.ServiceArgs) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+						KubernetesVersion: kubernetesVersion,
+						Token:             strings.Repeat("a", 32),
+						ExtraServiceArgs:  serviceArgs,
+					})
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				serviceArgs := map[string]cloudinit.ServiceArgs{
+					cloudinit.SchedulerService:    {Args: []string{"--profiling=false"}, Remove: []string{"--leader-elect-lease-duration"}},
+					cloudinit.ClusterAgentService: {Remove: []string{"--min-tls-version"}},
+				}
+
+				t.Run("Scripts", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.26.3", nil)
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/10-configure-service-args.sh")))
+
+					c, err = tc.makeCloudConfig("v1.26.3", serviceArgs)
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.RunCommands).To(ContainElement("/capi-scripts/10-configure-service-args.sh cluster-agent kube-scheduler"))
+					g.Expect(c.WriteFiles).To(ContainElements(
+						cloudinit.File{Content: "--min-tls-version\n", Path: "/var/tmp/service-args/cluster-agent.remove", Permissions: "0400", Owner: "root:root"},
+						cloudinit.File{Content: "--profiling=false\n", Path: "/var/tmp/service-args/kube-scheduler", Permissions: "0400", Owner: "root:root"},
+						cloudinit.File{Content: "--leader-elect-lease-duration\n", Path: "/var/tmp/service-args/kube-scheduler.remove", Permissions: "0400", Owner: "root:root"},
+					))
+					g.Expect(c.WriteFiles).NotTo(ContainElement(HaveField("Path", "/var/tmp/service-args/cluster-agent")))
+				})
+
+				t.Run("LaunchConfiguration", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.27.1", serviceArgs)
+					g.Expect(err).NotTo(HaveOccurred())
+
+					// the cluster agent is not covered by the launch configuration
+					g.Expect(c.RunCommands).To(ContainElement("/capi-scripts/10-configure-service-args.sh cluster-agent"))
+					g.Expect(c.WriteFiles).NotTo(ContainElement(HaveField("Path", "/var/tmp/service-args/kube-scheduler")))
+					g.Expect(c.WriteFiles).To(ContainElement(SatisfyAll(
+						HaveField("Path", "/var/snap/microk8s/common/.microk8s.yaml"),
+						HaveField("Content", ContainSubstring(`extraKubeSchedulerArgs:
+  --leader-elect-lease-duration: null
+  --profiling: "false"
+`)),
+					)))
+				})
+
+				t.Run("Invalid", func(t *testing.T) {
+					g := NewWithT(t)
+
+					_, err := tc.makeCloudConfig("v1.26.3", map[string]cloudinit.ServiceArgs{cloudinit.APIServerService: {Args: []string{"profiling=false"}}})
+					g.Expect(err).To(HaveOccurred())
+					_, err = tc.makeCloudConfig("v1.27.1", map[string]cloudinit.ServiceArgs{cloudinit.APIServerService: {Remove: []string{"--profiling\nreboot"}}})
+					g.Expect(err).To(HaveOccurred())
+				})
+			})
+		}
+	})
+
+	t.Run("NodeLabelsAndTaints", func(t *testing.T) {
+		for _, tc := range []struct {
+			name            string
+			makeCloudConfig func(kubernetesVersion string, labels map[string]string, taints []cloudinit.Taint) (*cloudinit.CloudConfig, error)
+		}{
+			{
+				name: "ControlPlaneInit",
+				makeCloudConfig: func(kubernetesVersion string, labels map[string]string, taints []cloudinit.Taint) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+						KubernetesVersion: kubernetesVersion,
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						ExtraKubeletArgs:  []string{"--max-pods=250"},
+						NodeLabels:        labels,
+						NodeTaints:        taints,
+					})
+				},
+			},
+			{
+				name: "ControlPlaneJoin",
+				makeCloudConfig: func(kubernetesVersion string, labels map[string]string, taints []cloudinit.Taint) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+						KubernetesVersion: kubernetesVersion,
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						ExtraKubeletArgs:  []string{"--max-pods=250"},
+						NodeLabels:        labels,
+						NodeTaints:        taints,
+					})
+				},
+			},
+			{
+				name: "Worker",
+				makeCloudConfig: func(kubernetesVersion string, labels map[string]string, taints []cloudinit.Taint) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+						KubernetesVersion: kubernetesVersion,
+						Token:             strings.Repeat("a", 32),
+						ExtraKubeletArgs:  []string{"--max-pods=250"},
+						NodeLabels:        labels,
+						NodeTaints:        taints,
+					})
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				labels := map[string]string{
+					"node-role":                   "gpu",
+					"topology.kubernetes.io/zone": "zone-a",
+					"example.com/gpu-pool":        "a100",
+				}
+				taints := []cloudinit.Taint{
+					{Key: "nvidia.com/gpu", Value: "present", Effect: "NoSchedule"},
+					{Key: "dedicated", Effect: "NoExecute"},
+				}
+
+				t.Run("Scripts", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.26.3", labels, taints)
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.WriteFiles).To(ContainElement(cloudinit.File{
+						Content:     "--max-pods=250\n--node-labels=example.com/gpu-pool=a100,node-role=gpu,topology.kubernetes.io/zone=zone-a\n--register-with-taints=nvidia.com/gpu=present:NoSchedule,dedicated:NoExecute",
+						Path:        "/var/tmp/extra-kubelet-args",
+						Permissions: "0400",
+						Owner:       "root:root",
+					}))
+				})
+
+				t.Run("LaunchConfiguration", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.27.1", labels, taints)
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.WriteFiles).To(ContainElement(SatisfyAll(
+						HaveField("Path", "/var/snap/microk8s/common/.microk8s.yaml"),
+						HaveField("Content", ContainSubstring(`extraKubeletArgs:
+  --max-pods: "250"
+  --node-labels: example.com/gpu-pool=a100,node-role=gpu,topology.kubernetes.io/zone=zone-a
+  --register-with-taints: nvidia.com/gpu=present:NoSchedule,dedicated:NoExecute
+`)),
+					)))
+				})
+
+				t.Run("Invalid", func(t *testing.T) {
+					for _, invalid := range []struct {
+						name   string
+						labels map[string]string
+						taints []cloudinit.Taint
+					}{
+						{name: "RestrictedLabel", labels: map[string]string{"node-role.kubernetes.io/worker": ""}},
+						{name: "RestrictedK8sLabel", labels: map[string]string{"k8s.io/pool": "a"}},
+						{name: "LabelKey", labels: map[string]string{"pool,other": "a"}},
+						{name: "LabelValue", labels: map[string]string{"pool": "a b"}},
+						{name: "TaintKey", taints: []cloudinit.Taint{{Key: "gpu:NoSchedule", Effect: "NoSchedule"}}},
+						{name: "TaintValue", taints: []cloudinit.Taint{{Key: "gpu", Value: "a,b", Effect: "NoSchedule"}}},
+						{name: "TaintEffect", taints: []cloudinit.Taint{{Key: "gpu", Effect: "Never"}}},
+					} {
+						t.Run(invalid.name, func(t *testing.T) {
+							g := NewWithT(t)
+
+							_, err := tc.makeCloudConfig("v1.27.1", invalid.labels, invalid.taints)
+							g.Expect(err).To(HaveOccurred())
+						})
+					}
+				})
+			})
+		}
+	})
+
+	t.Run("ClusterNetwork", func(t *testing.T) {
+		for _, tc := range []struct {
+			name            string
+			makeCloudConfig func(kubernetesVersion string, podCIDR string, serviceCIDR string, clusterDomain string) (*cloudinit.CloudConfig, error)
+		}{
+			{
+				name: "ControlPlaneInit",
+				makeCloudConfig: func(kubernetesVersion string, podCIDR string, serviceCIDR string, clusterDomain string) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+						KubernetesVersion: kubernetesVersion,
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						PodCIDR:           podCIDR,
+						ServiceCIDR:       serviceCIDR,
+						ClusterDomain:     clusterDomain,
+					})
+				},
+			},
+			{
+				name: "ControlPlaneJoin",
+				makeCloudConfig: func(kubernetesVersion string, podCIDR string, serviceCIDR string, clusterDomain string) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+						KubernetesVersion: kubernetesVersion,
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						PodCIDR:           podCIDR,
+						ServiceCIDR:       serviceCIDR,
+						ClusterDomain:     clusterDomain,
+					})
+				},
+			},
+			{
+				name: "Worker",
+				makeCloudConfig: func(kubernetesVersion string, podCIDR string, serviceCIDR string, clusterDomain string) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+						KubernetesVersion: kubernetesVersion,
+						Token:             strings.Repeat("a", 32),
+						PodCIDR:           podCIDR,
+						ServiceCIDR:       serviceCIDR,
+						ClusterDomain:     clusterDomain,
+					})
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Run("Scripts", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.26.3", "", "", "")
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/10-configure-service-args.sh")))
+
+					c, err = tc.makeCloudConfig("v1.26.3", "10.2.0.0/16,fd01::/64", "10.153.0.0/16,fd98::/108", "cluster.example.com")
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.RunCommands).To(ContainElement("/capi-scripts/10-configure-service-args.sh kube-apiserver kube-controller-manager kube-proxy"))
+					g.Expect(c.WriteFiles).To(ContainElements(
+						cloudinit.File{Content: "--service-cluster-ip-range=10.153.0.0/16,fd98::/108\n", Path: "/var/tmp/service-args/kube-apiserver", Permissions: "0400", Owner: "root:root"},
+						cloudinit.File{Content: "--cluster-cidr=10.2.0.0/16,fd01::/64\n--service-cluster-ip-range=10.153.0.0/16,fd98::/108\n", Path: "/var/tmp/service-args/kube-controller-manager", Permissions: "0400", Owner: "root:root"},
+						cloudinit.File{Content: "--cluster-cidr=10.2.0.0/16,fd01::/64\n", Path: "/var/tmp/service-args/kube-proxy", Permissions: "0400", Owner: "root:root"},
+						cloudinit.File{Content: "--cluster-dns=10.153.0.10\n--cluster-domain=cluster.example.com", Path: "/var/tmp/extra-kubelet-args", Permissions: "0400", Owner: "root:root"},
+					))
+				})
+
+				t.Run("LaunchConfiguration", func(t *testing.T) {
+					g := NewWithT(t)
+
+					c, err := tc.makeCloudConfig("v1.27.1", "10.2.0.0/16", "", "cluster.example.com")
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(c.WriteFiles).To(ContainElement(SatisfyAll(
+						HaveField("Path", "/var/snap/microk8s/common/.microk8s.yaml"),
+						HaveField("Content", ContainSubstring(`extraKubeProxyArgs:
+  --cluster-cidr: 10.2.0.0/16
+`)),
+						HaveField("Content", ContainSubstring(`extraKubeletArgs:
+  --cluster-domain: cluster.example.com
+`)),
+					)))
+				})
+
+				t.Run("Invalid", func(t *testing.T) {
+					for _, invalid := range []struct {
+						name          string
+						podCIDR       string
+						serviceCIDR   string
+						clusterDomain string
+					}{
+						{name: "NotACIDR", podCIDR: "10.2.0.0"},
+						{name: "NotANetworkAddress", serviceCIDR: "10.153.0.1/16"},
+						{name: "IPv6First", podCIDR: "fd01::/64,10.2.0.0/16"},
+						{name: "TwoIPv4", serviceCIDR: "10.153.0.0/16,10.154.0.0/16"},
+						{name: "TooMany", podCIDR: "10.2.0.0/16,fd01::/64,fd02::/64"},
+						{name: "ClusterDomain", clusterDomain: "cluster.local; reboot"},
+					} {
+						t.Run(invalid.name, func(t *testing.T) {
+							g := NewWithT(t)
+
+							_, err := tc.makeCloudConfig("v1.27.1", invalid.podCIDR, invalid.serviceCIDR, invalid.clusterDomain)
+							g.Expect(err).To(HaveOccurred())
+						})
+					}
+				})
+			})
+		}
+	})
+
+	t.Run("Registries", func(t *testing.T) {
+		for _, tc := range []struct {
+			name            string
+			makeCloudConfig func(registries []cloudinit.Registry) (*cloudinit.CloudConfig, error)
+		}{
+			{
+				name: "ControlPlaneInit",
+				makeCloudConfig: func(registries []cloudinit.Registry) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+						KubernetesVersion: "v1.25.0",
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						Registries:        registries,
+					})
+				},
+			},
+			{
+				name: "ControlPlaneJoin",
+				makeCloudConfig: func(registries []cloudinit.Registry) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+						KubernetesVersion: "v1.25.0",
+						Token:             strings.Repeat("a", 32),
+						TokenTTL:          100,
+						Registries:        registries,
+					})
+				},
+			},
+			{
+				name: "Worker",
+				makeCloudConfig: func(registries []cloudinit.Registry) (*cloudinit.CloudConfig, error) {
+					return cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+						KubernetesVersion: "v1.25.0",
+						Token:             strings.Repeat("a", 32),
+						Registries:        registries,
+					})
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				c, err := tc.makeCloudConfig(nil)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(c.RunCommands).NotTo(ContainElement("/capi-scripts/10-configure-registries.sh"))
+
+				c, err = tc.makeCloudConfig([]cloudinit.Registry{
+					{
+						Host:     "docker.io",
+						Mirrors:  []string{"https://harbor.example.com/v2/dockerhub"},
+						CABundle: "CA",
+						Username: "user",
+						Password: "pass",
+					},
+					{Host: "_default", Mirrors: []string{"http://10.0.0.10:5000"}, SkipVerify: true},
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(c.RunCommands).To(ContainElement("/capi-scripts/10-configure-registries.sh"))
+				g.Expect(c.WriteFiles).To(ContainElements(
+					cloudinit.File{Content: "CA", Path: "/var/tmp/certs.d/docker.io/ca.crt", Permissions: "0644", Owner: "root:root"},
+					cloudinit.File{
+						Content: `server = "https://registry-1.docker.io"
+ca = "/var/snap/microk8s/current/args/certs.d/docker.io/ca.crt"
+[header]
+  authorization = "Basic dXNlcjpwYXNz"
+
+[host."https://harbor.example.com/v2/dockerhub"]
+  capabilities = ["pull", "resolve"]
+  ca = "/var/snap/microk8s/current/args/certs.d/docker.io/ca.crt"
+  [host."https://harbor.example.com/v2/dockerhub".header]
+    authorization = "Basic dXNlcjpwYXNz"
+`,
+						Path:        "/var/tmp/certs.d/docker.io/hosts.toml",
+						Permissions: "0600",
+						Owner:       "root:root",
+					},
+					cloudinit.File{
+						Content: `
+[host."http://10.0.0.10:5000"]
+  capabilities = ["pull", "resolve"]
+  skip_verify = true
+`,
+						Path:        "/var/tmp/certs.d/_default/hosts.toml",
+						Permissions: "0600",
+						Owner:       "root:root",
+					},
+				))
+
+				// registries are configured right after installing MicroK8s
+				var installIdx, registriesIdx int
+				for i, cmd := range c.RunCommands {
+					switch {
+					case strings.HasPrefix(cmd, "/capi-scripts/00-install-microk8s.sh"):
+						installIdx = i
+					case cmd == "/capi-scripts/10-configure-registries.sh":
+						registriesIdx = i
+					}
+				}
+				g.Expect(registriesIdx).To(Equal(installIdx + 1))
+
+				_, err = tc.makeCloudConfig([]cloudinit.Registry{{Host: "docker.io"}, {Host: "docker.io"}})
+				g.Expect(err).To(HaveOccurred())
+				_, err = tc.makeCloudConfig([]cloudinit.Registry{{Host: "../etc"}})
+				g.Expect(err).To(HaveOccurred())
+				_, err = tc.makeCloudConfig([]cloudinit.Registry{{Host: "docker.io", Mirrors: []string{`https://x"]`}}})
+				g.Expect(err).To(HaveOccurred())
+			})
+		}
+	})
+}
+
+// executedLines returns the run commands of the cloud-config, along with the non-comment lines of the
+// scripts they call, directly or through other scripts.
+func executedLines(c *cloudinit.CloudConfig) []string {
+	scripts := make(map[string]string, len(c.WriteFiles))
+	for _, f := range c.WriteFiles {
+		scripts[f.Path] = f.Content
+	}
+
+	var lines []string
+	seen := make(map[string]struct{})
+	var visit func(commands []string)
+	visit = func(commands []string) {
+		for _, cmd := range commands {
+			cmd = strings.TrimSpace(cmd)
+			if cmd == "" || strings.HasPrefix(cmd, "#") {
+				continue
+			}
+			lines = append(lines, cmd)
+			for _, word := range strings.Fields(cmd) {
+				content, ok := scripts[word]
+				if _, visited := seen[word]; !ok || visited {
+					continue
+				}
+				seen[word] = struct{}{}
+				visit(strings.Split(content, "\n"))
+			}
+		}
+	}
+	visit(c.RunCommands)
+	return lines
+}
+
+func TestSnapRefreshFromAPI(t *testing.T) {
+	g := NewWithT(t)
+
+	holdUntil := metav1.NewTime(time.Date(2023, 1, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600)))
+	g.Expect(cloudinit.SnapRefreshFromAPI(nil)).To(Equal(cloudinit.SnapRefresh{}))
+	g.Expect(cloudinit.SnapRefreshFromAPI(&v1beta1.SnapRefresh{Hold: true})).To(Equal(cloudinit.SnapRefresh{Hold: "forever"}))
+	g.Expect(cloudinit.SnapRefreshFromAPI(&v1beta1.SnapRefresh{HoldUntil: &holdUntil, Timer: "sat,02:00-04:00"})).To(Equal(cloudinit.SnapRefresh{Hold: "2023-01-01T11:00:00Z", Timer: "sat,02:00-04:00"}))
 }
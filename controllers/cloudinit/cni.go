@@ -0,0 +1,102 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"fmt"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+// CNIs that the cluster can be configured with, see the CNI of the cluster configuration.
+const (
+	CNICalicoVXLAN = bootstrapclusterxk8siov1beta1.CNICalicoVXLAN
+	CNICalicoIPIP  = bootstrapclusterxk8siov1beta1.CNICalicoIPIP
+	CNICalicoNone  = bootstrapclusterxk8siov1beta1.CNICalicoNone
+	CNICilium      = bootstrapclusterxk8siov1beta1.CNICilium
+	CNINone        = bootstrapclusterxk8siov1beta1.CNINone
+)
+
+// ciliumAddon is the addon that replaces Calico with Cilium.
+var ciliumAddon = Addon{Name: "cilium", Repository: "community"}
+
+// validateCNI validates the CNI of the cluster against the deprecated IPinIP setting.
+func validateCNI(cni string, ipInIP bool) error {
+	switch cni {
+	case "", CNICalicoIPIP:
+	case CNICalicoVXLAN, CNICalicoNone, CNICilium, CNINone:
+		if ipInIP {
+			return fmt.Errorf("IPinIP cannot be used with CNI %q", cni)
+		}
+	default:
+		return fmt.Errorf("CNI %q must be one of %q, %q, %q, %q or %q", cni, CNICalicoVXLAN, CNICalicoIPIP, CNICalicoNone, CNICilium, CNINone)
+	}
+	return nil
+}
+
+// configureCalicoCommands returns the commands that configure Calico before the node joins the cluster. The
+// IP pools are configured for the pod CIDR if set, which is only needed on the node that initializes the cluster.
+// Calico is removed from the node if the CNI is installed by the user.
+func configureCalicoCommands(cni string, ipInIP bool, podCIDR string) ([]string, error) {
+	if err := validateCNI(cni, ipInIP); err != nil {
+		return nil, err
+	}
+	switch cni {
+	case CNICilium:
+		return nil, nil
+	case CNINone:
+		return disableCalicoCommands(cni), nil
+	}
+
+	commands, err := configureCalicoCIDRsCommands(podCIDR)
+	if err != nil {
+		return nil, err
+	}
+	switch cni {
+	case CNICalicoIPIP:
+		ipInIP = true
+	case CNICalicoNone:
+		return append(commands, scriptPath(configureCalicoBGPScript)), nil
+	}
+	return append(commands, fmt.Sprintf("%s %v", scriptPath(configureCalicoIPIPScript), ipInIP)), nil
+}
+
+// disableCalicoCommands returns the commands that remove Calico from a node if the CNI is installed by the user.
+func disableCalicoCommands(cni string) []string {
+	if cni != CNINone {
+		return nil
+	}
+	return []string{scriptPath(disableCalicoScript)}
+}
+
+// cniAddons returns the addons to enable, with the addon of the CNI first unless it is already part of them.
+// The cilium addon cannot be enabled if another CNI is selected.
+func cniAddons(cni string, addons []Addon) ([]Addon, error) {
+	hasCiliumAddon := false
+	for _, addon := range addons {
+		if addon.Name == ciliumAddon.Name {
+			hasCiliumAddon = true
+		}
+	}
+	switch {
+	case cni == CNICilium && !hasCiliumAddon:
+		return append([]Addon{ciliumAddon}, addons...), nil
+	case cni != "" && cni != CNICilium && hasCiliumAddon:
+		return nil, fmt.Errorf("addon %q cannot be enabled with CNI %q", ciliumAddon.Name, cni)
+	}
+	return addons, nil
+}
@@ -18,11 +18,12 @@ package cloudinit
 
 import (
 	"fmt"
-	"net"
 	"path/filepath"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/progress"
 )
 
 // ControlPlaneInitInput defines the context needed to generate a controlplane instance to init a cluster.
@@ -37,26 +38,55 @@ type ControlPlaneInitInput struct {
 	Token string
 	// TokenTTL configures how many seconds the join token will be valid.
 	TokenTTL int64
+	// JoinTokenSync registers the per-machine join tokens issued by the bootstrap provider instead of Token.
+	JoinTokenSync bool
 	// KubernetesVersion is the Kubernetes version we want to install.
 	KubernetesVersion string
 	// ClusterAgentPort is the port that cluster-agent binds to.
 	ClusterAgentPort string
+	// APIServerPort is the port that kube-apiserver binds to.
+	APIServerPort string
+	// NativeAPIServerPort configures the apiserver port without iptables rules and package installs.
+	NativeAPIServerPort bool
 	// DqlitePort is the port that dqlite binds to.
 	DqlitePort string
+	// PodCIDR is the CIDR of the pod network, optionally followed by a comma and an IPv6 CIDR.
+	PodCIDR string
+	// ServiceCIDR is the CIDR of the service network, optionally followed by a comma and an IPv6 CIDR.
+	ServiceCIDR string
+	// ClusterDomain is the DNS domain of the cluster.
+	ClusterDomain string
+	// CertSANs are extra IP addresses and DNS names of the server certificate.
+	CertSANs []string
 	// ContainerdHTTPProxy is http_proxy configuration for containerd.
 	ContainerdHTTPProxy string
 	// ContainerdHTTPSProxy is https_proxy configuration for containerd.
 	ContainerdHTTPSProxy string
 	// ContainerdNoProxy is no_proxy configuration for containerd.
 	ContainerdNoProxy string
-	// Addons is the list of addons to enable.
-	Addons []string
+	// Addons is the list of addons to enable, in order.
+	Addons []Addon
+	// DisableDefaultDNS does not enable the dns addon if it is not part of Addons.
+	DisableDefaultDNS bool
+	// AddonRepositories is the list of addon repositories to add before enabling the addons.
+	AddonRepositories []AddonRepository
+	// DisableCommunityAddons does not add the community addon repository.
+	DisableCommunityAddons bool
 	// IPinIP defines whether Calico will use IPinIP mode for cluster networking.
 	IPinIP bool
+	// CNI is the CNI of the cluster, one of "calico-vxlan", "calico-ipip", "calico-none", "cilium" or "none".
+	// Defaults to Calico with VXLAN, or IPinIP if IPinIP is set.
+	CNI string
 	// Confinement specifies a classic or strict deployment of microk8s snap.
 	Confinement string
 	// RiskLevel specifies the risk level (strict, candidate, beta, edge) for the snap channels.
 	RiskLevel string
+	// SnapRevision pins the revision of the MicroK8s snap. The latest revision of the channel is used if zero.
+	SnapRevision int64
+	// Installation configures installing MicroK8s without access to the snap store.
+	Installation Installation
+	// SnapRefresh controls when snapd refreshes snaps.
+	SnapRefresh SnapRefresh
 	// SnapstoreProxyDomain specifies the domain of the snapstore proxy if one is to be used.
 	SnapstoreProxyDomain string
 	// SnapstoreProxyId specifies the snapstore proxy ID if one is to be used.
@@ -65,10 +95,20 @@ type ControlPlaneInitInput struct {
 	ExtraWriteFiles []File
 	// ExtraKubeletArgs is a list of arguments to add to kubelet.
 	ExtraKubeletArgs []string
+	// NodeLabels are the labels to register the node with.
+	NodeLabels map[string]string
+	// NodeTaints are the taints to register the node with.
+	NodeTaints []Taint
+	// ExtraServiceArgs are the arguments to add to and remove from the MicroK8s services, keyed by service name.
+	ExtraServiceArgs map[string]ServiceArgs
+	// Registries configures how containerd pulls images from container registries.
+	Registries []Registry
 	// SnapstoreHTTPProxy is http_proxy configuration for snap store.
 	SnapstoreHTTPProxy string
 	// SnapstoreHTTPSProxy is https_proxy configuration for snap store.
 	SnapstoreHTTPSProxy string
+	// ProgressReport configures reporting the bootstrap progress of the node to the management cluster.
+	ProgressReport ProgressReport
 	// BootCommands is a list of commands to add to the "bootcmd" section of cloud-init.
 	BootCommands []string
 	// PreRunCommands is a list of commands to add to the "runcmd" section of cloud-init before installing MicroK8s.
@@ -79,31 +119,31 @@ type ControlPlaneInitInput struct {
 
 func NewInitControlPlane(input *ControlPlaneInitInput) (*CloudConfig, error) {
 	// ensure token is valid
-	if len(input.Token) != 32 {
-		return nil, fmt.Errorf("join token %q is invalid; length must be 32 characters", input.Token)
-	}
-	if input.TokenTTL <= 0 {
-		return nil, fmt.Errorf("join token TTL %q is not a positive number", input.TokenTTL)
+	if !input.JoinTokenSync {
+		if len(input.Token) != 32 {
+			return nil, fmt.Errorf("join token %q is invalid; length must be 32 characters", input.Token)
+		}
+		if input.TokenTTL <= 0 {
+			return nil, fmt.Errorf("join token TTL %q is not a positive number", input.TokenTTL)
+		}
 	}
 
-	// figure out endpoint type
-	endpointType := "DNS"
-	if net.ParseIP(input.ControlPlaneEndpoint) != nil {
-		endpointType = "IP"
+	configureCertCommand, err := configureCertSANsCommand(input.ControlPlaneEndpoint, input.ServiceCIDR, input.CertSANs)
+	if err != nil {
+		return nil, err
 	}
 
-	// quote addons to add to the command-line later
-	hasDNSAddon := false
-	addons := make([]string, 0, len(input.Addons))
-	for _, addon := range input.Addons {
-		if strings.Contains(addon, "dns") {
-			hasDNSAddon = true
-		}
-		addons = append(addons, fmt.Sprintf("%q", addon))
+	addonList, err := cniAddons(input.CNI, input.Addons)
+	if err != nil {
+		return nil, err
+	}
+	addons, err := enableAddonsArgs(addonList, input.DisableDefaultDNS, input.DisableCommunityAddons)
+	if err != nil {
+		return nil, err
 	}
-	// always include the dns addon
-	if !hasDNSAddon {
-		addons = append(addons, fmt.Sprintf("%q", "dns"))
+	addAddonRepositories, err := addAddonRepositoriesCommands(input.AddonRepositories)
+	if err != nil {
+		return nil, err
 	}
 
 	// figure out snap channel from KubernetesVersion
@@ -116,7 +156,52 @@ func NewInitControlPlane(input *ControlPlaneInitInput) (*CloudConfig, error) {
 	if input.Confinement == "strict" && kubernetesVersion.Minor() < 25 {
 		return nil, fmt.Errorf("strict confinement is only available for microk8s v1.25+")
 	}
-	installArgs := createInstallArgs(input.Confinement, input.RiskLevel, kubernetesVersion)
+	installCommands, err := installMicroK8sCommands(input.Installation, input.Confinement, input.RiskLevel, input.SnapRevision, kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	snapRefreshCommands, err := configureSnapRefreshCommands(input.SnapRefresh)
+	if err != nil {
+		return nil, err
+	}
+	registryFiles, registryCommands, err := configureRegistries(input.Registries)
+	if err != nil {
+		return nil, err
+	}
+	serviceArgs, err := clusterNetworkServiceArgs(input.PodCIDR, input.ServiceCIDR, input.ExtraServiceArgs)
+	if err != nil {
+		return nil, err
+	}
+	dnsKubeletArgs, err := clusterDNSKubeletArgs(input.ServiceCIDR, input.ClusterDomain)
+	if err != nil {
+		return nil, err
+	}
+	calicoCommands, err := configureCalicoCommands(input.CNI, input.IPinIP, input.PodCIDR)
+	if err != nil {
+		return nil, err
+	}
+	dnsCommands, err := configureClusterDNSCommands(input.ServiceCIDR, input.ClusterDomain)
+	if err != nil {
+		return nil, err
+	}
+	progressFiles, err := configureProgressReport(input.ProgressReport)
+	if err != nil {
+		return nil, err
+	}
+	nodeFiles, nodeCommands, err := configureNode(kubernetesVersion, nodeConfiguration{
+		kubeletArgs:   append(dnsKubeletArgs, input.ExtraKubeletArgs...),
+		nodeLabels:    input.NodeLabels,
+		nodeTaints:    input.NodeTaints,
+		serviceArgs:   serviceArgs,
+		apiServerArgs: controlPlaneAPIServerArgs,
+		apiServerPort: nativeAPIServerPort(input.NativeAPIServerPort, input.APIServerPort),
+		httpProxy:     input.ContainerdHTTPProxy,
+		httpsProxy:    input.ContainerdHTTPSProxy,
+		noProxy:       input.ContainerdNoProxy,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	cloudConfig := NewBaseCloudConfig()
 	cloudConfig.WriteFiles = append(
@@ -125,15 +210,9 @@ func NewInitControlPlane(input *ControlPlaneInitInput) (*CloudConfig, error) {
 		File{Content: input.CACert, Path: filepath.Join("/var", "tmp", "ca.crt"), Permissions: "0600", Owner: "root:root"},
 	)
 	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, input.ExtraWriteFiles...)
-
-	if args := input.ExtraKubeletArgs; len(args) > 0 {
-		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, File{
-			Content:     strings.Join(args, "\n"),
-			Path:        filepath.Join("/var", "tmp", "extra-kubelet-args"),
-			Permissions: "0400",
-			Owner:       "root:root",
-		})
-	}
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, nodeFiles...)
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, registryFiles...)
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, progressFiles...)
 	cloudConfig.BootCommands = append(cloudConfig.BootCommands, input.BootCommands...)
 
 	cloudConfig.RunCommands = append(cloudConfig.RunCommands, input.PreRunCommands...)
@@ -141,19 +220,34 @@ func NewInitControlPlane(input *ControlPlaneInitInput) (*CloudConfig, error) {
 		fmt.Sprintf("%s %q %q", scriptPath(snapstoreHTTPProxyScript), input.SnapstoreHTTPProxy, input.SnapstoreHTTPSProxy),
 		fmt.Sprintf("%s %q %q", scriptPath(snapstoreProxyScript), input.SnapstoreProxyDomain, input.SnapstoreProxyId),
 		scriptPath(disableHostServicesScript),
-		fmt.Sprintf("%s %q", scriptPath(installMicroK8sScript), installArgs),
-		fmt.Sprintf("%s %q %q %q", scriptPath(configureContainerdProxyScript), input.ContainerdHTTPProxy, input.ContainerdHTTPSProxy, input.ContainerdNoProxy),
-		scriptPath(configureKubeletScript),
+	)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, snapRefreshCommands...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, reportProgressCommands(input.ProgressReport, progress.StepInstall, installCommands...)...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, registryCommands...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, nodeCommands...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands,
 		scriptPath(waitAPIServerScript),
 		"microk8s refresh-certs /var/tmp",
-		fmt.Sprintf("%s %v", scriptPath(configureCalicoIPIPScript), input.IPinIP),
+	)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, calicoCommands...)
+	// the joining machines install the same revision of the snap as this machine
+	if input.Installation.Snap == "" {
+		cloudConfig.RunCommands = append(cloudConfig.RunCommands, scriptPath(publishSnapRevisionScript))
+	}
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands,
 		fmt.Sprintf("%s %q", scriptPath(configureClusterAgentPortScript), input.ClusterAgentPort),
 		fmt.Sprintf("%s %q", scriptPath(configureDqlitePortScript), input.DqlitePort),
-		fmt.Sprintf("%s %q %q", scriptPath(configureCertLB), endpointType, input.ControlPlaneEndpoint),
-		scriptPath(configureAPIServerScript),
-		fmt.Sprintf("%s %s", scriptPath(microk8sEnableScript), strings.Join(addons, " ")),
-		fmt.Sprintf("microk8s add-node --token-ttl %v --token %q", input.TokenTTL, input.Token),
+		configureCertCommand,
 	)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, configureAPIServerPortCommands(kubernetesVersion, input.NativeAPIServerPort, input.APIServerPort)...)
+	addonCommands := append(addAddonRepositories, fmt.Sprintf("%s %s", scriptPath(microk8sEnableScript), strings.Join(addons, " ")))
+	addonCommands = append(addonCommands, dnsCommands...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, reportProgressCommands(input.ProgressReport, progress.StepAddons, addonCommands...)...)
+	if input.JoinTokenSync {
+		cloudConfig.RunCommands = append(cloudConfig.RunCommands, fmt.Sprintf("%s install", scriptPath(syncJoinTokensScript)))
+	} else {
+		cloudConfig.RunCommands = append(cloudConfig.RunCommands, fmt.Sprintf("microk8s add-node --token-ttl %v --token %q", input.TokenTTL, input.Token))
+	}
 	cloudConfig.RunCommands = append(cloudConfig.RunCommands, input.PostRunCommands...)
 
 	return cloudConfig, nil
@@ -34,6 +34,7 @@ func TestControlPlaneInit(t *testing.T) {
 			ControlPlaneEndpoint: "k8s.my-domain.com",
 			KubernetesVersion:    "v1.25.2",
 			ClusterAgentPort:     "30000",
+			APIServerPort:        "6443",
 			DqlitePort:           "2379",
 			IPinIP:               true,
 			Token:                strings.Repeat("a", 32),
@@ -53,10 +54,11 @@ func TestControlPlaneInit(t *testing.T) {
 			`/capi-scripts/50-wait-apiserver.sh`,
 			`microk8s refresh-certs /var/tmp`,
 			`/capi-scripts/10-configure-calico-ipip.sh true`,
+			`/capi-scripts/20-publish-snap-revision.sh`,
 			`/capi-scripts/10-configure-cluster-agent-port.sh "30000"`,
 			`/capi-scripts/10-configure-dqlite-port.sh "2379"`,
-			`/capi-scripts/10-configure-cert-for-lb.sh "DNS" "k8s.my-domain.com"`,
-			`/capi-scripts/10-configure-apiserver.sh`,
+			`/capi-scripts/10-configure-cert-for-lb.sh "DNS:k8s.my-domain.com"`,
+			`/capi-scripts/10-configure-apiserver.sh "6443"`,
 			`/capi-scripts/20-microk8s-enable.sh "dns"`,
 			`microk8s add-node --token-ttl 10000 --token "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
 		}))
@@ -76,6 +78,331 @@ func TestControlPlaneInit(t *testing.T) {
 			},
 		))
 
+		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+	t.Run("JoinTokenSync", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cloudConfig, err := cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+			CAKey:                `CA KEY DATA`,
+			CACert:               `CA CERT DATA`,
+			ControlPlaneEndpoint: "k8s.my-domain.com",
+			KubernetesVersion:    "v1.25.2",
+			ClusterAgentPort:     "30000",
+			DqlitePort:           "2379",
+			JoinTokenSync:        true,
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(cloudConfig.RunCommands).To(ContainElement(`/capi-scripts/25-microk8s-sync-join-tokens.sh install`))
+		g.Expect(cloudConfig.RunCommands).NotTo(ContainElement(HavePrefix("microk8s add-node")))
+
+		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+	t.Run("DualStack", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cloudConfig, err := cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+			ControlPlaneEndpoint: "fd00::100",
+			KubernetesVersion:    "v1.25.2",
+			Token:                strings.Repeat("a", 32),
+			TokenTTL:             10000,
+			PodCIDR:              "10.2.0.0/16,fd01::/64",
+			ServiceCIDR:          "10.152.183.0/24,fd98::/108",
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(cloudConfig.RunCommands).To(ContainElements(
+			`/capi-scripts/10-configure-calico-cidrs.sh "10.2.0.0/16" "fd01::/64"`,
+			`/capi-scripts/10-configure-cert-for-lb.sh "IP:fd00::100" "IP:fd98::1"`,
+		))
+
+		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+	t.Run("ClusterDNS", func(t *testing.T) {
+		for _, tc := range []struct {
+			name          string
+			serviceCIDR   string
+			clusterDomain string
+			expectCommand string
+		}{
+			{name: "Default"},
+			{name: "ServiceCIDR", serviceCIDR: "172.30.0.0/16", expectCommand: `/capi-scripts/30-configure-dns.sh "172.30.0.10" "cluster.local"`},
+			{name: "ClusterDomain", clusterDomain: "cluster.example.com", expectCommand: `/capi-scripts/30-configure-dns.sh "10.152.183.10" "cluster.example.com"`},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				cloudConfig, err := cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+					KubernetesVersion: "v1.25.2",
+					Token:             strings.Repeat("a", 32),
+					TokenTTL:          10000,
+					PostRunCommands:   []string{"echo done"},
+					ServiceCIDR:       tc.serviceCIDR,
+					ClusterDomain:     tc.clusterDomain,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
+				if tc.expectCommand == "" {
+					g.Expect(cloudConfig.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/30-configure-dns.sh")))
+					return
+				}
+				// the dns addon is configured after the addons are enabled
+				n := len(cloudConfig.RunCommands)
+				g.Expect(cloudConfig.RunCommands[n-4:]).To(Equal([]string{
+					`/capi-scripts/20-microk8s-enable.sh "dns"`,
+					tc.expectCommand,
+					`microk8s add-node --token-ttl 10000 --token "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
+					`echo done`,
+				}))
+			})
+		}
+	})
+	t.Run("CertSANs", func(t *testing.T) {
+		for _, tc := range []struct {
+			name          string
+			endpoint      string
+			certSANs      []string
+			expectCommand string
+			expectErr     bool
+		}{
+			{
+				name:          "Mixed",
+				endpoint:      "k8s.my-domain.com",
+				certSANs:      []string{"10.0.0.100", "k8s.internal.my-domain.com", "fd00::100", "*.k8s.my-domain.com"},
+				expectCommand: `/capi-scripts/10-configure-cert-for-lb.sh "DNS:k8s.my-domain.com" "IP:10.0.0.100" "DNS:k8s.internal.my-domain.com" "IP:fd00::100" "DNS:*.k8s.my-domain.com"`,
+			},
+			{
+				name:          "Duplicate",
+				endpoint:      "10.0.0.100",
+				certSANs:      []string{"10.0.0.100", "k8s.my-domain.com", "fd00:0::100", "fd00::100"},
+				expectCommand: `/capi-scripts/10-configure-cert-for-lb.sh "IP:10.0.0.100" "DNS:k8s.my-domain.com" "IP:fd00::100"`,
+			},
+			{
+				name:          "NoEndpoint",
+				certSANs:      []string{"k8s.my-domain.com"},
+				expectCommand: `/capi-scripts/10-configure-cert-for-lb.sh "DNS:k8s.my-domain.com"`,
+			},
+			{name: "InvalidDNSName", certSANs: []string{"K8s_API.example.com"}, expectErr: true},
+			{name: "InvalidIP", certSANs: []string{"10.0.0.256"}, expectErr: true},
+			{name: "InvalidBrackets", certSANs: []string{"[fd00::100]"}, expectErr: true},
+			{name: "InvalidCommand", certSANs: []string{"k8s.my-domain.com; reboot"}, expectErr: true},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				cloudConfig, err := cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+					ControlPlaneEndpoint: tc.endpoint,
+					KubernetesVersion:    "v1.25.2",
+					Token:                strings.Repeat("a", 32),
+					TokenTTL:             10000,
+					CertSANs:             tc.certSANs,
+				})
+				if tc.expectErr {
+					g.Expect(err).To(HaveOccurred())
+					return
+				}
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(cloudConfig.RunCommands).To(ContainElement(tc.expectCommand))
+			})
+		}
+	})
+	t.Run("CNI", func(t *testing.T) {
+		for _, tc := range []struct {
+			name           string
+			cni            string
+			ipInIP         bool
+			addons         []cloudinit.Addon
+			expectCommands []string
+			expectAddons   string
+			expectErr      bool
+		}{
+			{name: "Default", expectCommands: []string{"/capi-scripts/10-configure-calico-ipip.sh false"}, expectAddons: `"dns"`},
+			{name: "DefaultIPinIP", ipInIP: true, expectCommands: []string{"/capi-scripts/10-configure-calico-ipip.sh true"}, expectAddons: `"dns"`},
+			{name: "CalicoVXLAN", cni: "calico-vxlan", expectCommands: []string{"/capi-scripts/10-configure-calico-ipip.sh false"}, expectAddons: `"dns"`},
+			{name: "CalicoIPIP", cni: "calico-ipip", expectCommands: []string{"/capi-scripts/10-configure-calico-ipip.sh true"}, expectAddons: `"dns"`},
+			{name: "CalicoNone", cni: "calico-none", expectCommands: []string{"/capi-scripts/10-configure-calico-bgp.sh"}, expectAddons: `"dns"`},
+			{name: "Cilium", cni: "cilium", expectCommands: []string{}, expectAddons: `"community/cilium" "dns"`},
+			{name: "CiliumAddon", cni: "cilium", expectCommands: []string{}, addons: []cloudinit.Addon{{Name: "cilium", Repository: "internal"}}, expectAddons: `"internal/cilium" "dns"`},
+			{name: "None", cni: "none", expectCommands: []string{"/capi-scripts/10-disable-calico.sh"}, expectAddons: `"dns"`},
+			{name: "NoneIPinIP", cni: "none", ipInIP: true, expectErr: true},
+			{name: "CalicoCiliumAddon", cni: "calico-vxlan", addons: []cloudinit.Addon{{Name: "cilium", Repository: "community"}}, expectErr: true},
+			{name: "Invalid", cni: "flannel", expectErr: true},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				cloudConfig, err := cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+					KubernetesVersion: "v1.25.2",
+					Token:             strings.Repeat("a", 32),
+					TokenTTL:          10000,
+					CNI:               tc.cni,
+					IPinIP:            tc.ipInIP,
+					Addons:            tc.addons,
+				})
+				if tc.expectErr {
+					g.Expect(err).To(HaveOccurred())
+					return
+				}
+				g.Expect(err).NotTo(HaveOccurred())
+
+				// Calico is configured after the kube-apiserver is up, before the addons are enabled
+				i := -1
+				for j, command := range cloudConfig.RunCommands {
+					if command == "microk8s refresh-certs /var/tmp" {
+						i = j
+					}
+				}
+				g.Expect(i).NotTo(Equal(-1))
+				g.Expect(cloudConfig.RunCommands[i+1 : i+1+len(tc.expectCommands)]).To(Equal(tc.expectCommands))
+				g.Expect(cloudConfig.RunCommands).To(ContainElement("/capi-scripts/20-microk8s-enable.sh " + tc.expectAddons))
+				for _, script := range []string{"10-configure-calico-ipip.sh", "10-configure-calico-bgp.sh", "10-disable-calico.sh"} {
+					if len(tc.expectCommands) == 0 || !strings.HasPrefix(tc.expectCommands[0], "/capi-scripts/"+script) {
+						g.Expect(cloudConfig.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/" + script)))
+					}
+				}
+			})
+		}
+	})
+	t.Run("Addons", func(t *testing.T) {
+		for _, tc := range []struct {
+			name                   string
+			addons                 []cloudinit.Addon
+			disableDefaultDNS      bool
+			disableCommunityAddons bool
+			expected               string
+			expectErr              bool
+		}{
+			{
+				name:     "Default",
+				expected: `/capi-scripts/20-microk8s-enable.sh "dns"`,
+			},
+			{
+				name: "Ordered",
+				addons: []cloudinit.Addon{
+					{Name: "metallb", Arguments: "10.0.0.1-10.0.0.10", TimeoutSeconds: 300},
+					{Name: "istio", Repository: "community"},
+					{Name: "dns", Arguments: "1.1.1.1"},
+				},
+				expected: `/capi-scripts/20-microk8s-enable.sh "--timeout=300" "metallb:10.0.0.1-10.0.0.10" "community/istio" "dns:1.1.1.1"`,
+			},
+			{
+				name:     "NameContainsDNS",
+				addons:   []cloudinit.Addon{{Name: "external-dns"}},
+				expected: `/capi-scripts/20-microk8s-enable.sh "external-dns" "dns"`,
+			},
+			{
+				name:              "DisableDefaultDNS",
+				addons:            []cloudinit.Addon{{Name: "ingress"}},
+				disableDefaultDNS: true,
+				expected:          `/capi-scripts/20-microk8s-enable.sh "ingress"`,
+			},
+			{
+				name:                   "DisableCommunityAddons",
+				addons:                 []cloudinit.Addon{{Name: "ingress"}},
+				disableCommunityAddons: true,
+				expected:               `/capi-scripts/20-microk8s-enable.sh "--skip-community" "ingress" "dns"`,
+			},
+			{
+				name:                   "DisableCommunityAddonsWithCommunityAddon",
+				addons:                 []cloudinit.Addon{{Name: "istio", Repository: "community"}},
+				disableCommunityAddons: true,
+				expectErr:              true,
+			},
+			{
+				name:      "InvalidName",
+				addons:    []cloudinit.Addon{{Name: "dns; reboot"}},
+				expectErr: true,
+			},
+			{
+				name:      "InvalidArguments",
+				addons:    []cloudinit.Addon{{Name: "metallb", Arguments: "$(reboot)"}},
+				expectErr: true,
+			},
+			{
+				name:      "Duplicate",
+				addons:    []cloudinit.Addon{{Name: "ingress"}, {Name: "ingress"}},
+				expectErr: true,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				cloudConfig, err := cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+					KubernetesVersion:      "v1.25.2",
+					Token:                  strings.Repeat("a", 32),
+					TokenTTL:               10000,
+					Addons:                 tc.addons,
+					DisableDefaultDNS:      tc.disableDefaultDNS,
+					DisableCommunityAddons: tc.disableCommunityAddons,
+				})
+				if tc.expectErr {
+					g.Expect(err).To(HaveOccurred())
+					return
+				}
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(cloudConfig.RunCommands).To(ContainElement(tc.expected))
+			})
+		}
+	})
+	t.Run("AddonRepositories", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cloudConfig, err := cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+			KubernetesVersion: "v1.25.2",
+			Token:             strings.Repeat("a", 32),
+			TokenTTL:          10000,
+			Addons:            []cloudinit.Addon{{Name: "monitoring", Repository: "internal"}},
+			AddonRepositories: []cloudinit.AddonRepository{
+				{Name: "internal", Repository: "https://git.example.com/addons.git", Reference: "v1.0"},
+				{Name: "local", Repository: "/opt/addons"},
+			},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(cloudConfig.RunCommands).To(ContainElements(
+			`/capi-scripts/20-microk8s-add-addon-repository.sh "internal" "https://git.example.com/addons.git" "v1.0"`,
+			`/capi-scripts/20-microk8s-add-addon-repository.sh "local" "/opt/addons" ""`,
+			`/capi-scripts/20-microk8s-enable.sh "internal/monitoring" "dns"`,
+		))
+
+		_, err = cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+			KubernetesVersion: "v1.25.2",
+			Token:             strings.Repeat("a", 32),
+			TokenTTL:          10000,
+			AddonRepositories: []cloudinit.AddonRepository{{Name: "internal", Repository: "https://example.com/$(reboot)"}},
+		})
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("ProgressReport", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cloudConfig, err := cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInitInput{
+			KubernetesVersion: "v1.25.2",
+			Token:             strings.Repeat("a", 32),
+			TokenTTL:          10000,
+			Addons:            []cloudinit.Addon{{Name: "metrics-server"}},
+			ProgressReport: cloudinit.ProgressReport{
+				URL:   "https://10.0.0.10:8082/v1/progress/default/control-plane-0",
+				Token: strings.Repeat("b", 32),
+			},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(cloudConfig.RunCommands).To(ContainElements(
+			`/capi-scripts/00-report-progress.sh install run /capi-scripts/00-install-microk8s.sh "--channel 1.25 --classic"`,
+			`/capi-scripts/00-report-progress.sh install succeeded`,
+			`/capi-scripts/50-wait-apiserver.sh`,
+			`/capi-scripts/00-report-progress.sh addons run /capi-scripts/20-microk8s-enable.sh "metrics-server" "dns"`,
+			`/capi-scripts/00-report-progress.sh addons succeeded`,
+			`microk8s add-node --token-ttl 10000 --token "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
+		))
+		g.Expect(cloudConfig.WriteFiles).To(ContainElement(HaveField("Path", "/var/tmp/progress-report.env")))
+
 		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
 		g.Expect(err).ToNot(HaveOccurred())
 	})
@@ -32,6 +32,7 @@ func TestControlPlaneJoin(t *testing.T) {
 			ControlPlaneEndpoint: "k8s.my-domain.com",
 			KubernetesVersion:    "v1.25.2",
 			ClusterAgentPort:     "30000",
+			APIServerPort:        "6443",
 			DqlitePort:           "2379",
 			IPinIP:               true,
 			Token:                strings.Repeat("a", 32),
@@ -53,12 +54,98 @@ func TestControlPlaneJoin(t *testing.T) {
 			`/capi-scripts/10-configure-cluster-agent-port.sh "30000"`,
 			`/capi-scripts/10-configure-dqlite-port.sh "2379"`,
 			`/capi-scripts/50-wait-apiserver.sh`,
-			`/capi-scripts/10-configure-cert-for-lb.sh "DNS" "k8s.my-domain.com"`,
+			`/capi-scripts/10-configure-cert-for-lb.sh "DNS:k8s.my-domain.com"`,
 			`/capi-scripts/20-microk8s-join.sh no "10.0.3.39:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" "10.0.3.40:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" "10.0.3.41:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
-			`/capi-scripts/10-configure-apiserver.sh`,
+			`/capi-scripts/10-configure-apiserver.sh "6443"`,
 			`microk8s add-node --token-ttl 10000 --token "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
 		}))
 
+		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+	t.Run("IPv6", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cloudConfig, err := cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+			ControlPlaneEndpoint: "[fd00::100]",
+			KubernetesVersion:    "v1.25.2",
+			ClusterAgentPort:     "30000",
+			Token:                strings.Repeat("a", 32),
+			TokenTTL:             10000,
+			ServiceCIDR:          "10.153.0.0/16,fd98::/108",
+			CertSANs:             []string{"k8s.my-domain.com", "fd00::101"},
+			JoinNodeIPs:          []string{"fd00::39", "10.0.3.40"},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(cloudConfig.RunCommands).To(ContainElements(
+			`/capi-scripts/10-configure-cert-for-lb.sh "IP:fd00::100" "IP:10.153.0.1" "IP:fd98::1" "DNS:k8s.my-domain.com" "IP:fd00::101"`,
+			`/capi-scripts/20-microk8s-join.sh no "[fd00::39]:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" "10.0.3.40:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
+		))
+		// the pod CIDR of Calico is only configured on the node that initializes the cluster
+		g.Expect(cloudConfig.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/10-configure-calico-cidrs.sh")))
+
+		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+	t.Run("CNI", func(t *testing.T) {
+		g := NewWithT(t)
+
+		for cni, expectCommand := range map[string]string{
+			"calico-none": "/capi-scripts/10-configure-calico-bgp.sh",
+			"none":        "/capi-scripts/10-disable-calico.sh",
+		} {
+			cloudConfig, err := cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+				ControlPlaneEndpoint: "k8s.my-domain.com",
+				KubernetesVersion:    "v1.25.2",
+				ClusterAgentPort:     "30000",
+				Token:                strings.Repeat("a", 32),
+				TokenTTL:             10000,
+				JoinNodeIPs:          []string{"10.0.3.39"},
+				CNI:                  cni,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(cloudConfig.RunCommands).To(ContainElement(expectCommand))
+			g.Expect(cloudConfig.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/10-configure-calico-ipip.sh")))
+		}
+
+		cloudConfig, err := cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+			ControlPlaneEndpoint: "k8s.my-domain.com",
+			KubernetesVersion:    "v1.25.2",
+			ClusterAgentPort:     "30000",
+			Token:                strings.Repeat("a", 32),
+			TokenTTL:             10000,
+			CNI:                  "cilium",
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(cloudConfig.RunCommands).NotTo(ContainElement(HavePrefix("/capi-scripts/10-configure-calico")))
+
+		_, err = cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+			KubernetesVersion: "v1.25.2",
+			Token:             strings.Repeat("a", 32),
+			TokenTTL:          10000,
+			CNI:               "cilium",
+			IPinIP:            true,
+		})
+		g.Expect(err).To(HaveOccurred())
+	})
+	t.Run("JoinTokenSync", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cloudConfig, err := cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+			ControlPlaneEndpoint: "k8s.my-domain.com",
+			KubernetesVersion:    "v1.25.2",
+			ClusterAgentPort:     "30000",
+			DqlitePort:           "2379",
+			Token:                strings.Repeat("a", 32),
+			JoinTokenSync:        true,
+			JoinNodeIPs:          []string{"10.0.3.39"},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(cloudConfig.RunCommands).To(ContainElement(`/capi-scripts/25-microk8s-sync-join-tokens.sh install`))
+		g.Expect(cloudConfig.RunCommands).NotTo(ContainElement(HavePrefix("microk8s add-node")))
+
 		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
 		g.Expect(err).ToNot(HaveOccurred())
 	})
@@ -40,18 +40,39 @@ const (
 	// snapstoreHTTPProxyScript configures HTTP and HTTPS proxy to access the snap store.
 	snapstoreHTTPProxyScript script = "00-configure-snapstore-http-proxy.sh"
 
+	// configureSnapRefreshScript configures when snapd refreshes snaps.
+	configureSnapRefreshScript script = "00-configure-snap-refresh.sh"
+
 	// disableHostServicesScript disables services like containerd or kubelet from the host OS image.
 	disableHostServicesScript script = "00-disable-host-services.sh"
 
+	// reportProgressScript reports the progress of a bootstrap step to the management cluster.
+	reportProgressScript script = "00-report-progress.sh"
+
 	// installMicroK8sScript installs MicroK8s on the host.
 	installMicroK8sScript script = "00-install-microk8s.sh"
 
-	// configureCertLB configures the server certificate so it is valid for the LB.
+	// installMicroK8sSnapScript installs MicroK8s on the host from a snap file.
+	installMicroK8sSnapScript script = "00-install-microk8s-snap.sh"
+
+	// importImagesScript imports image bundles into containerd.
+	importImagesScript script = "10-import-images.sh"
+
+	// configureCertLB configures the server certificate so it is valid for the LB and the kubernetes service.
 	configureCertLB script = "10-configure-cert-for-lb.sh"
 
-	// configureAPIServerScript configures arguments and sets apiserver port to 6443.
+	// configureAPIServerScript configures arguments and sets the apiserver port.
 	configureAPIServerScript script = "10-configure-apiserver.sh"
 
+	// configureAPIServerNativeScript sets the apiserver port through the MicroK8s arguments only.
+	configureAPIServerNativeScript script = "10-configure-apiserver-native.sh"
+
+	// configureCalicoBGPScript configures Calico to route pod traffic with BGP, without encapsulation.
+	configureCalicoBGPScript script = "10-configure-calico-bgp.sh"
+
+	// configureCalicoCIDRsScript configures the IP pools of Calico.
+	configureCalicoCIDRsScript script = "10-configure-calico-cidrs.sh"
+
 	// configureCalicoIPIPScript configures Calico to use IPinIP.
 	configureCalicoIPIPScript script = "10-configure-calico-ipip.sh"
 
@@ -64,16 +85,37 @@ const (
 	// configureDqlitePortScript configures the port used by dqlite.
 	configureDqlitePortScript script = "10-configure-dqlite-port.sh"
 
+	// configureRegistriesScript configures the container registries of containerd.
+	configureRegistriesScript script = "10-configure-registries.sh"
+
+	// configureServiceArgsScript configures the arguments of MicroK8s services.
+	configureServiceArgsScript script = "10-configure-service-args.sh"
+
+	// disableCalicoScript removes Calico from the node.
+	disableCalicoScript script = "10-disable-calico.sh"
+
 	// configureKubeletScript configures the kubelet.
 	configureKubeletScript script = "10-configure-kubelet.sh"
 
+	// microk8sAddAddonRepositoryScript adds a MicroK8s addon repository.
+	microk8sAddAddonRepositoryScript script = "20-microk8s-add-addon-repository.sh"
+
 	// microk8sEnableScript enables MicroK8s addons.
 	microk8sEnableScript script = "20-microk8s-enable.sh"
 
+	// publishSnapRevisionScript publishes the revision of the installed MicroK8s snap to the workload cluster.
+	publishSnapRevisionScript script = "20-publish-snap-revision.sh"
+
 	// microk8sJoinScript joins the current node to a MicroK8s cluster.
 	microk8sJoinScript script = "20-microk8s-join.sh"
 
-	// configureTraefikScript configures the control plane endpoint in the traefik provider configuration.
+	// syncJoinTokensScript registers the join tokens issued by the bootstrap provider with the cluster agent.
+	syncJoinTokensScript script = "25-microk8s-sync-join-tokens.sh"
+
+	// configureDNSScript configures the dns addon for the service CIDR and the cluster domain.
+	configureDNSScript script = "30-configure-dns.sh"
+
+	// configureTraefikScript configures the kube-apiserver addresses in the traefik provider configuration.
 	configureTraefikScript script = "30-configure-traefik.sh"
 
 	// waitAPIServerScript waits for the kube-apiserver to be ready.
@@ -83,18 +125,32 @@ const (
 var allScripts = []script{
 	snapstoreProxyScript,
 	snapstoreHTTPProxyScript,
+	configureSnapRefreshScript,
 	disableHostServicesScript,
+	reportProgressScript,
 	installMicroK8sScript,
+	installMicroK8sSnapScript,
+	importImagesScript,
 	configureCertLB,
 	configureAPIServerScript,
+	configureAPIServerNativeScript,
+	configureCalicoBGPScript,
+	configureCalicoCIDRsScript,
 	configureCalicoIPIPScript,
 	configureClusterAgentPortScript,
 	configureContainerdProxyScript,
 	configureDqlitePortScript,
+	configureDNSScript,
 	configureTraefikScript,
+	configureRegistriesScript,
+	configureServiceArgsScript,
+	disableCalicoScript,
 	configureKubeletScript,
+	microk8sAddAddonRepositoryScript,
 	microk8sEnableScript,
 	microk8sJoinScript,
+	publishSnapRevisionScript,
+	syncJoinTokensScript,
 	waitAPIServerScript,
 }
 
@@ -106,6 +162,9 @@ func mustGetScript(scriptName script) string {
 	return string(b)
 }
 
+// scriptsDir is the directory the scripts are written to on the instances.
+const scriptsDir = "/capi-scripts"
+
 func scriptPath(scriptName script) string {
-	return filepath.Join("/capi-scripts", string(scriptName))
+	return filepath.Join(scriptsDir, string(scriptName))
 }
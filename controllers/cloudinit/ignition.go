@@ -0,0 +1,229 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ignitionVersion is the Ignition specification version of the generated configs.
+	ignitionVersion = "3.3.0"
+
+	// ignitionBootCommandsUnit runs the bootcmd section on every boot, like cloud-init does.
+	ignitionBootCommandsUnit = "capi-microk8s-bootcmd.service"
+
+	// ignitionRunCommandsUnit runs the runcmd section once, on the first boot.
+	ignitionRunCommandsUnit = "capi-microk8s-runcmd.service"
+
+	// ignitionRunCommandsSentinel marks that the runcmd section has completed.
+	ignitionRunCommandsSentinel = "/var/lib/capi-microk8s/runcmd.done"
+
+	// ignitionScriptsDir replaces scriptsDir, as the root filesystem is read-only on Ignition-based
+	// distributions like Fedora CoreOS.
+	ignitionScriptsDir = "/var/lib/capi-microk8s/scripts"
+)
+
+// ignitionConfig is the subset of the Ignition v3 configuration needed to render a CloudConfig.
+// The schema matches https://coreos.github.io/ignition/configuration-v3_3/.
+type ignitionConfig struct {
+	Ignition ignitionMetadata `json:"ignition"`
+	Storage  ignitionStorage  `json:"storage,omitempty"`
+	Systemd  ignitionSystemd  `json:"systemd,omitempty"`
+}
+
+type ignitionMetadata struct {
+	Version string `json:"version"`
+}
+
+type ignitionStorage struct {
+	Files []ignitionFile `json:"files,omitempty"`
+}
+
+type ignitionFile struct {
+	Path      string           `json:"path"`
+	Overwrite bool             `json:"overwrite"`
+	Contents  ignitionContents `json:"contents"`
+	Mode      int              `json:"mode"`
+	User      *ignitionNode    `json:"user,omitempty"`
+	Group     *ignitionNode    `json:"group,omitempty"`
+}
+
+type ignitionContents struct {
+	Source      string `json:"source"`
+	Compression string `json:"compression,omitempty"`
+}
+
+type ignitionNode struct {
+	Name string `json:"name"`
+}
+
+type ignitionSystemd struct {
+	Units []ignitionUnit `json:"units,omitempty"`
+}
+
+type ignitionUnit struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Contents string `json:"contents"`
+}
+
+// GenerateIgnition generates an Ignition v3 config from a CloudConfig.
+// Files are written as-is, except for the scripts which are moved to ignitionScriptsDir. The bootcmd
+// and runcmd sections are turned into scripts that are executed by systemd units.
+func GenerateIgnition(config *CloudConfig) ([]byte, error) {
+	ign := ignitionConfig{Ignition: ignitionMetadata{Version: ignitionVersion}}
+
+	for _, f := range config.WriteFiles {
+		if strings.HasPrefix(f.Path, scriptsDir+"/") {
+			f.Path = ignitionScriptPaths(f.Path)
+			f.Content = ignitionScriptPaths(f.Content)
+		}
+		file, err := ignitionFileFrom(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render file %q: %w", f.Path, err)
+		}
+		ign.Storage.Files = append(ign.Storage.Files, file)
+	}
+
+	if len(config.BootCommands) > 0 {
+		bootScript := scriptPathForUnit(ignitionBootCommandsUnit)
+		ign.Storage.Files = append(ign.Storage.Files, ignitionScript(bootScript, config.BootCommands))
+		ign.Systemd.Units = append(ign.Systemd.Units, ignitionUnit{
+			Name:    ignitionBootCommandsUnit,
+			Enabled: true,
+			Contents: strings.Join([]string{
+				"[Unit]",
+				"Description=Cluster API MicroK8s boot commands",
+				"DefaultDependencies=no",
+				"After=local-fs.target",
+				"Before=" + ignitionRunCommandsUnit,
+				"",
+				"[Service]",
+				"Type=oneshot",
+				"RemainAfterExit=yes",
+				"ExecStart=/bin/bash " + bootScript,
+				"",
+				"[Install]",
+				"WantedBy=multi-user.target",
+				"",
+			}, "\n"),
+		})
+	}
+
+	if len(config.RunCommands) > 0 {
+		runScript := scriptPathForUnit(ignitionRunCommandsUnit)
+		ign.Storage.Files = append(ign.Storage.Files, ignitionScript(runScript, config.RunCommands))
+		ign.Systemd.Units = append(ign.Systemd.Units, ignitionUnit{
+			Name:    ignitionRunCommandsUnit,
+			Enabled: true,
+			Contents: strings.Join([]string{
+				"[Unit]",
+				"Description=Cluster API MicroK8s bootstrap commands",
+				"Wants=network-online.target",
+				"After=network-online.target",
+				"ConditionPathExists=!" + ignitionRunCommandsSentinel,
+				"",
+				"[Service]",
+				"Type=oneshot",
+				"RemainAfterExit=yes",
+				"ExecStart=/bin/bash " + runScript,
+				"ExecStartPost=/bin/mkdir -p " + filepath.Dir(ignitionRunCommandsSentinel),
+				"ExecStartPost=/bin/touch " + ignitionRunCommandsSentinel,
+				"",
+				"[Install]",
+				"WantedBy=multi-user.target",
+				"",
+			}, "\n"),
+		})
+	}
+
+	b, err := json.Marshal(ign)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render ignition: %w", err)
+	}
+	return b, nil
+}
+
+func ignitionFileFrom(f File) (ignitionFile, error) {
+	mode := 0644
+	if f.Permissions != "" {
+		m, err := strconv.ParseUint(f.Permissions, 8, 32)
+		if err != nil {
+			return ignitionFile{}, fmt.Errorf("permissions %q are not a valid octal number: %w", f.Permissions, err)
+		}
+		mode = int(m)
+	}
+
+	var contents ignitionContents
+	switch f.Encoding {
+	case "":
+		contents = ignitionContents{Source: ignitionDataURL(f.Content)}
+	case "base64":
+		contents = ignitionContents{Source: "data:;base64," + f.Content}
+	case "gzip+base64":
+		contents = ignitionContents{Source: "data:;base64," + f.Content, Compression: "gzip"}
+	default:
+		return ignitionFile{}, fmt.Errorf("encoding %q is not supported", f.Encoding)
+	}
+
+	file := ignitionFile{
+		Path:      f.Path,
+		Overwrite: true,
+		Contents:  contents,
+		Mode:      mode,
+	}
+	if f.Owner != "" {
+		user, group, _ := strings.Cut(f.Owner, ":")
+		if user != "" {
+			file.User = &ignitionNode{Name: user}
+		}
+		if group != "" {
+			file.Group = &ignitionNode{Name: group}
+		}
+	}
+	return file, nil
+}
+
+func ignitionScript(path string, commands []string) ignitionFile {
+	return ignitionFile{
+		Path:      path,
+		Overwrite: true,
+		Contents:  ignitionContents{Source: ignitionDataURL("#!/bin/bash\n" + ignitionScriptPaths(strings.Join(commands, "\n")) + "\n")},
+		Mode:      0700,
+		User:      &ignitionNode{Name: "root"},
+		Group:     &ignitionNode{Name: "root"},
+	}
+}
+
+func ignitionDataURL(content string) string {
+	return "data:;base64," + base64.StdEncoding.EncodeToString([]byte(content))
+}
+
+func scriptPathForUnit(unit string) string {
+	return filepath.Join(ignitionScriptsDir, strings.TrimSuffix(unit, ".service")+".sh")
+}
+
+// ignitionScriptPaths rewrites the paths of the scripts in s to ignitionScriptsDir.
+func ignitionScriptPaths(s string) string {
+	return strings.ReplaceAll(s, scriptsDir+"/", ignitionScriptsDir+"/")
+}
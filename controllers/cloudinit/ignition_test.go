@@ -0,0 +1,153 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/cloudinit"
+	. "github.com/onsi/gomega"
+)
+
+func TestIgnition(t *testing.T) {
+	cloudConfig := &cloudinit.CloudConfig{
+		WriteFiles: []cloudinit.File{
+			{
+				Content:     "test file",
+				Path:        "/run/a.tmp",
+				Owner:       "root:root",
+				Permissions: "0600",
+			},
+			{
+				Content:     "/capi-scripts/10-script.sh",
+				Path:        "/capi-scripts/00-script.sh",
+				Permissions: "0700",
+			},
+		},
+		RunCommands: []string{
+			"foo",
+			"bar: test",
+			"/capi-scripts/00-script.sh",
+		},
+		BootCommands: []string{
+			"baz",
+		},
+	}
+
+	t.Run("Simple", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := cloudinit.GenerateIgnition(cloudConfig)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		var ign map[string]any
+		g.Expect(json.Unmarshal(b, &ign)).To(Succeed())
+		g.Expect(ign).To(HaveKeyWithValue("ignition", map[string]any{"version": "3.3.0"}))
+
+		files := ign["storage"].(map[string]any)["files"].([]any)
+		g.Expect(files).To(HaveLen(4))
+		g.Expect(files[0]).To(Equal(map[string]any{
+			"path":      "/run/a.tmp",
+			"overwrite": true,
+			"contents":  map[string]any{"source": "data:;base64," + base64.StdEncoding.EncodeToString([]byte("test file"))},
+			"mode":      float64(0600),
+			"user":      map[string]any{"name": "root"},
+			"group":     map[string]any{"name": "root"},
+		}))
+		g.Expect(files[1]).To(HaveKeyWithValue("path", "/var/lib/capi-microk8s/scripts/00-script.sh"))
+		g.Expect(files[1]).To(HaveKeyWithValue("contents", map[string]any{"source": "data:;base64," + base64.StdEncoding.EncodeToString([]byte("/var/lib/capi-microk8s/scripts/10-script.sh"))}))
+		g.Expect(files[2]).To(HaveKeyWithValue("path", "/var/lib/capi-microk8s/scripts/capi-microk8s-bootcmd.sh"))
+		g.Expect(files[2]).To(HaveKeyWithValue("contents", map[string]any{"source": "data:;base64," + base64.StdEncoding.EncodeToString([]byte("#!/bin/bash\nbaz\n"))}))
+		g.Expect(files[3]).To(HaveKeyWithValue("path", "/var/lib/capi-microk8s/scripts/capi-microk8s-runcmd.sh"))
+		g.Expect(files[3]).To(HaveKeyWithValue("contents", map[string]any{"source": "data:;base64," + base64.StdEncoding.EncodeToString([]byte("#!/bin/bash\nfoo\nbar: test\n/var/lib/capi-microk8s/scripts/00-script.sh\n"))}))
+
+		units := ign["systemd"].(map[string]any)["units"].([]any)
+		g.Expect(units).To(HaveLen(2))
+		g.Expect(units[0]).To(HaveKeyWithValue("name", "capi-microk8s-bootcmd.service"))
+		g.Expect(units[0]).To(HaveKeyWithValue("enabled", true))
+		g.Expect(units[0].(map[string]any)["contents"]).To(ContainSubstring("ExecStart=/bin/bash /var/lib/capi-microk8s/scripts/capi-microk8s-bootcmd.sh"))
+		g.Expect(units[0].(map[string]any)["contents"]).To(ContainSubstring("After=local-fs.target"))
+		g.Expect(units[1]).To(HaveKeyWithValue("name", "capi-microk8s-runcmd.service"))
+		g.Expect(units[1].(map[string]any)["contents"]).To(ContainSubstring("ExecStart=/bin/bash /var/lib/capi-microk8s/scripts/capi-microk8s-runcmd.sh"))
+		g.Expect(units[1].(map[string]any)["contents"]).To(ContainSubstring("ConditionPathExists=!/var/lib/capi-microk8s/runcmd.done"))
+	})
+
+	t.Run("InvalidPermissions", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := cloudinit.GenerateIgnition(&cloudinit.CloudConfig{
+			WriteFiles: []cloudinit.File{{Path: "/run/a.tmp", Permissions: "rwx"}},
+		})
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("Encoding", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := cloudinit.GenerateIgnition(&cloudinit.CloudConfig{
+			WriteFiles: []cloudinit.File{
+				{Path: "/run/a.tmp", Content: "dGVzdA==", Encoding: "base64"},
+				{Path: "/run/b.tmp", Content: "H4sIAAAAAAAA/ypJLS4BAAAA//8DAAx+f9gEAAAA", Encoding: "gzip+base64"},
+			},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		var ign map[string]any
+		g.Expect(json.Unmarshal(b, &ign)).To(Succeed())
+		files := ign["storage"].(map[string]any)["files"].([]any)
+		g.Expect(files[0]).To(HaveKeyWithValue("contents", map[string]any{"source": "data:;base64,dGVzdA=="}))
+		g.Expect(files[1]).To(HaveKeyWithValue("contents", map[string]any{"source": "data:;base64,H4sIAAAAAAAA/ypJLS4BAAAA//8DAAx+f9gEAAAA", "compression": "gzip"}))
+
+		_, err = cloudinit.GenerateIgnition(&cloudinit.CloudConfig{
+			WriteFiles: []cloudinit.File{{Path: "/run/a.tmp", Content: "test", Encoding: "gzip"}},
+		})
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("Format", func(t *testing.T) {
+		for _, tc := range []struct {
+			format    v1beta1.Format
+			expectErr bool
+			isJSON    bool
+		}{
+			{format: ""},
+			{format: v1beta1.FormatCloudConfig},
+			{format: v1beta1.FormatIgnition, isJSON: true},
+			{format: "unknown", expectErr: true},
+		} {
+			t.Run(string(tc.format), func(t *testing.T) {
+				g := NewWithT(t)
+
+				b, err := cloudinit.GenerateBootstrapData(tc.format, cloudConfig)
+				if tc.expectErr {
+					g.Expect(err).To(HaveOccurred())
+					return
+				}
+				g.Expect(err).NotTo(HaveOccurred())
+				if tc.isJSON {
+					g.Expect(json.Valid(b)).To(BeTrue())
+				} else {
+					g.Expect(strings.HasPrefix(string(b), "## template: jinja\n#cloud-config\n")).To(BeTrue())
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// controlPlaneAPIServerArgs are the extra kube-apiserver arguments of all control plane nodes. The node port
+// range excludes 30000, which is used by the cluster agent when ports are remapped.
+var controlPlaneAPIServerArgs = []string{"--service-node-port-range=30001-32767"}
+
+// launchConfigurationPath is the path of the MicroK8s launch configuration. MicroK8s applies it when the
+// snap is installed, so it is written before installing MicroK8s.
+var launchConfigurationPath = filepath.Join("/var", "snap", "microk8s", "common", ".microk8s.yaml")
+
+// launchConfiguration is the MicroK8s launch configuration. Arguments with a nil value are removed.
+// See https://microk8s.io/docs/add-launch-config for the format.
+type launchConfiguration struct {
+	Version                        string             `yaml:"version"`
+	ExtraKubeletArgs               map[string]*string `yaml:"extraKubeletArgs,omitempty"`
+	ExtraKubeAPIServerArgs         map[string]*string `yaml:"extraKubeAPIServerArgs,omitempty"`
+	ExtraKubeControllerManagerArgs map[string]*string `yaml:"extraKubeControllerManagerArgs,omitempty"`
+	ExtraKubeSchedulerArgs         map[string]*string `yaml:"extraKubeSchedulerArgs,omitempty"`
+	ExtraKubeProxyArgs             map[string]*string `yaml:"extraKubeProxyArgs,omitempty"`
+	ExtraContainerdArgs            map[string]*string `yaml:"extraContainerdArgs,omitempty"`
+	ExtraDqliteArgs                map[string]*string `yaml:"extraDqliteArgs,omitempty"`
+	ExtraContainerdEnv             map[string]string  `yaml:"extraContainerdEnv,omitempty"`
+}
+
+// nodeConfiguration is the configuration of the MicroK8s services of a node.
+type nodeConfiguration struct {
+	// kubeletArgs are extra arguments for the kubelet, e.g. "--max-pods=250".
+	kubeletArgs []string
+	// nodeLabels and nodeTaints are registered by the kubelet when the node joins the cluster.
+	nodeLabels map[string]string
+	nodeTaints []Taint
+	// apiServerArgs are extra arguments for the kube-apiserver. They are only set on control plane nodes.
+	apiServerArgs []string
+	// apiServerPort is the port that kube-apiserver binds to, if set. It is only applied with a launch
+	// configuration, older versions configure the port with the apiserver scripts.
+	apiServerPort string
+	// serviceArgs are the arguments to add to and remove from the MicroK8s services, keyed by service name.
+	serviceArgs map[string]ServiceArgs
+
+	httpProxy  string
+	httpsProxy string
+	noProxy    string
+}
+
+// nativeAPIServerPort returns the apiserver port to set in the launch configuration of a control plane node.
+func nativeAPIServerPort(native bool, port string) string {
+	if !native {
+		return ""
+	}
+	return port
+}
+
+// supportsLaunchConfiguration returns true if MicroK8s applies a launch configuration when installed.
+func supportsLaunchConfiguration(kubernetesVersion *version.Version) bool {
+	return kubernetesVersion.Minor() >= 27
+}
+
+// configureNode returns the files and commands that configure the MicroK8s services of a node. On versions
+// that support it, a launch configuration is rendered and no commands are needed. Older versions patch the
+// service arguments with scripts after MicroK8s is installed, which restarts the services.
+func configureNode(kubernetesVersion *version.Version, config nodeConfiguration) ([]File, []string, error) {
+	if err := validateServiceArgs(config.serviceArgs); err != nil {
+		return nil, nil, err
+	}
+	registrationArgs, err := nodeRegistrationArgs(config.nodeLabels, config.nodeTaints)
+	if err != nil {
+		return nil, nil, err
+	}
+	kubeletArgs := append(append([]string(nil), config.kubeletArgs...), registrationArgs...)
+
+	if !supportsLaunchConfiguration(kubernetesVersion) {
+		files, commands := configureServiceArgs(config.serviceArgs)
+		if len(kubeletArgs) > 0 {
+			files = append(files, File{
+				Content:     strings.Join(kubeletArgs, "\n"),
+				Path:        filepath.Join("/var", "tmp", "extra-kubelet-args"),
+				Permissions: "0400",
+				Owner:       "root:root",
+			})
+		}
+		return files, append([]string{
+			fmt.Sprintf("%s %q %q %q", scriptPath(configureContainerdProxyScript), config.httpProxy, config.httpsProxy, config.noProxy),
+			scriptPath(configureKubeletScript),
+		}, commands...), nil
+	}
+
+	apiServerArgs := append(append([]string(nil), config.apiServerArgs...), config.serviceArgs[APIServerService].Args...)
+	if config.apiServerPort != "" {
+		apiServerArgs = append(apiServerArgs, "--secure-port="+config.apiServerPort)
+	}
+	launchConfig := launchConfiguration{
+		Version:                        "0.1.0",
+		ExtraKubeletArgs:               argsToMap(kubeletArgs, nil),
+		ExtraKubeAPIServerArgs:         argsToMap(apiServerArgs, config.serviceArgs[APIServerService].Remove),
+		ExtraKubeControllerManagerArgs: argsToMap(config.serviceArgs[ControllerManagerService].Args, config.serviceArgs[ControllerManagerService].Remove),
+		ExtraKubeSchedulerArgs:         argsToMap(config.serviceArgs[SchedulerService].Args, config.serviceArgs[SchedulerService].Remove),
+		ExtraKubeProxyArgs:             argsToMap(config.serviceArgs[KubeProxyService].Args, config.serviceArgs[KubeProxyService].Remove),
+		ExtraContainerdArgs:            argsToMap(config.serviceArgs[ContainerdService].Args, config.serviceArgs[ContainerdService].Remove),
+		ExtraDqliteArgs:                argsToMap(config.serviceArgs[K8sDqliteService].Args, config.serviceArgs[K8sDqliteService].Remove),
+	}
+	for _, env := range []struct{ name, value string }{
+		{"http_proxy", config.httpProxy},
+		{"https_proxy", config.httpsProxy},
+		{"no_proxy", config.noProxy},
+	} {
+		if env.value == "" {
+			continue
+		}
+		if launchConfig.ExtraContainerdEnv == nil {
+			launchConfig.ExtraContainerdEnv = make(map[string]string, 6)
+		}
+		launchConfig.ExtraContainerdEnv[env.name] = env.value
+		launchConfig.ExtraContainerdEnv[strings.ToUpper(env.name)] = env.value
+	}
+
+	b, err := yaml.Marshal(launchConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to render launch configuration: %w", err)
+	}
+	files := []File{{
+		Content:     string(b),
+		Path:        launchConfigurationPath,
+		Permissions: "0600",
+		Owner:       "root:root",
+	}}
+
+	// the launch configuration does not cover the cluster agent
+	var commands []string
+	if args, ok := config.serviceArgs[ClusterAgentService]; ok {
+		agentFiles, agentCommands := configureServiceArgs(map[string]ServiceArgs{ClusterAgentService: args})
+		files = append(files, agentFiles...)
+		commands = agentCommands
+	}
+	return files, commands, nil
+}
+
+// argsToMap converts command-line arguments like "--key=value" or "--key value" to a map. Arguments
+// without a value are set to "true". The flags to remove are set to nil.
+func argsToMap(args []string, remove []string) map[string]*string {
+	if len(args) == 0 && len(remove) == 0 {
+		return nil
+	}
+	result := make(map[string]*string, len(args)+len(remove))
+	for _, flag := range remove {
+		result[flag] = nil
+	}
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		key, value, found := strings.Cut(arg, "=")
+		if !found {
+			key, value, found = strings.Cut(arg, " ")
+		}
+		if !found {
+			value = "true"
+		}
+		value = strings.TrimSpace(value)
+		result[strings.TrimSpace(key)] = &value
+	}
+	return result
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+// parseCIDRs parses a pod or service CIDR. An empty value is not an error and returns no CIDRs.
+func parseCIDRs(kind string, cidrs string) ([]*net.IPNet, error) {
+	if cidrs == "" {
+		return nil, nil
+	}
+	result, err := bootstrapclusterxk8siov1beta1.ParseDualStackCIDRs(cidrs)
+	if err != nil {
+		return nil, fmt.Errorf("%s %q is invalid: %w", kind, cidrs, err)
+	}
+	return result, nil
+}
+
+// clusterNetworkServiceArgs returns the arguments of the MicroK8s services that configure the pod and service
+// CIDRs. The extra arguments of the services are added after them, so they take precedence.
+func clusterNetworkServiceArgs(podCIDR string, serviceCIDR string, extraServiceArgs map[string]ServiceArgs) (map[string]ServiceArgs, error) {
+	if _, err := parseCIDRs("pod CIDR", podCIDR); err != nil {
+		return nil, err
+	}
+	if _, err := parseCIDRs("service CIDR", serviceCIDR); err != nil {
+		return nil, err
+	}
+	if podCIDR == "" && serviceCIDR == "" {
+		return extraServiceArgs, nil
+	}
+
+	args := make(map[string][]string)
+	if podCIDR != "" {
+		args[ControllerManagerService] = append(args[ControllerManagerService], "--cluster-cidr="+podCIDR)
+		args[KubeProxyService] = append(args[KubeProxyService], "--cluster-cidr="+podCIDR)
+	}
+	if serviceCIDR != "" {
+		args[APIServerService] = append(args[APIServerService], "--service-cluster-ip-range="+serviceCIDR)
+		args[ControllerManagerService] = append(args[ControllerManagerService], "--service-cluster-ip-range="+serviceCIDR)
+	}
+
+	result := make(map[string]ServiceArgs, len(extraServiceArgs)+len(args))
+	for service, serviceArgs := range extraServiceArgs {
+		result[service] = serviceArgs
+	}
+	for service, networkArgs := range args {
+		serviceArgs := result[service]
+		serviceArgs.Args = append(networkArgs, serviceArgs.Args...)
+		result[service] = serviceArgs
+	}
+	return result, nil
+}
+
+// configureCalicoCIDRsCommands returns the commands that configure the IP pools of Calico for the pod CIDR.
+func configureCalicoCIDRsCommands(podCIDR string) ([]string, error) {
+	cidrs, err := parseCIDRs("pod CIDR", podCIDR)
+	if err != nil || len(cidrs) == 0 {
+		return nil, err
+	}
+	var ipv6CIDR string
+	if len(cidrs) > 1 {
+		ipv6CIDR = cidrs[1].String()
+	}
+	return []string{fmt.Sprintf("%s %q %q", scriptPath(configureCalicoCIDRsScript), cidrs[0].String(), ipv6CIDR)}, nil
+}
+
+// certSANs returns the extra subject alternative names of the server certificate, as "IP:<address>" or
+// "DNS:<name>". These are the control plane endpoint, the IPs of the kubernetes service and the extra SANs of
+// the cluster configuration, without duplicates.
+func certSANs(controlPlaneEndpoint string, serviceCIDR string, extraSANs []string) ([]string, error) {
+	cidrs, err := parseCIDRs("service CIDR", serviceCIDR)
+	if err != nil {
+		return nil, err
+	}
+
+	var sans []string
+	seen := make(map[string]struct{}, len(extraSANs)+3)
+	add := func(san string) {
+		if _, ok := seen[san]; !ok {
+			seen[san] = struct{}{}
+			sans = append(sans, san)
+		}
+	}
+	if endpoint := strings.TrimSuffix(strings.TrimPrefix(controlPlaneEndpoint, "["), "]"); endpoint != "" {
+		if ip := net.ParseIP(endpoint); ip != nil {
+			add("IP:" + ip.String())
+		} else {
+			add("DNS:" + endpoint)
+		}
+	}
+	// the server certificate of MicroK8s is always valid for the kubernetes service of the default service CIDR
+	for _, cidr := range cidrs {
+		if cidr.String() != bootstrapclusterxk8siov1beta1.DefaultServiceCIDR {
+			add("IP:" + nthIP(cidr, 1).String())
+		}
+	}
+	for _, extraSAN := range extraSANs {
+		san, err := bootstrapclusterxk8siov1beta1.ParseCertSAN(extraSAN)
+		if err != nil {
+			return nil, fmt.Errorf("certificate SAN %q is invalid: %w", extraSAN, err)
+		}
+		add(san)
+	}
+	return sans, nil
+}
+
+// configureCertSANsCommand returns the command that adds the extra subject alternative names to the server
+// certificate.
+func configureCertSANsCommand(controlPlaneEndpoint string, serviceCIDR string, extraSANs []string) (string, error) {
+	sans, err := certSANs(controlPlaneEndpoint, serviceCIDR, extraSANs)
+	if err != nil {
+		return "", err
+	}
+	args := make([]string, 0, len(sans))
+	for _, san := range sans {
+		args = append(args, fmt.Sprintf("%q", san))
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s", scriptPath(configureCertLB), strings.Join(args, " "))), nil
+}
+
+// KubernetesServiceIP returns the IP of the kubernetes service, which is the first IP of the service CIDR.
+// The default service CIDR of MicroK8s is used if serviceCIDR is empty. For dual-stack clusters, this is the
+// IP of the IPv4 CIDR.
+func KubernetesServiceIP(serviceCIDR string) (string, error) {
+	if serviceCIDR == "" {
+		serviceCIDR = bootstrapclusterxk8siov1beta1.DefaultServiceCIDR
+	}
+	cidrs, err := parseCIDRs("service CIDR", serviceCIDR)
+	if err != nil {
+		return "", err
+	}
+	return nthIP(cidrs[0], 1).String(), nil
+}
+
+// clusterDNSIP returns the IP of the kube-dns service. Like with the default service CIDR of MicroK8s, this is
+// the tenth IP of the service CIDR.
+func clusterDNSIP(serviceCIDR string) (string, error) {
+	if serviceCIDR == "" {
+		serviceCIDR = bootstrapclusterxk8siov1beta1.DefaultServiceCIDR
+	}
+	cidrs, err := parseCIDRs("service CIDR", serviceCIDR)
+	if err != nil {
+		return "", err
+	}
+	return nthIP(cidrs[0], 10).String(), nil
+}
+
+// nthIP returns the n-th IP of a CIDR.
+func nthIP(cidr *net.IPNet, n int) net.IP {
+	ip := make(net.IP, len(cidr.IP))
+	copy(ip, cidr.IP)
+	for i := len(ip) - 1; i >= 0 && n > 0; i-- {
+		sum := int(ip[i]) + n
+		ip[i] = byte(sum % 256)
+		n = sum / 256
+	}
+	return ip
+}
+
+// clusterDNSKubeletArgs returns the kubelet arguments that configure the cluster DNS for the service CIDR and
+// the cluster domain. No arguments are returned for the defaults of MicroK8s.
+func clusterDNSKubeletArgs(serviceCIDR string, clusterDomain string) ([]string, error) {
+	if err := validateClusterDomain(clusterDomain); err != nil {
+		return nil, err
+	}
+	var args []string
+	if serviceCIDR != "" {
+		dnsIP, err := clusterDNSIP(serviceCIDR)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--cluster-dns="+dnsIP)
+	}
+	if clusterDomain != "" {
+		args = append(args, "--cluster-domain="+clusterDomain)
+	}
+	return args, nil
+}
+
+// configureClusterDNSCommands returns the commands that configure the dns addon for the service CIDR and the
+// cluster domain, after the addons are enabled.
+func configureClusterDNSCommands(serviceCIDR string, clusterDomain string) ([]string, error) {
+	if serviceCIDR == "" && clusterDomain == "" {
+		return nil, nil
+	}
+	if err := validateClusterDomain(clusterDomain); err != nil {
+		return nil, err
+	}
+	dnsIP, err := clusterDNSIP(serviceCIDR)
+	if err != nil {
+		return nil, err
+	}
+	if clusterDomain == "" {
+		clusterDomain = bootstrapclusterxk8siov1beta1.DefaultClusterDomain
+	}
+	return []string{fmt.Sprintf("%s %q %q", scriptPath(configureDNSScript), dnsIP, clusterDomain)}, nil
+}
+
+// validateClusterDomain validates the DNS domain of the cluster. An empty domain is valid.
+func validateClusterDomain(clusterDomain string) error {
+	if clusterDomain == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(clusterDomain); len(errs) > 0 {
+		return fmt.Errorf("cluster domain %q is invalid: %s", clusterDomain, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// joinURL returns the URL that MicroK8s joins a cluster with, e.g. "10.0.0.10:25000/token". IPv6 addresses
+// are enclosed in brackets.
+func joinURL(address string, clusterAgentPort string, token string) string {
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(address, clusterAgentPort), token)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+// Taint is a taint that the kubelet registers the node with.
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string
+}
+
+// TaintsFromAPI returns the taints to register a node with.
+func TaintsFromAPI(taints []corev1.Taint) []Taint {
+	if len(taints) == 0 {
+		return nil
+	}
+	result := make([]Taint, 0, len(taints))
+	for _, taint := range taints {
+		result = append(result, Taint{Key: taint.Key, Value: taint.Value, Effect: string(taint.Effect)})
+	}
+	return result
+}
+
+// nodeRegistrationArgs returns the kubelet arguments that register the node with the given labels and taints.
+func nodeRegistrationArgs(labels map[string]string, taints []Taint) ([]string, error) {
+	var args []string
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for key, value := range labels {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return nil, fmt.Errorf("node label %q is invalid: %s", key, strings.Join(errs, "; "))
+			}
+			if bootstrapclusterxk8siov1beta1.IsRestrictedNodeLabel(key) {
+				return nil, fmt.Errorf("node label %q uses a restricted kubernetes.io or k8s.io prefix", key)
+			}
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				return nil, fmt.Errorf("value %q of node label %q is invalid: %s", value, key, strings.Join(errs, "; "))
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			pairs = append(pairs, key+"="+labels[key])
+		}
+		args = append(args, "--node-labels="+strings.Join(pairs, ","))
+	}
+
+	if len(taints) > 0 {
+		specs := make([]string, 0, len(taints))
+		for _, taint := range taints {
+			if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+				return nil, fmt.Errorf("node taint %q is invalid: %s", taint.Key, strings.Join(errs, "; "))
+			}
+			if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+				return nil, fmt.Errorf("value %q of node taint %q is invalid: %s", taint.Value, taint.Key, strings.Join(errs, "; "))
+			}
+			switch corev1.TaintEffect(taint.Effect) {
+			case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+			default:
+				return nil, fmt.Errorf("effect %q of node taint %q must be NoSchedule, PreferNoSchedule or NoExecute", taint.Effect, taint.Key)
+			}
+			spec := taint.Key
+			if taint.Value != "" {
+				spec += "=" + taint.Value
+			}
+			specs = append(specs, spec+":"+taint.Effect)
+		}
+		args = append(args, "--register-with-taints="+strings.Join(specs, ","))
+	}
+	return args, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/progress"
+)
+
+// progressReportConfigPath is the path of the configuration of the 00-report-progress.sh script.
+var progressReportConfigPath = filepath.Join("/var", "tmp", "progress-report.env")
+
+// progressTokenRegexp matches the tokens that nodes report their progress with.
+var progressTokenRegexp = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// ProgressReport configures reporting the bootstrap progress of the node to the management cluster.
+type ProgressReport struct {
+	// URL is the URL that the node reports its progress to. Progress is not reported if empty.
+	URL string
+	// Token authenticates the progress reports of the node.
+	Token string
+}
+
+// configureProgressReport returns the files that configure reporting the progress of the node.
+func configureProgressReport(report ProgressReport) ([]File, error) {
+	if report.URL == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(report.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(report.URL, "\"$\\`") {
+		return nil, fmt.Errorf("progress report URL %q must be an http(s) URL", report.URL)
+	}
+	if !progressTokenRegexp.MatchString(report.Token) {
+		return nil, fmt.Errorf("progress report token must be alphanumeric")
+	}
+	return []File{{
+		Content:     fmt.Sprintf("PROGRESS_URL=%q\nPROGRESS_TOKEN=%q\n", report.URL, report.Token),
+		Path:        progressReportConfigPath,
+		Permissions: "0600",
+		Owner:       "root:root",
+	}}, nil
+}
+
+// reportProgressCommands returns the commands of a bootstrap step, which report a failure if they fail, followed
+// by the command that reports the step as succeeded. The commands are returned unchanged if progress is not
+// reported.
+func reportProgressCommands(report ProgressReport, step string, commands ...string) []string {
+	if report.URL == "" {
+		return commands
+	}
+	result := make([]string, 0, len(commands)+1)
+	for _, command := range commands {
+		result = append(result, fmt.Sprintf("%s %s run %s", scriptPath(reportProgressScript), step, command))
+	}
+	return append(result, fmt.Sprintf("%s %s %s", scriptPath(reportProgressScript), step, progress.StatusSucceeded))
+}
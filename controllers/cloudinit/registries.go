@@ -0,0 +1,125 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+// registriesDir is where the containerd registry configurations are staged. They are copied to
+// /var/snap/microk8s/current/args/certs.d after MicroK8s is installed.
+var registriesDir = filepath.Join("/var", "tmp", "certs.d")
+
+// Registry configures how containerd pulls images from a container registry.
+type Registry struct {
+	// Host is the registry, e.g. "docker.io", or "_default" for all registries.
+	Host string
+	// Mirrors are http(s) endpoints to pull images from, in order of preference.
+	Mirrors []string
+	// CABundle is a PEM-encoded bundle of CA certificates to verify the registry and its mirrors.
+	CABundle string
+	// SkipVerify disables the verification of the TLS certificates of the registry and its mirrors.
+	SkipVerify bool
+	// Username and Password authenticate to the registry and its mirrors. No credentials are used if empty.
+	Username string
+	Password string
+}
+
+// registryServer returns the URL of the upstream server of a registry host.
+func registryServer(host string) string {
+	if host == "docker.io" {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + host
+}
+
+// renderHostsTOML renders the containerd hosts.toml of a registry. caPath is the path of the CA bundle
+// on the node, or empty if there is none.
+func renderHostsTOML(registry Registry, caPath string) string {
+	var b strings.Builder
+	writeHostSettings := func(indent string, table string) {
+		if caPath != "" {
+			fmt.Fprintf(&b, "%sca = %q\n", indent, caPath)
+		}
+		if registry.SkipVerify {
+			fmt.Fprintf(&b, "%sskip_verify = true\n", indent)
+		}
+		if registry.Username != "" || registry.Password != "" {
+			auth := base64.StdEncoding.EncodeToString([]byte(registry.Username + ":" + registry.Password))
+			fmt.Fprintf(&b, "%s[%s]\n", indent, table)
+			fmt.Fprintf(&b, "%s  authorization = %q\n", indent, "Basic "+auth)
+		}
+	}
+
+	if registry.Host != "_default" {
+		fmt.Fprintf(&b, "server = %q\n", registryServer(registry.Host))
+		writeHostSettings("", "header")
+	}
+	for _, mirror := range registry.Mirrors {
+		fmt.Fprintf(&b, "\n[host.%q]\n", mirror)
+		fmt.Fprintf(&b, "  capabilities = [\"pull\", \"resolve\"]\n")
+		writeHostSettings("  ", fmt.Sprintf("host.%q.header", mirror))
+	}
+	return b.String()
+}
+
+// configureRegistries returns the files and commands that configure the container registries.
+func configureRegistries(registries []Registry) ([]File, []string, error) {
+	if len(registries) == 0 {
+		return nil, nil, nil
+	}
+
+	var files []File
+	seen := make(map[string]struct{}, len(registries))
+	for _, registry := range registries {
+		if !bootstrapclusterxk8siov1beta1.IsRegistryHost(registry.Host) {
+			return nil, nil, fmt.Errorf("registry host %q is invalid", registry.Host)
+		}
+		if _, ok := seen[registry.Host]; ok {
+			return nil, nil, fmt.Errorf("registry %q is configured more than once", registry.Host)
+		}
+		seen[registry.Host] = struct{}{}
+		for _, mirror := range registry.Mirrors {
+			if !bootstrapclusterxk8siov1beta1.IsRegistryMirror(mirror) {
+				return nil, nil, fmt.Errorf("mirror %q of registry %q must be an http(s) URL", mirror, registry.Host)
+			}
+		}
+
+		var caPath string
+		if registry.CABundle != "" {
+			caPath = filepath.Join("/var", "snap", "microk8s", "current", "args", "certs.d", registry.Host, "ca.crt")
+			files = append(files, File{
+				Content:     registry.CABundle,
+				Path:        filepath.Join(registriesDir, registry.Host, "ca.crt"),
+				Permissions: "0644",
+				Owner:       "root:root",
+			})
+		}
+		files = append(files, File{
+			Content:     renderHostsTOML(registry, caPath),
+			Path:        filepath.Join(registriesDir, registry.Host, "hosts.toml"),
+			Permissions: "0600",
+			Owner:       "root:root",
+		})
+	}
+	return files, []string{scriptPath(configureRegistriesScript)}, nil
+}
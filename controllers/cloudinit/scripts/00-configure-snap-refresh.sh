@@ -0,0 +1,24 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0 $refresh_hold $refresh_timer
+#
+# $refresh_hold is "forever" or an RFC3339 time until which snap refreshes are held. Not changed if empty.
+# $refresh_timer is the window in which snaps are refreshed, e.g. "sat,02:00-04:00". Not changed if empty.
+#
+# Assumptions:
+#   - snapd is installed
+
+if [ -n "${1}" ]; then
+  while ! snap set system refresh.hold="${1}"; do
+    echo "Failed to hold snap refreshes, will retry"
+    sleep 5
+  done
+fi
+
+if [ -n "${2}" ]; then
+  while ! snap set system refresh.timer="${2}"; do
+    echo "Failed to set snap refresh timer, will retry"
+    sleep 5
+  done
+fi
@@ -0,0 +1,41 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0 $snap $assertion $microk8s_snap_args
+#
+# $snap and $assertion are paths on the machine or http(s) URLs to download them from.
+# If $assertion is empty, the snap is installed without signature verification.
+#
+# Assumptions:
+#   - snapd is installed
+#   - curl is installed, if $snap or $assertion is a URL
+
+if snap list microk8s; then
+  echo "MicroK8s is already installed, will not install"
+  exit 0
+fi
+
+fetch() {
+  if [[ "${1}" != http://* && "${1}" != https://* ]]; then
+    cp "${1}" "${2}"
+    return
+  fi
+  while ! curl --fail --silent --show-error --location --output "${2}" "${1}"; do
+    echo "Failed to download ${1}, will retry"
+    sleep 5
+  done
+}
+
+fetch "${1}" /var/tmp/microk8s.snap
+install_args="--dangerous"
+if [ -n "${2}" ]; then
+  fetch "${2}" /var/tmp/microk8s.assert
+  snap ack /var/tmp/microk8s.assert
+  install_args=""
+fi
+
+while ! snap install /var/tmp/microk8s.snap ${install_args} ${3}; do
+  echo "Failed to install MicroK8s snap, will retry"
+  /capi-scripts/00-report-progress.sh install failed "Failed to install MicroK8s snap, will retry"
+  sleep 5
+done
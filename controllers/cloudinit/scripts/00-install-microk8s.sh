@@ -13,5 +13,6 @@ fi
 
 while ! snap install microk8s ${1}; do
   echo "Failed to install MicroK8s snap, will retry"
+  /capi-scripts/00-report-progress.sh install failed "Failed to install MicroK8s snap, will retry"
   sleep 5
 done
@@ -0,0 +1,56 @@
+#!/bin/bash -e
+
+# Usage:
+#   $0 $step run $command...
+#   $0 $step failed $message
+#   $0 $step succeeded
+#
+# Reports the progress of a bootstrap step to the management cluster. Nothing is reported if progress
+# reporting is not configured. With "run", the command is run and a failure is reported if it fails.
+# A step is not reported as succeeded if one of its commands failed.
+#
+# Assumptions:
+#   - curl is installed
+#
+# Does not use -x, to not write the token to the cloud-init logs.
+
+CONFIG="/var/tmp/progress-report.env"
+FAILED_DIR="/var/tmp/progress-report-failed"
+
+step="${1}"
+status="${2}"
+shift 2
+
+report() {
+  if [ ! -f "${CONFIG}" ]; then
+    return 0
+  fi
+  source "${CONFIG}"
+  curl --silent --show-error --fail --max-time 10 --retry 3 \
+    -H "Authorization: Bearer ${PROGRESS_TOKEN}" \
+    --data-urlencode "step=${step}" \
+    --data-urlencode "status=${1}" \
+    --data-urlencode "message=${2}" \
+    "${PROGRESS_URL}" || echo "Failed to report progress of step ${step}"
+}
+
+case "${status}" in
+  run)
+    code=0
+    "$@" || code=$?
+    if [ "${code}" != 0 ]; then
+      mkdir -p "${FAILED_DIR}"
+      touch "${FAILED_DIR}/${step}"
+      report failed "Command ${1} failed with exit code ${code}"
+    fi
+    exit "${code}"
+    ;;
+  failed)
+    report failed "${1}"
+    ;;
+  succeeded)
+    if [ ! -f "${FAILED_DIR}/${step}" ]; then
+      report succeeded ""
+    fi
+    ;;
+esac
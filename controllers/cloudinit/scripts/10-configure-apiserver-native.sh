@@ -0,0 +1,46 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0 $apiserver_port
+#
+# Assumptions:
+#   - microk8s is installed
+#
+# Unlike 10-configure-apiserver.sh, port 16443 is not redirected to the apiserver port, so neither
+# iptables nor a package manager is needed on the host.
+
+APISERVER_ARGS="${APISERVER_ARGS:-/var/snap/microk8s/current/args/kube-apiserver}"
+CREDENTIALS_DIR="${CREDENTIALS_DIR:-/var/snap/microk8s/current/credentials}"
+
+# Configure command-line arguments for kube-apiserver, unless set by the launch configuration
+if ! grep -q -- "--service-node-port-range" "${APISERVER_ARGS}"; then
+  echo "
+--service-node-port-range=30001-32767
+" >> "${APISERVER_ARGS}"
+fi
+
+# Configure apiserver port
+if grep -q -- "--secure-port" "${APISERVER_ARGS}"; then
+  sed "s/^--secure-port=.*/--secure-port=${1}/" -i "${APISERVER_ARGS}"
+else
+  echo "--secure-port=${1}" >> "${APISERVER_ARGS}"
+fi
+
+# Configure apiserver port for service config files
+for config in client scheduler kubelet proxy controller; do
+  sed "s/:16443/:${1}/" -i "${CREDENTIALS_DIR}/${config}.config"
+done
+
+while ! snap set microk8s hack.update.csr=call$$; do
+  echo "Failed to call the configure hook, will retry"
+  sleep 5
+done
+sleep 10
+
+while ! snap restart microk8s.daemon-kubelite; do
+  sleep 5
+done
+
+# delete kubernetes service to make sure port is updated
+/capi-scripts/50-wait-apiserver.sh
+microk8s kubectl delete svc kubernetes
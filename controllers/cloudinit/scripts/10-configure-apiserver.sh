@@ -1,7 +1,7 @@
 #!/bin/bash -xe
 
 # Usage:
-#   $0
+#   $0 $apiserver_port
 #
 # Assumptions:
 #   - microk8s is installed
@@ -11,20 +11,22 @@
 APISERVER_ARGS="${APISERVER_ARGS:-/var/snap/microk8s/current/args/kube-apiserver}"
 CREDENTIALS_DIR="${CREDENTIALS_DIR:-/var/snap/microk8s/current/credentials}"
 
-# Configure command-line arguments for kube-apiserver
-echo "
+# Configure command-line arguments for kube-apiserver, unless set by the launch configuration
+if ! grep -q -- "--service-node-port-range" "${APISERVER_ARGS}"; then
+  echo "
 --service-node-port-range=30001-32767
 " >> "${APISERVER_ARGS}"
+fi
 
 # Configure apiserver port
-sed 's/16443/6443/' -i "${APISERVER_ARGS}"
+sed "s/16443/${1}/" -i "${APISERVER_ARGS}"
 
 # Configure apiserver port for service config files
-sed 's/16443/6443/' -i "${CREDENTIALS_DIR}/client.config"
-sed 's/16443/6443/' -i "${CREDENTIALS_DIR}/scheduler.config"
-sed 's/16443/6443/' -i "${CREDENTIALS_DIR}/kubelet.config"
-sed 's/16443/6443/' -i "${CREDENTIALS_DIR}/proxy.config"
-sed 's/16443/6443/' -i "${CREDENTIALS_DIR}/controller.config"
+sed "s/16443/${1}/" -i "${CREDENTIALS_DIR}/client.config"
+sed "s/16443/${1}/" -i "${CREDENTIALS_DIR}/scheduler.config"
+sed "s/16443/${1}/" -i "${CREDENTIALS_DIR}/kubelet.config"
+sed "s/16443/${1}/" -i "${CREDENTIALS_DIR}/proxy.config"
+sed "s/16443/${1}/" -i "${CREDENTIALS_DIR}/controller.config"
 
 while ! snap set microk8s hack.update.csr=call$$; do
   echo "Failed to call the configure hook, will retry"
@@ -40,9 +42,11 @@ done
 /capi-scripts/50-wait-apiserver.sh
 microk8s kubectl delete svc kubernetes
 
-# redirect port 16443 to 6443
-iptables -t nat -A OUTPUT -o lo -p tcp --dport 16443 -j REDIRECT --to-port 6443
-iptables -t nat -A PREROUTING   -p tcp --dport 16443 -j REDIRECT --to-port 6443
+# redirect port 16443 to the apiserver port
+if [ "${1}" != "16443" ]; then
+  iptables -t nat -A OUTPUT -o lo -p tcp --dport 16443 -j REDIRECT --to-port "${1}"
+  iptables -t nat -A PREROUTING   -p tcp --dport 16443 -j REDIRECT --to-port "${1}"
+fi
 
 # ensure rules persist across reboots
 apt-get update
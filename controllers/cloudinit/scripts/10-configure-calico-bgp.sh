@@ -0,0 +1,31 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0
+#
+# Assumptions:
+#   - microk8s is installed
+#   - calico is installed
+#   - the current node is not part of a cluster (yet)
+
+CNI_YAML="/var/snap/microk8s/current/args/cni-network/cni.yaml"
+
+if [ ! -f "${CNI_YAML}" ]; then
+  echo "Will not configure Calico, missing cni.yaml"
+  exit 0
+fi
+
+/capi-scripts/50-wait-apiserver.sh
+
+# Stop calico-node and delete ippools to ensure no vxlan pools are left around
+microk8s kubectl delete daemonset/calico-node -n kube-system || true
+microk8s kubectl delete ippools --all || true
+
+# Update cni.yaml manifest to route pod traffic with BGP, without encapsulation
+sed '/- name: CALICO_IPV4POOL_VXLAN/{n;s|value: .*|value: "Never"|}' -i "${CNI_YAML}"
+sed 's/calico_backend: "vxlan"/calico_backend: "bird"/' -i "${CNI_YAML}"
+sed 's/-felix-ready/-bird-ready/' -i "${CNI_YAML}"
+sed 's/-felix-live/-bird-live/' -i "${CNI_YAML}"
+
+# Apply the new manifest
+microk8s kubectl apply -f "${CNI_YAML}"
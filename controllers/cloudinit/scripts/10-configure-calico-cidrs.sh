@@ -0,0 +1,37 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0 $ipv4_cidr $ipv6_cidr
+#
+# The IPv6 CIDR is optional. If set, Calico assigns both IPv4 and IPv6 addresses to pods.
+#
+# Assumptions:
+#   - microk8s is installed
+#   - calico is installed
+#   - the current node is not part of a cluster (yet)
+
+CNI_YAML="/var/snap/microk8s/current/args/cni-network/cni.yaml"
+
+if [ ! -f "${CNI_YAML}" ]; then
+  echo "Will not configure Calico, missing cni.yaml"
+  exit 0
+fi
+
+/capi-scripts/50-wait-apiserver.sh
+
+# Stop calico-node and delete ippools to ensure the default pools are not left around
+microk8s kubectl delete daemonset/calico-node -n kube-system || true
+microk8s kubectl delete ippools --all || true
+
+# Update cni.yaml manifest for the IPv4 pool
+sed '/- name: CALICO_IPV4POOL_CIDR/{n;s|value: .*|value: "'"${1}"'"|}' -i "${CNI_YAML}"
+
+# Update cni.yaml manifest for the IPv6 pool
+if [ -n "${2}" ]; then
+  sed 's|"type": "calico-ipam"|"type": "calico-ipam", "assign_ipv4": "true", "assign_ipv6": "true"|' -i "${CNI_YAML}"
+  sed -E 's|^( *)- name: CALICO_IPV4POOL_CIDR$|\1- name: IP6\n\1  value: "autodetect"\n\1- name: CALICO_IPV6POOL_CIDR\n\1  value: "'"${2}"'"\n&|' -i "${CNI_YAML}"
+  sed '/- name: FELIX_IPV6SUPPORT/{n;s|value: .*|value: "true"|}' -i "${CNI_YAML}"
+fi
+
+# Apply the new manifest
+microk8s kubectl apply -f "${CNI_YAML}"
@@ -1,16 +1,23 @@
 #!/bin/bash -xe
 
 # Usage:
-#   $0 $endpoint_type $endpoint
+#   $0 $san...
+#
+# Each $san is "IP:$address" or "DNS:$name", e.g. "DNS:k8s.example.com" or "IP:fd00::10".
 #
 # Assumptions:
 #   - microk8s is installed
 
 CSR_CONF="${CSR_CONF:-/var/snap/microk8s/current/certs/csr.conf.template}"
 
-# Configure SAN for the control plane endpoint
+# Configure SANs for the control plane endpoint, the kubernetes service and the extra SANs
+# Each SAN gets its own index, starting after the ones of the MicroK8s template
 # The apiservice-kicker will recreate the certificates and restart the service as needed
-sed "/^DNS.1 = kubernetes/a${1}.100 = ${2}" -i "${CSR_CONF}"
+index=100
+for san in "$@"; do
+  sed "/^DNS.1 = kubernetes/a${san%%:*}.${index} = ${san#*:}" -i "${CSR_CONF}"
+  index=$((index + 1))
+done
 sleep 10
 
 while ! snap set microk8s hack.update.csr=call$$; do
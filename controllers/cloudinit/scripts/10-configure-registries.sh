@@ -0,0 +1,19 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0
+#
+# Assumptions:
+#   - microk8s is installed
+#   - /var/tmp/certs.d has a directory with a hosts.toml for each registry
+
+STAGED_CERTS_DIR="/var/tmp/certs.d"
+CERTS_DIR="/var/snap/microk8s/current/args/certs.d"
+
+# containerd reads the registry configuration when pulling images, so no restart is needed
+mkdir -p "${CERTS_DIR}"
+for dir in "${STAGED_CERTS_DIR}"/*/; do
+  host="$(basename "${dir}")"
+  rm -rf "${CERTS_DIR:?}/${host}"
+  cp -r "${dir}" "${CERTS_DIR}/${host}"
+done
@@ -0,0 +1,60 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0 $service...
+#
+# Assumptions:
+#   - microk8s is installed
+#   - /var/tmp/service-args/$service lists the arguments to add to the service, one per line, if any
+#   - /var/tmp/service-args/$service.remove lists the flags to remove from the service, one per line, if any
+
+ARGS_DIR="/var/snap/microk8s/current/args"
+SERVICE_ARGS_DIR="/var/tmp/service-args"
+
+# remove_flag removes the "--flag", "--flag=value" and "--flag value" lines from an arguments file
+remove_flag() {
+  sed -E "/^${2//./\\.}([= ]|$)/d" -i "${1}"
+}
+
+daemons=()
+for service in "$@"; do
+  args_file="${ARGS_DIR}/${service}"
+
+  if [ -f "${SERVICE_ARGS_DIR}/${service}.remove" ]; then
+    while read -r flag; do
+      if [ -n "${flag}" ]; then
+        remove_flag "${args_file}" "${flag}"
+      fi
+    done < "${SERVICE_ARGS_DIR}/${service}.remove"
+  fi
+
+  if [ -f "${SERVICE_ARGS_DIR}/${service}" ]; then
+    echo "# ClusterAPI configuration" >> "${args_file}"
+    while read -r arg; do
+      if [ -n "${arg}" ]; then
+        remove_flag "${args_file}" "${arg%%[= ]*}"
+        echo "${arg}" >> "${args_file}"
+      fi
+    done < "${SERVICE_ARGS_DIR}/${service}"
+  fi
+
+  case "${service}" in
+    kube-apiserver | kube-controller-manager | kube-scheduler | kube-proxy)
+      daemon="kubelite"
+      ;;
+    *)
+      daemon="${service}"
+      ;;
+  esac
+  if [[ ! " ${daemons[*]} " =~ " ${daemon} " ]]; then
+    daemons+=("${daemon}")
+  fi
+done
+
+# restart each affected service once so that it picks up the new arguments
+for daemon in "${daemons[@]}"; do
+  while ! snap restart "microk8s.daemon-${daemon}"; do
+    echo "Failed to restart ${daemon}, will retry"
+    sleep 5
+  done
+done
@@ -0,0 +1,19 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0
+#
+# Assumptions:
+#   - microk8s is installed
+#   - the current node is not part of a cluster (yet)
+#
+# Removes Calico so that a CNI can be installed by the user.
+
+CNI_DIR="/var/snap/microk8s/current/args/cni-network"
+
+if [ -f "${CNI_DIR}/cni.yaml" ]; then
+  microk8s kubectl delete -f "${CNI_DIR}/cni.yaml" --ignore-not-found || true
+  mv "${CNI_DIR}/cni.yaml" "${CNI_DIR}/cni.yaml.disabled"
+fi
+
+rm -f "${CNI_DIR}/10-calico.conflist" "${CNI_DIR}/calico-kubeconfig"
@@ -0,0 +1,26 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0 $bundle1 $bundle2 [...]
+#
+# Each $bundle is a path on the machine or an http(s) URL to download the image tarball from.
+#
+# Assumptions:
+#   - microk8s is installed
+#   - curl is installed, if any $bundle is a URL
+
+for bundle in "$@"; do
+  file="${bundle}"
+  if [[ "${bundle}" == http://* || "${bundle}" == https://* ]]; then
+    file="/var/tmp/$(basename "${bundle%%\?*}")"
+    while ! curl --fail --silent --show-error --location --output "${file}" "${bundle}"; do
+      echo "Failed to download ${bundle}, will retry"
+      sleep 5
+    done
+  fi
+
+  while ! microk8s ctr image import "${file}"; do
+    echo "Failed to import images from ${bundle}, will retry"
+    sleep 5
+  done
+done
@@ -0,0 +1,17 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0 $name $repository [$reference]
+#
+# Assumptions:
+#   - microk8s is installed
+
+args=("${1}" "${2}")
+if [ -n "${3}" ]; then
+  args+=(--reference "${3}")
+fi
+
+while ! microk8s addons repo add "${args[@]}" --force; do
+  echo "Failed to add addon repository ${1}, will retry"
+  sleep 5
+done
@@ -1,17 +1,26 @@
 #!/bin/bash -xe
 
 # Usage:
-#   $0 $addon1 $addon2 [...]
+#   $0 [--skip-community] [--timeout=$seconds1] $addon1 [--timeout=$seconds2] $addon2 [...]
 #
 # Assumptions:
 #   - microk8s is installed
 #   - microk8s apiserver is up and running
 
-# enable community addons, this is for free and avoids confusion if addons are failing to install
-microk8s enable community || true
+if [[ "$1" == "--skip-community" ]]; then
+  shift
+else
+  # enable community addons, this is for free and avoids confusion if addons are failing to install
+  microk8s enable community || true
+fi
 
 while [[ "$@" != "" ]]; do
-  microk8s enable "$1"
+  timeout=""
+  if [[ "$1" == --timeout=* ]]; then
+    timeout="timeout ${1#--timeout=}"
+    shift
+  fi
+  ${timeout} microk8s enable "$1"
   /capi-scripts/50-wait-apiserver.sh
   shift
 done
@@ -28,6 +28,9 @@ while [ "$joined" = "false" ]; do
     sleep 5
   done
 
+  if [ "$joined" = "false" ]; then
+    /capi-scripts/00-report-progress.sh join failed "Failed to join MicroK8s cluster, will retry"
+  fi
 done
 
 # What is this hack? Why do we call snap set here?
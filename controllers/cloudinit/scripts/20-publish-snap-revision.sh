@@ -0,0 +1,22 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0
+#
+# Assumptions:
+#   - microk8s is installed from the snap store
+#   - microk8s apiserver is up and running
+#
+# Publishes the revision of the installed MicroK8s snap in the "kube-system/capi-microk8s-snap-revision"
+# configmap of the workload cluster. The bootstrap provider installs the same revision on joining machines.
+
+CONFIGMAP_NAMESPACE="kube-system"
+CONFIGMAP_NAME="capi-microk8s-snap-revision"
+
+revision="$(snap list microk8s | awk 'NR == 2 { print $3 }')"
+
+while ! microk8s kubectl create configmap -n "${CONFIGMAP_NAMESPACE}" "${CONFIGMAP_NAME}" \
+  --from-literal=revision="${revision}" --dry-run=client -o yaml | microk8s kubectl apply -f -; do
+  echo "Failed to publish the snap revision, will retry"
+  sleep 5
+done
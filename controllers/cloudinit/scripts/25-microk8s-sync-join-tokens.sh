@@ -0,0 +1,94 @@
+#!/bin/bash -e
+
+# Usage:
+#   $0 install
+#   $0 sync
+#
+# Assumptions:
+#   - microk8s is installed
+#   - microk8s apiserver is up and running
+#
+# The bootstrap provider issues a short-lived join token for every joining machine and publishes
+# it in the "kube-system/capi-microk8s-join-tokens" secret of the workload cluster, with the token
+# as the key and its expiry (unix time) as the value. "sync" registers new tokens with the cluster
+# agent of this node and removes tokens that have been revoked. "install" runs a first sync and
+# installs a systemd timer that keeps syncing periodically.
+
+SECRET_NAMESPACE="kube-system"
+SECRET_NAME="capi-microk8s-join-tokens"
+STATE_DIR="/var/lib/capi-microk8s/join-tokens"
+CLUSTER_TOKENS_FILE="/var/snap/microk8s/current/credentials/cluster-tokens.txt"
+UNIT_NAME="capi-microk8s-sync-join-tokens"
+
+sync_tokens() {
+  mkdir -p "${STATE_DIR}"
+
+  tokens="$(microk8s kubectl get secret -n "${SECRET_NAMESPACE}" "${SECRET_NAME}" --ignore-not-found \
+    -o go-template='{{ range $token, $expiry := .data }}{{ $token }} {{ $expiry | base64decode }}{{ "\n" }}{{ end }}')"
+
+  now="$(date +%s)"
+  declare -A wanted
+  while read -r token expiry; do
+    if [ -z "${token}" ]; then
+      continue
+    fi
+    wanted["${token}"]="1"
+    if [ -f "${STATE_DIR}/${token}" ] || [ "${expiry}" -le "${now}" ]; then
+      continue
+    fi
+    microk8s add-node --token "${token}" --token-ttl "$((expiry - now))"
+    touch "${STATE_DIR}/${token}"
+  done <<< "${tokens}"
+
+  for state in "${STATE_DIR}"/*; do
+    [ -f "${state}" ] || continue
+    token="$(basename "${state}")"
+    if [ -z "${wanted[${token}]}" ]; then
+      if [ -f "${CLUSTER_TOKENS_FILE}" ]; then
+        sed -i "/^${token}\(|.*\)\?$/d" "${CLUSTER_TOKENS_FILE}"
+      fi
+      rm -f "${state}"
+    fi
+  done
+}
+
+install_timer() {
+  cat > "/etc/systemd/system/${UNIT_NAME}.service" <<EOS
+[Unit]
+Description=Sync Cluster API MicroK8s join tokens
+After=snap.microk8s.daemon-kubelite.service
+
+[Service]
+Type=oneshot
+ExecStart=/bin/bash $(readlink -f "${0}") sync
+EOS
+
+  cat > "/etc/systemd/system/${UNIT_NAME}.timer" <<EOS
+[Unit]
+Description=Periodically sync Cluster API MicroK8s join tokens
+
+[Timer]
+OnBootSec=30s
+OnUnitActiveSec=20s
+
+[Install]
+WantedBy=timers.target
+EOS
+
+  systemctl daemon-reload
+  systemctl enable --now "${UNIT_NAME}.timer"
+}
+
+case "${1}" in
+  install)
+    sync_tokens || echo "Failed to sync join tokens, will retry"
+    install_timer
+    ;;
+  sync)
+    sync_tokens
+    ;;
+  *)
+    echo "Usage: ${0} install|sync"
+    exit 1
+    ;;
+esac
@@ -0,0 +1,63 @@
+#!/bin/bash -xe
+
+# Usage:
+#   $0 $dns_ip $cluster_domain
+#
+# Assumptions:
+#   - microk8s is installed
+#   - microk8s apiserver is up and running
+#   - the addons are enabled
+
+KUBELET_ARGS="/var/snap/microk8s/current/args/kubelet"
+
+# The dns addon configures the kubelet with its default IP and domain
+if ! grep -qx -- "--cluster-dns=${1}" "${KUBELET_ARGS}" || ! grep -qx -- "--cluster-domain=${2}" "${KUBELET_ARGS}"; then
+  sed '/^--cluster-dns[= ]/d' -i "${KUBELET_ARGS}"
+  sed '/^--cluster-domain[= ]/d' -i "${KUBELET_ARGS}"
+  echo "--cluster-dns=${1}" >> "${KUBELET_ARGS}"
+  echo "--cluster-domain=${2}" >> "${KUBELET_ARGS}"
+
+  while ! snap restart microk8s.daemon-kubelite; do
+    sleep 5
+  done
+  /capi-scripts/50-wait-apiserver.sh
+fi
+
+if ! microk8s kubectl get deployment/coredns -n kube-system; then
+  echo "Will not configure CoreDNS, the dns addon is not enabled"
+  exit 0
+fi
+
+# Serve the cluster domain
+microk8s kubectl get configmap/coredns -n kube-system -o yaml | sed "s/ cluster\.local / ${2} /" | microk8s kubectl replace -f -
+microk8s kubectl rollout restart deployment/coredns -n kube-system
+
+# The kube-dns service of the dns addon has a fixed IP of the default service CIDR, recreate it
+if [ "$(microk8s kubectl get service/kube-dns -n kube-system -o jsonpath='{.spec.clusterIP}' || true)" != "${1}" ]; then
+  microk8s kubectl delete service/kube-dns -n kube-system --ignore-not-found
+  microk8s kubectl apply -f - <<EOF_SERVICE
+apiVersion: v1
+kind: Service
+metadata:
+  name: kube-dns
+  namespace: kube-system
+  labels:
+    k8s-app: kube-dns
+    kubernetes.io/cluster-service: "true"
+    kubernetes.io/name: "CoreDNS"
+spec:
+  selector:
+    k8s-app: kube-dns
+  clusterIP: ${1}
+  ports:
+  - name: dns
+    port: 53
+    protocol: UDP
+  - name: dns-tcp
+    port: 53
+    protocol: TCP
+  - name: metrics
+    port: 9153
+    protocol: TCP
+EOF_SERVICE
+fi
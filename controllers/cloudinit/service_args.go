@@ -0,0 +1,123 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+// Names of the MicroK8s services whose arguments can be configured. These are the names of the arguments
+// files in /var/snap/microk8s/current/args.
+const (
+	APIServerService         = "kube-apiserver"
+	ControllerManagerService = "kube-controller-manager"
+	SchedulerService         = "kube-scheduler"
+	KubeProxyService         = "kube-proxy"
+	ContainerdService        = "containerd"
+	K8sDqliteService         = "k8s-dqlite"
+	ClusterAgentService      = "cluster-agent"
+)
+
+// ServiceArgs are the arguments to add to and remove from a MicroK8s service.
+type ServiceArgs struct {
+	// Args are arguments to add, e.g. "--profiling=false". They replace existing arguments with the same flag.
+	Args []string
+	// Remove are flags to remove from the arguments of the service, e.g. "--profiling".
+	Remove []string
+}
+
+// ServiceArgsFromAPI returns the extra arguments of the MicroK8s services, keyed by service name.
+func ServiceArgsFromAPI(c *bootstrapclusterxk8siov1beta1.InitConfiguration) map[string]ServiceArgs {
+	if c == nil {
+		return nil
+	}
+	result := make(map[string]ServiceArgs)
+	for service, args := range map[string]*bootstrapclusterxk8siov1beta1.ServiceArgs{
+		APIServerService:         c.ExtraAPIServerArgs,
+		ControllerManagerService: c.ExtraControllerManagerArgs,
+		SchedulerService:         c.ExtraSchedulerArgs,
+		KubeProxyService:         c.ExtraKubeProxyArgs,
+		ContainerdService:        c.ExtraContainerdArgs,
+		K8sDqliteService:         c.ExtraK8sDqliteArgs,
+		ClusterAgentService:      c.ExtraClusterAgentArgs,
+	} {
+		if args != nil {
+			result[service] = ServiceArgs{Args: args.Args, Remove: args.Remove}
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// validateServiceArgs validates the arguments of all services.
+func validateServiceArgs(serviceArgs map[string]ServiceArgs) error {
+	for service, args := range serviceArgs {
+		for _, arg := range args.Args {
+			if !bootstrapclusterxk8siov1beta1.IsServiceArg(arg) {
+				return fmt.Errorf("argument %q of %s must be of the form --flag=value", arg, service)
+			}
+		}
+		for _, flag := range args.Remove {
+			if !bootstrapclusterxk8siov1beta1.IsServiceFlag(flag) {
+				return fmt.Errorf("flag %q to remove from %s must be of the form --flag", flag, service)
+			}
+		}
+	}
+	return nil
+}
+
+// configureServiceArgs returns the files and commands that configure the arguments of the services with
+// 10-configure-service-args.sh. The services are restarted once after all arguments are configured.
+func configureServiceArgs(serviceArgs map[string]ServiceArgs) ([]File, []string) {
+	if len(serviceArgs) == 0 {
+		return nil, nil
+	}
+	services := make([]string, 0, len(serviceArgs))
+	for service := range serviceArgs {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var files []File
+	for _, service := range services {
+		args := serviceArgs[service]
+		if len(args.Args) > 0 {
+			files = append(files, File{
+				Content:     strings.Join(args.Args, "\n") + "\n",
+				Path:        filepath.Join("/var", "tmp", "service-args", service),
+				Permissions: "0400",
+				Owner:       "root:root",
+			})
+		}
+		if len(args.Remove) > 0 {
+			files = append(files, File{
+				Content:     strings.Join(args.Remove, "\n") + "\n",
+				Path:        filepath.Join("/var", "tmp", "service-args", service+".remove"),
+				Permissions: "0400",
+				Owner:       "root:root",
+			})
+		}
+	}
+	return files, []string{fmt.Sprintf("%s %s", scriptPath(configureServiceArgsScript), strings.Join(services, " "))}
+}
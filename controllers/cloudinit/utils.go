@@ -18,12 +18,118 @@ package cloudinit
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
 
 	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
 	"k8s.io/apimachinery/pkg/util/version"
 )
 
-func createInstallArgs(confinement string, riskLevel string, kubernetesVersion *version.Version) string {
+// snapRefreshHoldRegexp matches the hold of snap refreshes, as rendered by SnapRefreshFromAPI.
+var snapRefreshHoldRegexp = regexp.MustCompile(`^(forever|[-0-9TZ:+.]+)$`)
+
+// SnapRefresh controls when snapd refreshes snaps.
+type SnapRefresh struct {
+	// Hold is "forever" or an RFC3339 time until which refreshes are held. Refreshes are not held if empty.
+	Hold string
+	// Timer is the window in which snaps are refreshed. The snapd default is used if empty.
+	Timer string
+}
+
+// SnapRefreshFromAPI returns the snap refresh configuration.
+func SnapRefreshFromAPI(snapRefresh *bootstrapclusterxk8siov1beta1.SnapRefresh) SnapRefresh {
+	if snapRefresh == nil {
+		return SnapRefresh{}
+	}
+	result := SnapRefresh{Timer: snapRefresh.Timer}
+	switch {
+	case snapRefresh.Hold:
+		result.Hold = "forever"
+	case snapRefresh.HoldUntil != nil:
+		result.Hold = snapRefresh.HoldUntil.UTC().Format(time.RFC3339)
+	}
+	return result
+}
+
+// configureSnapRefreshCommands returns the commands that configure when snapd refreshes snaps.
+func configureSnapRefreshCommands(snapRefresh SnapRefresh) ([]string, error) {
+	if snapRefresh == (SnapRefresh{}) {
+		return nil, nil
+	}
+	if snapRefresh.Hold != "" && !snapRefreshHoldRegexp.MatchString(snapRefresh.Hold) {
+		return nil, fmt.Errorf("snap refresh hold %q must be \"forever\" or an RFC3339 time", snapRefresh.Hold)
+	}
+	if !bootstrapclusterxk8siov1beta1.IsSnapRefreshTimer(snapRefresh.Timer) {
+		return nil, fmt.Errorf("snap refresh timer %q is invalid", snapRefresh.Timer)
+	}
+	return []string{fmt.Sprintf("%s %q %q", scriptPath(configureSnapRefreshScript), snapRefresh.Hold, snapRefresh.Timer)}, nil
+}
+
+// Installation configures installing MicroK8s without access to the snap store.
+type Installation struct {
+	// Snap is the path or http(s) URL of the MicroK8s snap to install. The snap store is used if empty.
+	Snap string
+	// Assertion is the path or http(s) URL of the assertion of Snap.
+	// The snap is installed without signature verification if empty.
+	Assertion string
+	// ImageBundles is a list of paths or http(s) URLs of image tarballs to import after installing MicroK8s.
+	ImageBundles []string
+}
+
+// InstallationFromAPI returns the installation configuration.
+func InstallationFromAPI(installation *bootstrapclusterxk8siov1beta1.Installation) Installation {
+	if installation == nil {
+		return Installation{}
+	}
+	return Installation{
+		Snap:         installation.Snap,
+		Assertion:    installation.Assertion,
+		ImageBundles: installation.ImageBundles,
+	}
+}
+
+// installMicroK8sCommands returns the commands that install MicroK8s and import the image bundles.
+func installMicroK8sCommands(installation Installation, confinement string, riskLevel string, snapRevision int64, kubernetesVersion *version.Version) ([]string, error) {
+	var commands []string
+	if snapRevision < 0 {
+		return nil, fmt.Errorf("snap revision %d is not a positive number", snapRevision)
+	}
+	if installation.Snap == "" {
+		if installation.Assertion != "" {
+			return nil, fmt.Errorf("snap assertion %q cannot be used without a snap", installation.Assertion)
+		}
+		commands = append(commands, fmt.Sprintf("%s %q", scriptPath(installMicroK8sScript), createInstallArgs(confinement, riskLevel, snapRevision, kubernetesVersion)))
+	} else {
+		if snapRevision != 0 {
+			return nil, fmt.Errorf("snap revision %d cannot be used when installing from snap %q", snapRevision, installation.Snap)
+		}
+		for _, source := range []string{installation.Snap, installation.Assertion} {
+			if source != "" && !bootstrapclusterxk8siov1beta1.IsInstallSource(source) {
+				return nil, fmt.Errorf("%q must be an absolute path or an http(s) URL", source)
+			}
+		}
+		var installArgs string
+		if confinement != "strict" {
+			installArgs = "--classic"
+		}
+		commands = append(commands, fmt.Sprintf("%s %q %q %q", scriptPath(installMicroK8sSnapScript), installation.Snap, installation.Assertion, installArgs))
+	}
+
+	if len(installation.ImageBundles) > 0 {
+		bundles := make([]string, 0, len(installation.ImageBundles))
+		for _, bundle := range installation.ImageBundles {
+			if !bootstrapclusterxk8siov1beta1.IsInstallSource(bundle) {
+				return nil, fmt.Errorf("image bundle %q must be an absolute path or an http(s) URL", bundle)
+			}
+			bundles = append(bundles, fmt.Sprintf("%q", bundle))
+		}
+		commands = append(commands, fmt.Sprintf("%s %s", scriptPath(importImagesScript), strings.Join(bundles, " ")))
+	}
+	return commands, nil
+}
+
+func createInstallArgs(confinement string, riskLevel string, snapRevision int64, kubernetesVersion *version.Version) string {
 	installChannel := fmt.Sprintf("%d.%d", kubernetesVersion.Major(), kubernetesVersion.Minor())
 	var installArgs string
 	if confinement == "strict" {
@@ -39,10 +145,26 @@ func createInstallArgs(confinement string, riskLevel string, kubernetesVersion *
 			installArgs = fmt.Sprintf("--channel %s --classic", installChannel)
 		}
 	}
+	if snapRevision > 0 {
+		installArgs = fmt.Sprintf("%s --revision %d", installArgs, snapRevision)
+	}
 
 	return installArgs
 }
 
+// configureAPIServerPortCommands returns the commands that configure the apiserver port. The native script
+// does not redirect port 16443 with iptables, so it needs no packages installed on the host. No commands are
+// needed for the native port on versions that support a launch configuration, see nodeConfiguration.
+func configureAPIServerPortCommands(kubernetesVersion *version.Version, native bool, port string) []string {
+	if !native {
+		return []string{fmt.Sprintf("%s %q", scriptPath(configureAPIServerScript), port)}
+	}
+	if supportsLaunchConfiguration(kubernetesVersion) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s %q", scriptPath(configureAPIServerNativeScript), port)}
+}
+
 func WriteFilesFromAPI(files []bootstrapclusterxk8siov1beta1.CloudInitWriteFile) []File {
 	if len(files) == 0 {
 		return nil
@@ -54,6 +176,7 @@ func WriteFilesFromAPI(files []bootstrapclusterxk8siov1beta1.CloudInitWriteFile)
 			Path:        f.Path,
 			Permissions: f.Permissions,
 			Owner:       f.Owner,
+			Encoding:    string(f.Encoding),
 		})
 	}
 	return result
@@ -18,10 +18,11 @@ package cloudinit
 
 import (
 	"fmt"
-	"path/filepath"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/progress"
 )
 
 // WorkerInput defines the context needed to generate a worker instance to join a cluster.
@@ -34,18 +35,38 @@ type WorkerInput struct {
 	KubernetesVersion string
 	// ClusterAgentPort is the port that cluster-agent binds to.
 	ClusterAgentPort string
+	// APIServerPort is the port that kube-apiserver binds to.
+	APIServerPort string
+	// APIServerProxy is the mode of the apiserver proxy, one of "lb", "all-control-planes" or "both".
+	// Defaults to "lb".
+	APIServerProxy string
+	// PodCIDR is the CIDR of the pod network, optionally followed by a comma and an IPv6 CIDR.
+	PodCIDR string
+	// ServiceCIDR is the CIDR of the service network, optionally followed by a comma and an IPv6 CIDR.
+	ServiceCIDR string
+	// ClusterDomain is the DNS domain of the cluster.
+	ClusterDomain string
+	// CNI is the CNI of the cluster, one of "calico-vxlan", "calico-ipip", "calico-none", "cilium" or "none".
+	// Defaults to Calico.
+	CNI string
 	// ContainerdHTTPProxy is http_proxy configuration for containerd.
 	ContainerdHTTPProxy string
 	// ContainerdHTTPSProxy is https_proxy configuration for containerd.
 	ContainerdHTTPSProxy string
 	// ContainerdNoProxy is no_proxy configuration for containerd.
 	ContainerdNoProxy string
-	// JoinNodeIPs is the IP addresses of the nodes to join.
+	// JoinNodeIPs is the IP addresses or DNS names of the nodes to join.
 	JoinNodeIPs []string
 	// Confinement specifies a classic or strict deployment of microk8s snap.
 	Confinement string
 	// RiskLevel specifies the risk level (strict, candidate, beta, edge) for the snap channels.
 	RiskLevel string
+	// SnapRevision pins the revision of the MicroK8s snap. The latest revision of the channel is used if zero.
+	SnapRevision int64
+	// Installation configures installing MicroK8s without access to the snap store.
+	Installation Installation
+	// SnapRefresh controls when snapd refreshes snaps.
+	SnapRefresh SnapRefresh
 	// SnapstoreProxyDomain specifies the domain of the snapstore proxy if one is to be used.
 	SnapstoreProxyDomain string
 	// SnapstoreProxyId specifies the snapstore proxy ID if one is to be used.
@@ -54,10 +75,20 @@ type WorkerInput struct {
 	ExtraWriteFiles []File
 	// ExtraKubeletArgs is a list of arguments to add to kubelet.
 	ExtraKubeletArgs []string
+	// NodeLabels are the labels to register the node with.
+	NodeLabels map[string]string
+	// NodeTaints are the taints to register the node with.
+	NodeTaints []Taint
+	// ExtraServiceArgs are the arguments to add to and remove from the MicroK8s services, keyed by service name.
+	ExtraServiceArgs map[string]ServiceArgs
+	// Registries configures how containerd pulls images from container registries.
+	Registries []Registry
 	// SnapstoreHTTPProxy is http_proxy configuration for snap store.
 	SnapstoreHTTPProxy string
 	// SnapstoreHTTPSProxy is https_proxy configuration for snap store.
 	SnapstoreHTTPSProxy string
+	// ProgressReport configures reporting the bootstrap progress of the node to the management cluster.
+	ProgressReport ProgressReport
 	// BootCommands is a list of commands to add to the "bootcmd" section of cloud-init.
 	BootCommands []string
 	// PreRunCommands is a list of commands to add to the "runcmd" section of cloud-init before installing MicroK8s.
@@ -83,26 +114,60 @@ func NewJoinWorker(input *WorkerInput) (*CloudConfig, error) {
 		return nil, fmt.Errorf("strict confinement is only available for microk8s v1.25+")
 	}
 
-	stopApiServerProxyRefreshes := "no"
-	if kubernetesVersion.Minor() > 24 {
-		stopApiServerProxyRefreshes = "yes"
+	installCommands, err := installMicroK8sCommands(input.Installation, input.Confinement, input.RiskLevel, input.SnapRevision, kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	snapRefreshCommands, err := configureSnapRefreshCommands(input.SnapRefresh)
+	if err != nil {
+		return nil, err
+	}
+	registryFiles, registryCommands, err := configureRegistries(input.Registries)
+	if err != nil {
+		return nil, err
+	}
+	progressFiles, err := configureProgressReport(input.ProgressReport)
+	if err != nil {
+		return nil, err
+	}
+	serviceArgs, err := clusterNetworkServiceArgs(input.PodCIDR, input.ServiceCIDR, input.ExtraServiceArgs)
+	if err != nil {
+		return nil, err
+	}
+	dnsKubeletArgs, err := clusterDNSKubeletArgs(input.ServiceCIDR, input.ClusterDomain)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCNI(input.CNI, false); err != nil {
+		return nil, err
+	}
+	apiServerProxyFiles, apiServerProxyCommands, err := configureAPIServerProxy(input.APIServerProxy, input.ControlPlaneEndpoint, input.APIServerPort, input.JoinNodeIPs, kubernetesVersion.Minor() > 24)
+	if err != nil {
+		return nil, err
+	}
+	nodeFiles, nodeCommands, err := configureNode(kubernetesVersion, nodeConfiguration{
+		kubeletArgs: append(dnsKubeletArgs, input.ExtraKubeletArgs...),
+		nodeLabels:  input.NodeLabels,
+		nodeTaints:  input.NodeTaints,
+		serviceArgs: serviceArgs,
+		httpProxy:   input.ContainerdHTTPProxy,
+		httpsProxy:  input.ContainerdHTTPSProxy,
+		noProxy:     input.ContainerdNoProxy,
+	})
+	if err != nil {
+		return nil, err
 	}
-	installArgs := createInstallArgs(input.Confinement, input.RiskLevel, kubernetesVersion)
 
 	cloudConfig := NewBaseCloudConfig()
 	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, input.ExtraWriteFiles...)
-	if args := input.ExtraKubeletArgs; len(args) > 0 {
-		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, File{
-			Content:     strings.Join(args, "\n"),
-			Path:        filepath.Join("/var", "tmp", "extra-kubelet-args"),
-			Permissions: "0400",
-			Owner:       "root:root",
-		})
-	}
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, nodeFiles...)
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, registryFiles...)
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, apiServerProxyFiles...)
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, progressFiles...)
 
 	joinURLs := make([]string, 0, len(input.JoinNodeIPs))
 	for _, nodeIP := range input.JoinNodeIPs {
-		joinURLs = append(joinURLs, fmt.Sprintf("%q", fmt.Sprintf("%s:%s/%s", nodeIP, input.ClusterAgentPort, input.Token)))
+		joinURLs = append(joinURLs, fmt.Sprintf("%q", joinURL(nodeIP, input.ClusterAgentPort, input.Token)))
 	}
 
 	cloudConfig.BootCommands = append(cloudConfig.BootCommands, input.BootCommands...)
@@ -112,14 +177,19 @@ func NewJoinWorker(input *WorkerInput) (*CloudConfig, error) {
 		fmt.Sprintf("%s %q %q", scriptPath(snapstoreHTTPProxyScript), input.SnapstoreHTTPProxy, input.SnapstoreHTTPSProxy),
 		fmt.Sprintf("%s %q %q", scriptPath(snapstoreProxyScript), input.SnapstoreProxyDomain, input.SnapstoreProxyId),
 		scriptPath(disableHostServicesScript),
-		fmt.Sprintf("%s %q", scriptPath(installMicroK8sScript), installArgs),
-		fmt.Sprintf("%s %q %q %q", scriptPath(configureContainerdProxyScript), input.ContainerdHTTPProxy, input.ContainerdHTTPSProxy, input.ContainerdNoProxy),
-		scriptPath(configureKubeletScript),
-		scriptPath(waitAPIServerScript),
+	)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, snapRefreshCommands...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, reportProgressCommands(input.ProgressReport, progress.StepInstall, installCommands...)...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, registryCommands...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, nodeCommands...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, scriptPath(waitAPIServerScript))
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, disableCalicoCommands(input.CNI)...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands,
 		fmt.Sprintf("%s %q", scriptPath(configureClusterAgentPortScript), input.ClusterAgentPort),
-		fmt.Sprintf("%s yes %s", scriptPath(microk8sJoinScript), strings.Join(joinURLs, " ")),
-		fmt.Sprintf("%s %s 6443 %s", scriptPath(configureTraefikScript), input.ControlPlaneEndpoint, stopApiServerProxyRefreshes),
 	)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands,
+		reportProgressCommands(input.ProgressReport, progress.StepJoin, fmt.Sprintf("%s yes %s", scriptPath(microk8sJoinScript), strings.Join(joinURLs, " ")))...)
+	cloudConfig.RunCommands = append(cloudConfig.RunCommands, apiServerProxyCommands...)
 	cloudConfig.RunCommands = append(cloudConfig.RunCommands, input.PostRunCommands...)
 
 	return cloudConfig, nil
@@ -32,6 +32,7 @@ func TestWorkerJoin(t *testing.T) {
 			ControlPlaneEndpoint: "capi-aws-apiserver-1647391446.us-east-1.elb.amazonaws.com",
 			KubernetesVersion:    "v1.24.3",
 			ClusterAgentPort:     "30000",
+			APIServerPort:        "6443",
 			Token:                strings.Repeat("a", 32),
 			JoinNodeIPs:          []string{"10.0.3.194", "10.0.3.195"},
 		})
@@ -48,10 +49,193 @@ func TestWorkerJoin(t *testing.T) {
 			`/capi-scripts/50-wait-apiserver.sh`,
 			`/capi-scripts/10-configure-cluster-agent-port.sh "30000"`,
 			`/capi-scripts/20-microk8s-join.sh yes "10.0.3.194:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" "10.0.3.195:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
-			`/capi-scripts/30-configure-traefik.sh capi-aws-apiserver-1647391446.us-east-1.elb.amazonaws.com 6443 no`,
+			`/capi-scripts/30-configure-traefik.sh no`,
+		}))
+		g.Expect(cloudConfig.WriteFiles).To(ContainElement(cloudinit.File{
+			Content: `tcp:
+  routers:
+    Router-1:
+      rule: HostSNI(` + "`*`" + `)
+      service: kube-apiserver
+      tls:
+        passthrough: true
+  services:
+    kube-apiserver:
+      loadBalancer:
+        servers:
+        - address: capi-aws-apiserver-1647391446.us-east-1.elb.amazonaws.com:6443
+`,
+			Path:        "/var/tmp/apiserver-proxy-provider.yaml",
+			Permissions: "0644",
+			Owner:       "root:root",
+		}))
+
+		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cloudConfig, err := cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+			ControlPlaneEndpoint: "fd00::100",
+			KubernetesVersion:    "v1.25.0",
+			ClusterAgentPort:     "30000",
+			APIServerPort:        "6443",
+			APIServerProxy:       "both",
+			Token:                strings.Repeat("a", 32),
+			JoinNodeIPs:          []string{"fd00::194", "cp-1.example.com"},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(cloudConfig.RunCommands).To(ContainElement(`/capi-scripts/20-microk8s-join.sh yes "[fd00::194]:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" "cp-1.example.com:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`))
+		g.Expect(cloudConfig.WriteFiles).To(ContainElement(SatisfyAll(
+			HaveField("Path", "/var/tmp/apiserver-proxy-provider.yaml"),
+			HaveField("Content", ContainSubstring(`        servers:
+        - address: '[fd00::194]:6443'
+        - address: cp-1.example.com:6443
+        - address: '[fd00::100]:6443'
+`)),
+		)))
+
+		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+
+	t.Run("CNI", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cloudConfig, err := cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+			ControlPlaneEndpoint: "capi-aws-apiserver-1647391446.us-east-1.elb.amazonaws.com",
+			KubernetesVersion:    "v1.25.0",
+			ClusterAgentPort:     "30000",
+			Token:                strings.Repeat("a", 32),
+			JoinNodeIPs:          []string{"10.0.3.194"},
+			CNI:                  "none",
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		// Calico is removed before the node joins the cluster
+		g.Expect(cloudConfig.RunCommands).To(ContainElements(
+			"/capi-scripts/50-wait-apiserver.sh",
+			"/capi-scripts/10-disable-calico.sh",
+			`/capi-scripts/20-microk8s-join.sh yes "10.0.3.194:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
+		))
+
+		_, err = cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+			KubernetesVersion: "v1.25.0",
+			Token:             strings.Repeat("a", 32),
+			CNI:               "flannel",
+		})
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("ProgressReport", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cloudConfig, err := cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+			ControlPlaneEndpoint: "10.0.0.100",
+			KubernetesVersion:    "v1.25.0",
+			ClusterAgentPort:     "30000",
+			Token:                strings.Repeat("a", 32),
+			JoinNodeIPs:          []string{"10.0.3.194"},
+			ProgressReport: cloudinit.ProgressReport{
+				URL:   "http://10.0.0.10:8082/v1/progress/default/worker-0",
+				Token: strings.Repeat("b", 32),
+			},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(cloudConfig.RunCommands).To(ContainElements(
+			`/capi-scripts/00-report-progress.sh install run /capi-scripts/00-install-microk8s.sh "--channel 1.25 --classic"`,
+			`/capi-scripts/00-report-progress.sh install succeeded`,
+			`/capi-scripts/50-wait-apiserver.sh`,
+			`/capi-scripts/00-report-progress.sh join run /capi-scripts/20-microk8s-join.sh yes "10.0.3.194:30000/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
+			`/capi-scripts/00-report-progress.sh join succeeded`,
+		))
+		g.Expect(cloudConfig.WriteFiles).To(ContainElement(cloudinit.File{
+			Content:     "PROGRESS_URL=\"http://10.0.0.10:8082/v1/progress/default/worker-0\"\nPROGRESS_TOKEN=\"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb\"\n",
+			Path:        "/var/tmp/progress-report.env",
+			Permissions: "0600",
+			Owner:       "root:root",
 		}))
 
 		_, err = cloudinit.GenerateCloudConfig(cloudConfig)
 		g.Expect(err).ToNot(HaveOccurred())
+
+		for _, report := range []cloudinit.ProgressReport{
+			{URL: "ftp://10.0.0.10/v1/progress/default/worker-0", Token: strings.Repeat("b", 32)},
+			{URL: "http://10.0.0.10:8082/$(reboot)", Token: strings.Repeat("b", 32)},
+			{URL: "http://10.0.0.10:8082/v1/progress/default/worker-0", Token: "token; reboot"},
+			{URL: "http://10.0.0.10:8082/v1/progress/default/worker-0"},
+		} {
+			_, err := cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+				ControlPlaneEndpoint: "10.0.0.100",
+				KubernetesVersion:    "v1.25.0",
+				ClusterAgentPort:     "30000",
+				Token:                strings.Repeat("a", 32),
+				JoinNodeIPs:          []string{"10.0.3.194"},
+				ProgressReport:       report,
+			})
+			g.Expect(err).To(HaveOccurred(), "expected error for %#v", report)
+		}
+	})
+
+	t.Run("APIServerProxy", func(t *testing.T) {
+		for _, tc := range []struct {
+			name              string
+			mode              string
+			expectAddresses   []string
+			kubernetesVersion string
+			expectCommand     string
+		}{
+			{name: "Default", mode: "", kubernetesVersion: "v1.25.0", expectAddresses: []string{"10.0.0.100:6443"}, expectCommand: "/capi-scripts/30-configure-traefik.sh yes"},
+			{name: "LB", mode: "lb", kubernetesVersion: "v1.24.0", expectAddresses: []string{"10.0.0.100:6443"}, expectCommand: "/capi-scripts/30-configure-traefik.sh no"},
+			{name: "AllControlPlanes", mode: "all-control-planes", kubernetesVersion: "v1.25.0", expectAddresses: []string{"10.0.3.194:6443", "10.0.3.195:6443"}, expectCommand: "/capi-scripts/30-configure-traefik.sh yes"},
+			{name: "Both", mode: "both", kubernetesVersion: "v1.25.0", expectAddresses: []string{"10.0.3.194:6443", "10.0.3.195:6443", "10.0.0.100:6443"}, expectCommand: "/capi-scripts/30-configure-traefik.sh yes"},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				cloudConfig, err := cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+					ControlPlaneEndpoint: "10.0.0.100",
+					KubernetesVersion:    tc.kubernetesVersion,
+					ClusterAgentPort:     "30000",
+					APIServerPort:        "6443",
+					APIServerProxy:       tc.mode,
+					Token:                strings.Repeat("a", 32),
+					JoinNodeIPs:          []string{"10.0.3.194", "10.0.3.195"},
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(cloudConfig.RunCommands[len(cloudConfig.RunCommands)-1]).To(Equal(tc.expectCommand))
+
+				var provider string
+				for _, f := range cloudConfig.WriteFiles {
+					if f.Path == "/var/tmp/apiserver-proxy-provider.yaml" {
+						provider = f.Content
+					}
+				}
+				var servers []string
+				for _, line := range strings.Split(provider, "\n") {
+					if line = strings.TrimSpace(line); strings.HasPrefix(line, "- address: ") {
+						servers = append(servers, strings.TrimPrefix(line, "- address: "))
+					}
+				}
+				g.Expect(servers).To(Equal(tc.expectAddresses))
+			})
+		}
+
+		t.Run("Invalid", func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := cloudinit.NewJoinWorker(&cloudinit.WorkerInput{
+				ControlPlaneEndpoint: "10.0.0.100",
+				KubernetesVersion:    "v1.25.0",
+				APIServerPort:        "6443",
+				APIServerProxy:       "none",
+				Token:                strings.Repeat("a", 32),
+			})
+			g.Expect(err).To(HaveOccurred())
+		})
 	})
 }
@@ -0,0 +1,169 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+// configHashInputs are the inputs the bootstrap data is rendered from. Values that are generated by the
+// controller (e.g. join tokens) or discovered at render time (e.g. control plane addresses) are not included.
+type configHashInputs struct {
+	Spec                 bootstrapclusterxk8siov1beta1.MicroK8sConfigSpec `json:"spec"`
+	KubernetesVersion    string                                           `json:"kubernetesVersion"`
+	ControlPlaneEndpoint string                                           `json:"controlPlaneEndpoint"`
+	// ReferencedContent are hashes of the content of the secrets and configmaps referenced by the spec.
+	ReferencedContent map[string]string `json:"referencedContent,omitempty"`
+}
+
+// computeConfigHash returns a hash of the inputs the bootstrap data of the config is rendered from.
+func (r *MicroK8sConfigReconciler) computeConfigHash(ctx context.Context, scope *Scope) (string, error) {
+	referencedContent, err := r.getReferencedContentHashes(ctx, scope)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(configHashInputs{
+		Spec:                 scope.Config.Spec,
+		KubernetesVersion:    scope.ConfigOwner.KubernetesVersion(),
+		ControlPlaneEndpoint: scope.Cluster.Spec.ControlPlaneEndpoint.Host,
+		ReferencedContent:    referencedContent,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode config hash inputs")
+	}
+	return hashOf(b), nil
+}
+
+// getReferencedContentHashes returns hashes of the file contents (contentFrom) and registry credentials
+// (credentialsSecretRef) referenced by the config, keyed by reference. Content that cannot be found is
+// hashed as empty, so that a reference that stays missing does not change the hash.
+func (r *MicroK8sConfigReconciler) getReferencedContentHashes(ctx context.Context, scope *Scope) (map[string]string, error) {
+	result := map[string]string{}
+
+	initConfig := initConfiguration(scope.Config)
+	files := append(append([]bootstrapclusterxk8siov1beta1.CloudInitWriteFile(nil), initConfig.ExtraWriteFiles...), joinConfiguration(scope.Config).ExtraWriteFiles...)
+	for _, f := range files {
+		if f.ContentFrom == nil {
+			continue
+		}
+		var key string
+		switch {
+		case f.ContentFrom.Secret != nil:
+			key = fmt.Sprintf("secret/%s/%s", f.ContentFrom.Secret.Name, f.ContentFrom.Secret.Key)
+		case f.ContentFrom.ConfigMap != nil:
+			key = fmt.Sprintf("configmap/%s/%s", f.ContentFrom.ConfigMap.Name, f.ContentFrom.ConfigMap.Key)
+		default:
+			continue
+		}
+		content, err := r.getFileContent(ctx, scope.Config.Namespace, f.ContentFrom)
+		if err != nil && !errors.Is(err, errFileContentUnavailable) {
+			return nil, errors.Wrapf(err, "file %q", f.Path)
+		}
+		result[key] = hashOf([]byte(content))
+	}
+
+	for _, registry := range initConfig.Registries {
+		ref := registry.CredentialsSecretRef
+		if ref == nil {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: scope.Config.Namespace, Name: ref.Name}, secret); err != nil && !apierrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "failed to get secret %s/%s of registry %q", scope.Config.Namespace, ref.Name, registry.Host)
+		}
+		credentials, err := json.Marshal([]string{string(secret.Data[corev1.BasicAuthUsernameKey]), string(secret.Data[corev1.BasicAuthPasswordKey])})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode registry credentials")
+		}
+		result[fmt.Sprintf("registry/%s/%s", registry.Host, ref.Name)] = hashOf(credentials)
+	}
+
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// hashOf returns the hex-encoded SHA-256 hash of b.
+func hashOf(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// shouldRegenerateBootstrapData checks whether the bootstrap data secret is up to date with the config.
+// Outdated bootstrap data is regenerated as long as the infrastructure of the owner is not provisioned,
+// otherwise the DataSecretUpToDate condition is set to report that the change is not applied.
+func (r *MicroK8sConfigReconciler) shouldRegenerateBootstrapData(ctx context.Context, scope *Scope) (bool, error) {
+	if scope.Config.Status.DataSecretName == nil {
+		return false, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: scope.Config.Namespace, Name: *scope.Config.Status.DataSecretName}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to get bootstrap data secret")
+	}
+
+	// bootstrap data generated before the hash annotation was introduced cannot be compared
+	oldHash, ok := secret.Annotations[bootstrapclusterxk8siov1beta1.ConfigHashAnnotation]
+	if !ok {
+		return false, nil
+	}
+
+	newHash, err := r.computeConfigHash(ctx, scope)
+	if err != nil {
+		return false, err
+	}
+	if oldHash == newHash {
+		conditions.MarkTrue(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretUpToDateCondition)
+		return false, nil
+	}
+
+	if ownerIsProvisioned(scope.ConfigOwner.Unstructured) {
+		conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretUpToDateCondition, bootstrapclusterxk8siov1beta1.ConfigChangedAfterProvisioningReason, clusterv1.ConditionSeverityWarning,
+			"%s %s was already provisioned, changes to the MicroK8sConfig are not applied", scope.ConfigOwner.GetKind(), scope.ConfigOwner.GetName())
+		return false, nil
+	}
+	return true, nil
+}
+
+// ownerIsProvisioned returns true if the infrastructure of a Machine (spec.providerID) or MachinePool
+// (spec.providerIDList) config owner has been provisioned.
+func ownerIsProvisioned(owner *unstructured.Unstructured) bool {
+	if providerID, _, _ := unstructured.NestedString(owner.Object, "spec", "providerID"); providerID != "" {
+		return true
+	}
+	providerIDList, _, _ := unstructured.NestedStringSlice(owner.Object, "spec", "providerIDList")
+	return len(providerIDList) > 0
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	bsutil "sigs.k8s.io/cluster-api/bootstrap/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+func TestShouldRegenerateBootstrapData(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	newScope := func(g *WithT, providerID string) *Scope {
+		machine := &clusterv1.Machine{
+			TypeMeta:   metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+			Spec:       clusterv1.MachineSpec{Version: pointer.String("v1.25.2")},
+		}
+		if providerID != "" {
+			machine.Spec.ProviderID = pointer.String(providerID)
+		}
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(machine)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		return &Scope{
+			Logger: ctrl.Log,
+			Config: &v1beta1.MicroK8sConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"},
+				Spec: v1beta1.MicroK8sConfigSpec{
+					InitConfiguration: &v1beta1.InitConfiguration{Addons: []string{"dns"}},
+				},
+				Status: v1beta1.MicroK8sConfigStatus{Ready: true, DataSecretName: pointer.String("config")},
+			},
+			ConfigOwner: &bsutil.ConfigOwner{Unstructured: &unstructured.Unstructured{Object: obj}},
+			Cluster:     &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}},
+		}
+	}
+
+	// newReconciler returns a reconciler with the given objects and the bootstrap data secret of the scope.
+	newReconciler := func(g *WithT, scope *Scope, withHash bool, objs ...client.Object) *MicroK8sConfigReconciler {
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"}}
+		if withHash {
+			hash, err := r.computeConfigHash(context.Background(), scope)
+			g.Expect(err).NotTo(HaveOccurred())
+			secret.Annotations = map[string]string{v1beta1.ConfigHashAnnotation: hash}
+		}
+		g.Expect(r.Client.Create(context.Background(), secret)).To(Succeed())
+		return r
+	}
+
+	t.Run("UpToDate", func(t *testing.T) {
+		g := NewWithT(t)
+		scope := newScope(g, "")
+		r := newReconciler(g, scope, true)
+
+		regenerate, err := r.shouldRegenerateBootstrapData(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(regenerate).To(BeFalse())
+		g.Expect(conditions.IsTrue(scope.Config, v1beta1.DataSecretUpToDateCondition)).To(BeTrue())
+	})
+
+	t.Run("ChangedBeforeProvisioning", func(t *testing.T) {
+		g := NewWithT(t)
+		scope := newScope(g, "")
+		r := newReconciler(g, scope, true)
+
+		scope.Config.Spec.InitConfiguration.Addons = []string{"dns", "ingress"}
+		regenerate, err := r.shouldRegenerateBootstrapData(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(regenerate).To(BeTrue())
+	})
+
+	t.Run("ChangedAfterProvisioning", func(t *testing.T) {
+		g := NewWithT(t)
+		scope := newScope(g, "aws:///machine")
+		r := newReconciler(g, scope, true)
+
+		scope.Config.Spec.InitConfiguration.Addons = []string{"dns", "ingress"}
+		regenerate, err := r.shouldRegenerateBootstrapData(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(regenerate).To(BeFalse())
+		g.Expect(conditions.IsFalse(scope.Config, v1beta1.DataSecretUpToDateCondition)).To(BeTrue())
+		g.Expect(conditions.GetReason(scope.Config, v1beta1.DataSecretUpToDateCondition)).To(Equal(v1beta1.ConfigChangedAfterProvisioningReason))
+	})
+
+	t.Run("VersionChanged", func(t *testing.T) {
+		g := NewWithT(t)
+		scope := newScope(g, "")
+		r := newReconciler(g, scope, true)
+
+		g.Expect(unstructured.SetNestedField(scope.ConfigOwner.Object, "v1.26.0", "spec", "version")).To(Succeed())
+		regenerate, err := r.shouldRegenerateBootstrapData(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(regenerate).To(BeTrue())
+	})
+
+	t.Run("ReferencedContentChanged", func(t *testing.T) {
+		for _, tc := range []struct {
+			name   string
+			object client.Object
+			update func(g *WithT, c client.Client)
+		}{
+			{
+				name:   "FileContent",
+				object: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "files"}, Data: map[string]string{"motd": "hello"}},
+				update: func(g *WithT, c client.Client) {
+					configMap := &corev1.ConfigMap{}
+					g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "files"}, configMap)).To(Succeed())
+					configMap.Data["motd"] = "bye"
+					g.Expect(c.Update(context.Background(), configMap)).To(Succeed())
+				},
+			},
+			{
+				name:   "RegistryCredentials",
+				object: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "harbor"}, Data: map[string][]byte{"username": []byte("user"), "password": []byte("pass")}},
+				update: func(g *WithT, c client.Client) {
+					secret := &corev1.Secret{}
+					g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "harbor"}, secret)).To(Succeed())
+					secret.Data["password"] = []byte("rotated")
+					g.Expect(c.Update(context.Background(), secret)).To(Succeed())
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+				scope := newScope(g, "")
+				scope.Config.Spec.InitConfiguration.ExtraWriteFiles = []v1beta1.CloudInitWriteFile{
+					{Path: "/etc/motd", ContentFrom: &v1beta1.FileSource{ConfigMap: &v1beta1.FileSourceKey{Name: "files", Key: "motd"}}},
+				}
+				scope.Config.Spec.InitConfiguration.Registries = []v1beta1.Registry{
+					{Host: "harbor.example.com", CredentialsSecretRef: &corev1.LocalObjectReference{Name: "harbor"}},
+				}
+				r := newReconciler(g, scope, true, tc.object)
+
+				regenerate, err := r.shouldRegenerateBootstrapData(context.Background(), scope)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(regenerate).To(BeFalse())
+
+				tc.update(g, r.Client)
+				regenerate, err = r.shouldRegenerateBootstrapData(context.Background(), scope)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(regenerate).To(BeTrue())
+			})
+		}
+	})
+
+	t.Run("NoHash", func(t *testing.T) {
+		g := NewWithT(t)
+		scope := newScope(g, "")
+		r := newReconciler(g, scope, false)
+
+		scope.Config.Spec.InitConfiguration.Addons = []string{"dns", "ingress"}
+		regenerate, err := r.shouldRegenerateBootstrapData(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(regenerate).To(BeFalse())
+	})
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jointoken implements issuing and revoking per-machine join tokens.
+package jointoken
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// WorkloadSecretNamespace is the namespace of the workload cluster secret that holds the issued join tokens.
+	WorkloadSecretNamespace = "kube-system"
+
+	// WorkloadSecretName is the name of the workload cluster secret that holds the issued join tokens.
+	// The control plane nodes register the tokens of this secret with their cluster agent.
+	WorkloadSecretName = "capi-microk8s-join-tokens"
+
+	// issuedTokensKey is the key of the management cluster secret that holds the issued join tokens.
+	issuedTokensKey = "issued-tokens"
+
+	tokenLength  = 32
+	tokenLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+// WorkloadClientFunc returns a client for the workload cluster.
+type WorkloadClientFunc func(ctx context.Context, cluster *clusterv1.Cluster) (client.Client, error)
+
+// Manager issues short-lived join tokens for joining machines and revokes them once they are no longer needed.
+// Issued tokens are recorded in a secret of the management cluster and published to the workload cluster.
+type Manager struct {
+	log            logr.Logger
+	client         client.Client
+	workloadClient WorkloadClientFunc
+	now            func() time.Time
+}
+
+// NewManager returns a manager for per-machine join tokens.
+func NewManager(log logr.Logger, client client.Client, workloadClient WorkloadClientFunc) *Manager {
+	return &Manager{
+		log:            log,
+		client:         client,
+		workloadClient: workloadClient,
+		now:            time.Now,
+	}
+}
+
+// issuedToken is a join token issued for a machine.
+type issuedToken struct {
+	Machine string `json:"machine"`
+	Token   string `json:"token"`
+	// Expiry is the time (in unix seconds) after which the token is no longer valid.
+	Expiry int64 `json:"expiry"`
+}
+
+// Generate returns a new random join token.
+func Generate() (string, error) {
+	b := make([]byte, tokenLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(tokenLetters))))
+		if err != nil {
+			return "", errors.Wrap(err, "failed to generate random join token")
+		}
+		b[i] = tokenLetters[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// Enable records that the cluster uses per-machine join tokens. This is decided when the bootstrap data of the
+// control plane node that initializes the cluster is generated, and applies to all nodes joining the cluster.
+func (m *Manager) Enable(ctx context.Context, cluster *clusterv1.Cluster) error {
+	secret, _, err := m.getIssuedTokens(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	if secret.ResourceVersion != "" {
+		return nil
+	}
+	secret.Data = map[string][]byte{issuedTokensKey: []byte("[]")}
+	if err := m.client.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, "failed to store issued join tokens")
+	}
+	return nil
+}
+
+// Enabled returns true if the cluster uses per-machine join tokens.
+func (m *Manager) Enabled(ctx context.Context, cluster *clusterv1.Cluster) (bool, error) {
+	err := m.client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: secretName(cluster.Name)}, &corev1.Secret{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return false, nil
+	case err != nil:
+		return false, errors.Wrap(err, "failed to get issued join tokens")
+	}
+	return true, nil
+}
+
+// Issue returns a join token for the machine that is valid for at least the given duration.
+// A token that was previously issued for the machine and has not expired yet is reused and its expiry extended,
+// so that bootstrap data regenerated before the machine is provisioned does not invalidate the token of a machine
+// that may already be booting with the previous bootstrap data.
+func (m *Manager) Issue(ctx context.Context, cluster *clusterv1.Cluster, machineName string, ttl time.Duration) (string, error) {
+	log := m.log.WithValues("namespace", cluster.Namespace, "cluster-name", cluster.Name, "machine", machineName)
+
+	secret, tokens, err := m.getIssuedTokens(ctx, cluster)
+	if err != nil {
+		return "", err
+	}
+
+	expiry := m.now().Add(ttl).Unix()
+	var token string
+	for _, t := range tokens {
+		if t.Machine == machineName && t.Expiry > m.now().Unix() {
+			token = t.Token
+			if t.Expiry > expiry {
+				expiry = t.Expiry
+			}
+			break
+		}
+	}
+	if token == "" {
+		if token, err = Generate(); err != nil {
+			return "", err
+		}
+	}
+
+	tokens = m.withoutMachine(tokens, machineName)
+	tokens = append(tokens, issuedToken{
+		Machine: machineName,
+		Token:   token,
+		Expiry:  expiry,
+	})
+
+	if err := m.update(ctx, cluster, secret, tokens); err != nil {
+		return "", err
+	}
+	log.Info("Issued join token", "expiry", time.Unix(expiry, 0).UTC().Format(time.RFC3339))
+	return token, nil
+}
+
+// Revoke revokes the join token issued for the machine, if any.
+func (m *Manager) Revoke(ctx context.Context, cluster *clusterv1.Cluster, machineName string) error {
+	log := m.log.WithValues("namespace", cluster.Namespace, "cluster-name", cluster.Name, "machine", machineName)
+
+	secret, tokens, err := m.getIssuedTokens(ctx, cluster)
+	if err != nil {
+		return err
+	}
+
+	remaining := m.withoutMachine(tokens, machineName)
+	if len(remaining) == len(tokens) {
+		return nil
+	}
+
+	if err := m.update(ctx, cluster, secret, remaining); err != nil {
+		return err
+	}
+	log.Info("Revoked join token")
+	return nil
+}
+
+// withoutMachine returns the tokens that are not expired and have not been issued for the machine.
+func (m *Manager) withoutMachine(tokens []issuedToken, machineName string) []issuedToken {
+	now := m.now().Unix()
+	result := make([]issuedToken, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Machine == machineName || t.Expiry <= now {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// getIssuedTokens returns the secret that holds the issued tokens of the cluster, creating it if needed.
+func (m *Manager) getIssuedTokens(ctx context.Context, cluster *clusterv1.Cluster) (*corev1.Secret, []issuedToken, error) {
+	secret := &corev1.Secret{}
+	err := m.client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: secretName(cluster.Name)}, secret)
+	switch {
+	case apierrors.IsNotFound(err):
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: cluster.Namespace,
+				Name:      secretName(cluster.Name),
+				Labels: map[string]string{
+					clusterv1.ClusterLabelName: cluster.Name,
+				},
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster")),
+				},
+			},
+		}
+		return secret, nil, nil
+	case err != nil:
+		return nil, nil, errors.Wrap(err, "failed to get issued join tokens")
+	}
+
+	var tokens []issuedToken
+	if b := secret.Data[issuedTokensKey]; len(b) > 0 {
+		if err := json.Unmarshal(b, &tokens); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to parse issued join tokens from secret %s/%s", secret.Namespace, secret.Name)
+		}
+	}
+	return secret, tokens, nil
+}
+
+// update stores the issued tokens in the management cluster and publishes them to the workload cluster.
+func (m *Manager) update(ctx context.Context, cluster *clusterv1.Cluster, secret *corev1.Secret, tokens []issuedToken) error {
+	b, err := json.Marshal(tokens)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode issued join tokens")
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[issuedTokensKey] = b
+
+	if secret.ResourceVersion == "" {
+		err = m.client.Create(ctx, secret)
+	} else {
+		err = m.client.Update(ctx, secret)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to store issued join tokens")
+	}
+
+	return m.publish(ctx, cluster, tokens)
+}
+
+// publish replaces the join tokens of the workload cluster secret with the issued tokens.
+func (m *Manager) publish(ctx context.Context, cluster *clusterv1.Cluster, tokens []issuedToken) error {
+	workloadClient, err := m.workloadClient(ctx, cluster)
+	if err != nil {
+		return errors.Wrap(err, "failed to create workload cluster client")
+	}
+
+	data := make(map[string][]byte, len(tokens))
+	for _, t := range tokens {
+		data[t.Token] = []byte(strconv.FormatInt(t.Expiry, 10))
+	}
+
+	secret := &corev1.Secret{}
+	err = workloadClient.Get(ctx, client.ObjectKey{Namespace: WorkloadSecretNamespace, Name: WorkloadSecretName}, secret)
+	switch {
+	case apierrors.IsNotFound(err):
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: WorkloadSecretNamespace,
+				Name:      WorkloadSecretName,
+			},
+			Data: data,
+		}
+		err = workloadClient.Create(ctx, secret)
+	case err != nil:
+		return errors.Wrap(err, "failed to get workload cluster join tokens")
+	default:
+		secret.Data = data
+		err = workloadClient.Update(ctx, secret)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to publish join tokens to the workload cluster")
+	}
+	return nil
+}
+
+func secretName(clusterName string) string {
+	return fmt.Sprintf("%s-issued-jointokens", clusterName)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jointoken
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGenerate(t *testing.T) {
+	g := NewWithT(t)
+
+	seen := map[string]struct{}{}
+	for i := 0; i < 100; i++ {
+		token, err := Generate()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(token).To(MatchRegexp("^[a-zA-Z]{32}$"))
+		g.Expect(seen).NotTo(HaveKey(token))
+		seen[token] = struct{}{}
+	}
+}
+
+func TestManager(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster", UID: "uid"}}
+	now := time.Unix(1000000, 0)
+
+	newManager := func() (*Manager, client.Client) {
+		workloadClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		m := NewManager(logr.Discard(), fake.NewClientBuilder().WithScheme(scheme).Build(), func(context.Context, *clusterv1.Cluster) (client.Client, error) {
+			return workloadClient, nil
+		})
+		m.now = func() time.Time { return now }
+		return m, workloadClient
+	}
+
+	getWorkloadTokens := func(g *WithT, c client.Client) map[string][]byte {
+		secret := &corev1.Secret{}
+		g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: WorkloadSecretNamespace, Name: WorkloadSecretName}, secret)).To(Succeed())
+		return secret.Data
+	}
+
+	t.Run("IssueAndRevoke", func(t *testing.T) {
+		g := NewWithT(t)
+		m, workloadClient := newManager()
+
+		token1, err := m.Issue(context.Background(), cluster, "machine-1", time.Hour)
+		g.Expect(err).NotTo(HaveOccurred())
+		token2, err := m.Issue(context.Background(), cluster, "machine-2", time.Hour)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(token1).NotTo(Equal(token2))
+
+		expiry := []byte(strconv.FormatInt(now.Add(time.Hour).Unix(), 10))
+		g.Expect(getWorkloadTokens(g, workloadClient)).To(Equal(map[string][]byte{token1: expiry, token2: expiry}))
+
+		g.Expect(m.Revoke(context.Background(), cluster, "machine-1")).To(Succeed())
+		g.Expect(getWorkloadTokens(g, workloadClient)).To(Equal(map[string][]byte{token2: expiry}))
+
+		// revoking again is a no-op
+		g.Expect(m.Revoke(context.Background(), cluster, "machine-1")).To(Succeed())
+	})
+
+	t.Run("ReissueReusesToken", func(t *testing.T) {
+		g := NewWithT(t)
+		m, workloadClient := newManager()
+
+		token1, err := m.Issue(context.Background(), cluster, "machine-1", time.Hour)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		// the bootstrap data is regenerated while the machine may already boot with the first token
+		now = now.Add(30 * time.Minute)
+		token2, err := m.Issue(context.Background(), cluster, "machine-1", time.Hour)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(token2).To(Equal(token1))
+
+		expiry := []byte(strconv.FormatInt(now.Add(time.Hour).Unix(), 10))
+		g.Expect(getWorkloadTokens(g, workloadClient)).To(Equal(map[string][]byte{token1: expiry}))
+	})
+
+	t.Run("ReissueReplacesExpiredToken", func(t *testing.T) {
+		g := NewWithT(t)
+		m, workloadClient := newManager()
+
+		token1, err := m.Issue(context.Background(), cluster, "machine-1", time.Minute)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		now = now.Add(time.Hour)
+		token2, err := m.Issue(context.Background(), cluster, "machine-1", time.Hour)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(token2).NotTo(Equal(token1))
+
+		tokens := getWorkloadTokens(g, workloadClient)
+		g.Expect(tokens).To(HaveKey(token2))
+		g.Expect(tokens).NotTo(HaveKey(token1))
+	})
+
+	t.Run("ExpiredTokensArePruned", func(t *testing.T) {
+		g := NewWithT(t)
+		m, workloadClient := newManager()
+
+		token1, err := m.Issue(context.Background(), cluster, "machine-1", time.Minute)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		now = now.Add(time.Hour)
+		token2, err := m.Issue(context.Background(), cluster, "machine-2", time.Minute)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		tokens := getWorkloadTokens(g, workloadClient)
+		g.Expect(tokens).To(HaveKey(token2))
+		g.Expect(tokens).NotTo(HaveKey(token1))
+	})
+
+	t.Run("RevokeWithoutTokens", func(t *testing.T) {
+		g := NewWithT(t)
+		m := NewManager(logr.Discard(), fake.NewClientBuilder().WithScheme(scheme).Build(), func(context.Context, *clusterv1.Cluster) (client.Client, error) {
+			t.Fatal("workload cluster must not be contacted")
+			return nil, nil
+		})
+
+		g.Expect(m.Revoke(context.Background(), cluster, "machine-1")).To(Succeed())
+	})
+	t.Run("Enable", func(t *testing.T) {
+		g := NewWithT(t)
+		m := NewManager(logr.Discard(), fake.NewClientBuilder().WithScheme(scheme).Build(), func(context.Context, *clusterv1.Cluster) (client.Client, error) {
+			t.Fatal("workload cluster must not be contacted")
+			return nil, nil
+		})
+
+		enabled, err := m.Enabled(context.Background(), cluster)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(enabled).To(BeFalse())
+
+		g.Expect(m.Enable(context.Background(), cluster)).To(Succeed())
+		enabled, err = m.Enabled(context.Background(), cluster)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(enabled).To(BeTrue())
+
+		// enabling again is a no-op
+		g.Expect(m.Enable(context.Background(), cluster)).To(Succeed())
+	})
+}
@@ -27,9 +27,11 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	bsutil "sigs.k8s.io/cluster-api/bootstrap/util"
 )
 
 const semaphoreInformationKey = "lock-information"
@@ -48,11 +50,11 @@ func NewControlPlaneInitMutex(log logr.Logger, client client.Client) *ControlPla
 	}
 }
 
-// Lock allows a control plane node to be the first and only node to run kubeadm init.
-func (c *ControlPlaneInitMutex) Lock(ctx context.Context, cluster *clusterv1.Cluster, machine *clusterv1.Machine) bool {
+// Lock allows a config owner (Machine or MachinePool) to be the only one generating bootstrap data.
+func (c *ControlPlaneInitMutex) Lock(ctx context.Context, cluster *clusterv1.Cluster, owner *bsutil.ConfigOwner) bool {
 	sema := newSemaphore()
 	cmName := configMapName(cluster.Name)
-	log := c.log.WithValues("namespace", cluster.Namespace, "cluster-name", cluster.Name, "configmap-name", cmName, "machine-name", machine.Name)
+	log := c.log.WithValues("namespace", cluster.Namespace, "cluster-name", cluster.Name, "configmap-name", cmName, "owner-kind", owner.GetKind(), "owner-name", owner.GetName())
 	err := c.client.Get(ctx, client.ObjectKey{
 		Namespace: cluster.Namespace,
 		Name:      cmName,
@@ -69,29 +71,29 @@ func (c *ControlPlaneInitMutex) Lock(ctx context.Context, cluster *clusterv1.Clu
 			log.Error(err, "Failed to get information about the existing lock")
 			return false
 		}
-		// The machine requesting the lock is the machine that created the lock, therefore the lock is acquired.
-		if info.MachineName == machine.Name {
+		// The owner requesting the lock is the owner that created the lock, therefore the lock is acquired.
+		if info.isHeldBy(owner) {
 			return true
 		}
 
-		// If the machine that created the lock can not be found unlock the mutex.
+		// If the owner that created the lock can not be found unlock the mutex.
 		if err := c.client.Get(ctx, client.ObjectKey{
 			Namespace: cluster.Namespace,
-			Name:      info.MachineName,
-		}, &clusterv1.Machine{}); err != nil {
-			log.Error(err, "Failed to get machine holding ControlPlane lock")
+			Name:      info.ownerName(),
+		}, info.ownerObject()); err != nil {
+			log.Error(err, "Failed to get owner holding ControlPlane lock")
 			if apierrors.IsNotFound(err) {
 				c.Unlock(ctx, cluster)
 			}
 		}
-		log.Info("Waiting on another machine to initialize", "init-machine", info.MachineName)
+		log.Info("Waiting on another owner to initialize", "init-owner-kind", info.ownerKind(), "init-owner", info.ownerName())
 		return false
 	}
 
 	// Adds owner reference, namespace and name
 	sema.setMetadata(cluster)
 	// Adds the additional information
-	if err := sema.setInformation(&information{MachineName: machine.Name}); err != nil {
+	if err := sema.setInformation(newInformation(owner)); err != nil {
 		log.Error(err, "Failed to acquire lock while setting semaphore information")
 		return false
 	}
@@ -140,8 +142,54 @@ func (c *ControlPlaneInitMutex) Unlock(ctx context.Context, cluster *clusterv1.C
 	}
 }
 
+// information describes the owner holding the lock. Locks created by older versions only
+// record the MachineName, therefore an empty OwnerKind refers to a Machine.
 type information struct {
-	MachineName string `json:"machineName"`
+	MachineName     string `json:"machineName,omitempty"`
+	OwnerAPIVersion string `json:"ownerAPIVersion,omitempty"`
+	OwnerKind       string `json:"ownerKind,omitempty"`
+	OwnerName       string `json:"ownerName,omitempty"`
+}
+
+func newInformation(owner *bsutil.ConfigOwner) *information {
+	info := &information{
+		OwnerAPIVersion: owner.GetAPIVersion(),
+		OwnerKind:       owner.GetKind(),
+		OwnerName:       owner.GetName(),
+	}
+	if owner.GetKind() == "Machine" {
+		info.MachineName = owner.GetName()
+	}
+	return info
+}
+
+func (i *information) ownerKind() string {
+	if i.OwnerKind == "" {
+		return "Machine"
+	}
+	return i.OwnerKind
+}
+
+func (i *information) ownerName() string {
+	if i.OwnerName == "" {
+		return i.MachineName
+	}
+	return i.OwnerName
+}
+
+func (i *information) isHeldBy(owner *bsutil.ConfigOwner) bool {
+	return i.ownerKind() == owner.GetKind() && i.ownerName() == owner.GetName()
+}
+
+// ownerObject returns an empty object of the kind of the owner holding the lock.
+func (i *information) ownerObject() client.Object {
+	if i.OwnerKind == "" {
+		return &clusterv1.Machine{}
+	}
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(i.OwnerAPIVersion)
+	u.SetKind(i.OwnerKind)
+	return u
 }
 
 type semaphore struct {
@@ -28,6 +28,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -37,6 +38,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	bsutil "sigs.k8s.io/cluster-api/bootstrap/util"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 )
 
 const (
@@ -118,11 +121,7 @@ func TestControlPlaneInitMutex_Lock(t *testing.T) {
 					UID:       uid,
 				},
 			}
-			machine := &clusterv1.Machine{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: fmt.Sprintf("machine-%s", cluster.Name),
-				},
-			}
+			machine := newOwner("Machine", fmt.Sprintf("machine-%s", cluster.Name))
 
 			gs.Expect(l.Lock(ctx, cluster, machine)).To(Equal(tc.shouldAcquire))
 		})
@@ -192,11 +191,7 @@ func TestControlPlaneInitMutex_LockWithMachineDeletion(t *testing.T) {
 					Name:      clusterName,
 				},
 			}
-			machine := &clusterv1.Machine{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: newMachineName,
-				},
-			}
+			machine := newOwner("Machine", newMachineName)
 
 			g.Eventually(func(g Gomega) error {
 				l.Lock(ctx, cluster, machine)
@@ -217,6 +212,58 @@ func TestControlPlaneInitMutex_LockWithMachineDeletion(t *testing.T) {
 	}
 }
 
+func TestControlPlaneInitMutex_LockWithMachinePool(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(expv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	c := &fakeClient{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&expv1.MachinePool{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pool-a",
+					Namespace: clusterNamespace,
+				},
+			},
+		).Build(),
+	}
+	l := &ControlPlaneInitMutex{
+		log:    log.Log,
+		client: c,
+	}
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: clusterNamespace,
+			Name:      clusterName,
+		},
+	}
+
+	poolA := newOwner("MachinePool", "pool-a")
+	g.Expect(l.Lock(ctx, cluster, poolA)).To(BeTrue())
+	g.Expect(l.Lock(ctx, cluster, poolA)).To(BeTrue(), "the owner holding the lock should be able to re-acquire it")
+
+	g.Expect(l.Lock(ctx, cluster, newOwner("MachinePool", "pool-b"))).To(BeFalse())
+	g.Expect(l.Lock(ctx, cluster, newOwner("Machine", "pool-a"))).To(BeFalse(), "a Machine with the same name as the holding MachinePool should not acquire the lock")
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Name: configMapName(clusterName), Namespace: clusterNamespace}, cm)).To(Succeed())
+	info, err := semaphore{cm}.information()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info).To(Equal(&information{
+		OwnerAPIVersion: expv1.GroupVersion.String(),
+		OwnerKind:       "MachinePool",
+		OwnerName:       "pool-a",
+	}))
+
+	// release the lock once the MachinePool holding it is gone
+	g.Expect(c.Delete(ctx, &expv1.MachinePool{ObjectMeta: metav1.ObjectMeta{Name: "pool-a", Namespace: clusterNamespace}})).To(Succeed())
+	g.Expect(l.Lock(ctx, cluster, newOwner("MachinePool", "pool-b"))).To(BeFalse())
+	g.Expect(l.Lock(ctx, cluster, newOwner("MachinePool", "pool-b"))).To(BeTrue())
+}
+
 func TestControlPlaneInitMutex_UnLock(t *testing.T) {
 	uid := types.UID("test-uid")
 	configMap := &corev1.ConfigMap{
@@ -320,18 +367,14 @@ func TestInfoLines_Lock(t *testing.T) {
 			UID:       uid,
 		},
 	}
-	machine := &clusterv1.Machine{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: fmt.Sprintf("machine-%s", cluster.Name),
-		},
-	}
+	machine := newOwner("Machine", fmt.Sprintf("machine-%s", cluster.Name))
 
 	g.Expect(l.Lock(ctx, cluster, machine)).To(BeFalse())
 
 	foundLogLine := false
 	for _, line := range logtester.InfoLog {
 		for k, v := range line.data {
-			if k == "init-machine" && v.(string) == "my-control-plane" {
+			if k == "init-owner" && v.(string) == "my-control-plane" {
 				foundLogLine = true
 			}
 		}
@@ -340,6 +383,20 @@ func TestInfoLines_Lock(t *testing.T) {
 	g.Expect(foundLogLine).To(BeTrue())
 }
 
+func newOwner(kind string, name string) *bsutil.ConfigOwner {
+	u := &unstructured.Unstructured{}
+	switch kind {
+	case "MachinePool":
+		u.SetAPIVersion(expv1.GroupVersion.String())
+	default:
+		u.SetAPIVersion(clusterv1.GroupVersion.String())
+	}
+	u.SetKind(kind)
+	u.SetName(name)
+	u.SetNamespace(clusterNamespace)
+	return &bsutil.ConfigOwner{Unstructured: u}
+}
+
 type fakeClient struct {
 	client.Client
 	getError    error
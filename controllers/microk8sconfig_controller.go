@@ -17,16 +17,9 @@ limitations under the License.
 package controllers
 
 import (
-	"bytes"
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
 	"fmt"
-	"math/big"
-	mrand "math/rand"
+	"strconv"
 	"time"
 
 	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
@@ -34,19 +27,23 @@ import (
 
 	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
 
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/jointoken"
 	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/locking"
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/progress"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/utils/pointer"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	bsutil "sigs.k8s.io/cluster-api/bootstrap/util"
+	"sigs.k8s.io/cluster-api/controllers/remote"
 	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 	"sigs.k8s.io/cluster-api/feature"
 	"sigs.k8s.io/cluster-api/util"
@@ -62,10 +59,17 @@ import (
 )
 
 type InitLocker interface {
-	Lock(ctx context.Context, cluster *clusterv1.Cluster, machine *clusterv1.Machine) bool
+	Lock(ctx context.Context, cluster *clusterv1.Cluster, owner *bsutil.ConfigOwner) bool
 	Unlock(ctx context.Context, cluster *clusterv1.Cluster) bool
 }
 
+type JoinTokenManager interface {
+	Enable(ctx context.Context, cluster *clusterv1.Cluster) error
+	Enabled(ctx context.Context, cluster *clusterv1.Cluster) (bool, error)
+	Issue(ctx context.Context, cluster *clusterv1.Cluster, machineName string, ttl time.Duration) (string, error)
+	Revoke(ctx context.Context, cluster *clusterv1.Cluster, machineName string) error
+}
+
 // MicroK8sConfigReconciler reconciles a MicroK8sConfig object
 type MicroK8sConfigReconciler struct {
 	client.Client
@@ -73,6 +77,13 @@ type MicroK8sConfigReconciler struct {
 	// WatchFilterValue is the label value used to filter events prior to reconciliation.
 	WatchFilterValue string
 	MicroK8sInitLock InitLocker
+	JoinTokens       JoinTokenManager
+	// Tracker provides cached clients for the workload clusters.
+	Tracker *remote.ClusterCacheTracker
+	// WorkloadClient returns a client for a workload cluster. It defaults to the clients of the Tracker.
+	WorkloadClient jointoken.WorkloadClientFunc
+	// ProgressURL is the URL that machines report their bootstrap progress to. Progress is not reported if empty.
+	ProgressURL string
 }
 
 // Scope is a scoped struct used during reconciliation.
@@ -84,16 +95,13 @@ type Scope struct {
 }
 
 const (
-	defaultDqlitePort  string = "19001"
-	remappedDqlitePort string = "2379"
-
-	defaultClusterAgentPort  string = "25000"
-	remappedClusterAgentPort string = "30000"
+	defaultPerMachineJoinTokenTTLInSecs int64 = 3600
 )
 
 var (
-	// preferMachineAddressTypeList is the order of preference of machine addresses to use for joining microk8s nodes to a cluster.
-	preferMachineAddressTypeList = []clusterv1.MachineAddressType{
+	// defaultJoinAddressTypes is the default order of preference of machine addresses to use for joining microk8s
+	// nodes to a cluster.
+	defaultJoinAddressTypes = []clusterv1.MachineAddressType{
 		clusterv1.MachineInternalIP,
 		clusterv1.MachineExternalIP,
 	}
@@ -103,6 +111,7 @@ var (
 //+kubebuilder:rbac:groups=bootstrap.cluster.x-k8s.io,resources=microk8sconfigs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=bootstrap.cluster.x-k8s.io,resources=microk8sconfigs/finalizers,verbs=update
 //+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/finalizers;clusters/status;machines;machines/finalizers;machines/status,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinepools;machinepools/status,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=configmaps;secrets,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -209,8 +218,23 @@ func (r *MicroK8sConfigReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, nil
 	// Status is ready means a config has been generated.
 	case config.Status.Ready:
-		// Just return as the config is already generated and need not be generated again.
-		return ctrl.Result{}, nil
+		// Revoke the join token of the machine once it has joined the cluster.
+		if err := r.revokeJoinToken(ctx, scope); err != nil {
+			log.Error(err, "Failed to revoke join token")
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		}
+		// The config is already generated and need not be generated again, unless the spec or the content of the
+		// secrets and configmaps it references changed before the infrastructure of the owner was provisioned. A
+		// per-machine join token that was issued for the owner is reused when regenerating, so a machine that
+		// already boots with the previous data can still join.
+		regenerate, err := r.shouldRegenerateBootstrapData(ctx, scope)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !regenerate {
+			return ctrl.Result{}, nil
+		}
+		log.Info("MicroK8sConfig changed before the infrastructure was provisioned, regenerating bootstrap data")
 	}
 
 	// Note: can't use IsFalse here because we need to handle the absence of the condition as well as false.
@@ -245,15 +269,16 @@ func (r *MicroK8sConfigReconciler) handleClusterNotInitialized(ctx context.Conte
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	machine := &clusterv1.Machine{}
-	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(scope.ConfigOwner.Object, machine); err != nil {
-		return ctrl.Result{}, errors.Wrapf(err, "cannot convert %s to Machine", scope.ConfigOwner.GetKind())
+	kubernetesVersion, err := getKubernetesVersion(scope)
+	if err != nil {
+		scope.Error(err, "Failed to get a valid Kubernetes version")
+		return ctrl.Result{}, nil
 	}
 
 	// acquire the init lock so that only the first machine configured
 	// as control plane get processed here
 	// if not the first, requeue
-	if !r.MicroK8sInitLock.Lock(ctx, scope.Cluster, machine) {
+	if !r.MicroK8sInitLock.Lock(ctx, scope.Cluster, scope.ConfigOwner) {
 		scope.Info("A control plane is already being initialized, requeueing until control plane is ready")
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
@@ -268,62 +293,109 @@ func (r *MicroK8sConfigReconciler) handleClusterNotInitialized(ctx context.Conte
 
 	scope.Info("Creating BootstrapData for the init control plane")
 
-	microk8sConfig := &bootstrapclusterxk8siov1beta1.MicroK8sConfig{}
-	if err := r.Client.Get(ctx, client.ObjectKey{
-		Namespace: machine.Spec.Bootstrap.ConfigRef.Namespace,
-		Name:      machine.Spec.Bootstrap.ConfigRef.Name,
-	}, microk8sConfig); err != nil {
-		return ctrl.Result{}, err
+	microk8sConfig := scope.Config
+	initConfig := initConfiguration(microk8sConfig)
+
+	// with per-machine join tokens, the init node registers the tokens issued for the joining machines instead.
+	// The init node decides whether the cluster uses per-machine join tokens.
+	var token string
+	if perMachineJoinTokens(microk8sConfig) {
+		if err := r.JoinTokens.Enable(ctx, scope.Cluster); err != nil {
+			scope.Info("Failed to enable per-machine join tokens, requeueing", "reason", err.Error())
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		}
+	} else {
+		token, err = r.getJoinToken(ctx, scope)
+		if err != nil {
+			scope.Info("Failed to get or generate the join token, requeueing", "reason", err.Error())
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		}
 	}
 
-	token, err := r.getJoinToken(ctx, scope)
+	cert, key, err := r.getCA(ctx, scope)
 	if err != nil {
-		scope.Info("Failed to get or generate the join token, requeueing")
+		if errors.Is(err, errInvalidCA) {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.CertificatesAvailableCondition, bootstrapclusterxk8siov1beta1.InvalidCAReason, clusterv1.ConditionSeverityError, "%v", err)
+		} else {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.CertificatesAvailableCondition, bootstrapclusterxk8siov1beta1.CertificatesGenerationFailedReason, clusterv1.ConditionSeverityWarning, "%v", err)
+		}
+		scope.Info("Failed to get or generate the CA, requeueing", "reason", err.Error())
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
+	conditions.MarkTrue(scope.Config, bootstrapclusterxk8siov1beta1.CertificatesAvailableCondition)
 
-	cert, key, err := r.getCA(ctx, scope)
+	portOfClusterAgent, portOfDqlite, portOfAPIServer := clusterPorts(microk8sConfig)
+
+	registries, err := r.getRegistries(ctx, scope)
 	if err != nil {
-		scope.Info("Failed to get or generate the CA, requeueing")
+		if errors.Is(err, errRegistryCredentials) {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.RegistryCredentialsUnavailableReason, clusterv1.ConditionSeverityWarning, "%v", err)
+		}
+		scope.Info("Failed to get the registry credentials, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+	writeFiles, err := r.getWriteFiles(ctx, scope, initConfig.ExtraWriteFiles)
+	if err != nil {
+		if errors.Is(err, errFileContentUnavailable) {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.FileContentUnavailableReason, clusterv1.ConditionSeverityWarning, "%v", err)
+		}
+		scope.Info("Failed to get the content of the extra files, requeueing", "reason", err.Error())
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	portOfClusterAgent := defaultClusterAgentPort
-	portOfDqlite := defaultDqlitePort
-	if microk8sConfig.Spec.ClusterConfiguration == nil ||
-		microk8sConfig.Spec.ClusterConfiguration.PortCompatibilityRemap {
-		portOfClusterAgent = remappedClusterAgentPort
-		portOfDqlite = remappedDqlitePort
+	progressReport, err := r.getProgressReport(ctx, scope, progress.StepInstall, progress.StepAddons)
+	if err != nil {
+		scope.Info("Failed to get the progress token, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
 	controlPlaneInput := &cloudinit.ControlPlaneInitInput{
-		CACert:               *cert,
-		CAKey:                *key,
-		ControlPlaneEndpoint: scope.Cluster.Spec.ControlPlaneEndpoint.Host,
-		Token:                token,
-		TokenTTL:             microk8sConfig.Spec.InitConfiguration.JoinTokenTTLInSecs,
-		KubernetesVersion:    *machine.Spec.Version,
-		ClusterAgentPort:     portOfClusterAgent,
-		DqlitePort:           portOfDqlite,
-		Addons:               microk8sConfig.Spec.InitConfiguration.Addons,
-		IPinIP:               microk8sConfig.Spec.InitConfiguration.IPinIP,
-		ContainerdHTTPProxy:  microk8sConfig.Spec.InitConfiguration.HTTPProxy,
-		ContainerdHTTPSProxy: microk8sConfig.Spec.InitConfiguration.HTTPSProxy,
-		ContainerdNoProxy:    microk8sConfig.Spec.InitConfiguration.NoProxy,
-		SnapstoreProxyDomain: microk8sConfig.Spec.InitConfiguration.SnapstoreProxyDomain,
-		SnapstoreProxyId:     microk8sConfig.Spec.InitConfiguration.SnapstoreProxyId,
-		Confinement:          microk8sConfig.Spec.InitConfiguration.Confinement,
-		RiskLevel:            microk8sConfig.Spec.InitConfiguration.RiskLevel,
-		ExtraWriteFiles:      cloudinit.WriteFilesFromAPI(microk8sConfig.Spec.InitConfiguration.ExtraWriteFiles),
-		ExtraKubeletArgs:     microk8sConfig.Spec.InitConfiguration.ExtraKubeletArgs,
-		SnapstoreHTTPProxy:   microk8sConfig.Spec.InitConfiguration.SnapstoreHTTPProxy,
-		SnapstoreHTTPSProxy:  microk8sConfig.Spec.InitConfiguration.SnapstoreHTTPSProxy,
-		BootCommands:         microk8sConfig.Spec.InitConfiguration.BootCommands,
-		PreRunCommands:       microk8sConfig.Spec.InitConfiguration.PreRunCommands,
-		PostRunCommands:      microk8sConfig.Spec.InitConfiguration.PostRunCommands,
+		CACert:                 *cert,
+		CAKey:                  *key,
+		ControlPlaneEndpoint:   scope.Cluster.Spec.ControlPlaneEndpoint.Host,
+		Token:                  token,
+		TokenTTL:               initConfig.JoinTokenTTLInSecs,
+		JoinTokenSync:          perMachineJoinTokens(microk8sConfig),
+		KubernetesVersion:      kubernetesVersion,
+		ClusterAgentPort:       portOfClusterAgent,
+		DqlitePort:             portOfDqlite,
+		APIServerPort:          portOfAPIServer,
+		NativeAPIServerPort:    nativeAPIServerPort(microk8sConfig),
+		PodCIDR:                podCIDR(microk8sConfig),
+		ServiceCIDR:            serviceCIDR(microk8sConfig),
+		ClusterDomain:          clusterDomain(microk8sConfig),
+		CNI:                    cni(microk8sConfig),
+		CertSANs:               certSANs(microk8sConfig),
+		Addons:                 cloudinit.AddonsFromAPI(initConfig.Addons, initConfig.AddonConfigs),
+		DisableDefaultDNS:      initConfig.DisableDefaultDNS,
+		AddonRepositories:      cloudinit.AddonRepositoriesFromAPI(initConfig.AddonRepositories),
+		DisableCommunityAddons: initConfig.DisableCommunityAddons,
+		IPinIP:                 initConfig.IPinIP,
+		ContainerdHTTPProxy:    initConfig.HTTPProxy,
+		ContainerdHTTPSProxy:   initConfig.HTTPSProxy,
+		ContainerdNoProxy:      initConfig.NoProxy,
+		SnapstoreProxyDomain:   initConfig.SnapstoreProxyDomain,
+		SnapstoreProxyId:       initConfig.SnapstoreProxyId,
+		Confinement:            initConfig.Confinement,
+		RiskLevel:              initConfig.RiskLevel,
+		SnapRevision:           initConfig.SnapRevision,
+		Installation:           cloudinit.InstallationFromAPI(initConfig.Installation),
+		SnapRefresh:            cloudinit.SnapRefreshFromAPI(initConfig.SnapRefresh),
+		ExtraWriteFiles:        writeFiles,
+		ExtraKubeletArgs:       initConfig.ExtraKubeletArgs,
+		NodeLabels:             initConfig.NodeLabels,
+		NodeTaints:             cloudinit.TaintsFromAPI(initConfig.NodeTaints),
+		ExtraServiceArgs:       cloudinit.ServiceArgsFromAPI(initConfig),
+		Registries:             registries,
+		SnapstoreHTTPProxy:     initConfig.SnapstoreHTTPProxy,
+		SnapstoreHTTPSProxy:    initConfig.SnapstoreHTTPSProxy,
+		ProgressReport:         progressReport,
+		BootCommands:           initConfig.BootCommands,
+		PreRunCommands:         initConfig.PreRunCommands,
+		PostRunCommands:        initConfig.PostRunCommands,
 	}
 	if controlPlaneInput.TokenTTL == 0 {
-		controlPlaneInput.TokenTTL = 315569260
+		controlPlaneInput.TokenTTL = bootstrapclusterxk8siov1beta1.DefaultJoinTokenTTLInSecs
 	}
 
 	bootstrapInitData, err := cloudinit.NewInitControlPlane(controlPlaneInput)
@@ -333,13 +405,13 @@ func (r *MicroK8sConfigReconciler) handleClusterNotInitialized(ctx context.Conte
 		return ctrl.Result{}, err
 	}
 
-	b, err := cloudinit.GenerateCloudConfig(bootstrapInitData)
+	b, err := cloudinit.GenerateBootstrapData(microk8sConfig.Spec.Format, bootstrapInitData)
 	if err != nil {
 		scope.Error(err, "Failed to render user data for bootstrap control plane")
 		return ctrl.Result{}, err
 	}
 
-	if err := r.storeBootstrapData(ctx, scope, b); err != nil {
+	if err := r.storeBootstrapData(ctx, scope, microk8sConfig.Spec.Format, b); err != nil {
 		scope.Error(err, "Failed to store bootstrap data")
 		return ctrl.Result{}, err
 	}
@@ -353,13 +425,14 @@ func (r *MicroK8sConfigReconciler) handleJoiningControlPlaneNode(ctx context.Con
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	machine := &clusterv1.Machine{}
-	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(scope.ConfigOwner.Object, machine); err != nil {
-		return ctrl.Result{}, errors.Wrapf(err, "cannot convert %s to Machine", scope.ConfigOwner.GetKind())
+	kubernetesVersion, err := getKubernetesVersion(scope)
+	if err != nil {
+		scope.Error(err, "Failed to get a valid Kubernetes version")
+		return ctrl.Result{}, nil
 	}
 
 	// acquire the init lock so that only only one machine joins each time
-	if !r.MicroK8sInitLock.Lock(ctx, scope.Cluster, machine) {
+	if !r.MicroK8sInitLock.Lock(ctx, scope.Cluster, scope.ConfigOwner) {
 		scope.Info("A node is already being handled, requeueing until cluster can be extended with this node")
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
@@ -379,54 +452,92 @@ func (r *MicroK8sConfigReconciler) handleJoiningControlPlaneNode(ctx context.Con
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	microk8sConfig := &bootstrapclusterxk8siov1beta1.MicroK8sConfig{}
-	if err := r.Client.Get(ctx, client.ObjectKey{
-		Namespace: machine.Spec.Bootstrap.ConfigRef.Namespace,
-		Name:      machine.Spec.Bootstrap.ConfigRef.Name,
-	}, microk8sConfig); err != nil {
-		return ctrl.Result{}, err
+	microk8sConfig := scope.Config
+	initConfig := initConfiguration(microk8sConfig)
+	joinConfig := joinConfiguration(microk8sConfig)
+
+	portOfNodeToConnectTo, portOfDqlite, portOfAPIServer := clusterPorts(microk8sConfig)
+
+	token, joinTokenSync, err := r.getJoinTokenForOwner(ctx, scope)
+	if err != nil {
+		scope.Info("Failed to get or generate the join token, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	registries, err := r.getRegistries(ctx, scope)
+	if err != nil {
+		if errors.Is(err, errRegistryCredentials) {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.RegistryCredentialsUnavailableReason, clusterv1.ConditionSeverityWarning, "%v", err)
+		}
+		scope.Info("Failed to get the registry credentials, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+	writeFiles, err := r.getWriteFiles(ctx, scope, joinConfig.ExtraWriteFiles)
+	if err != nil {
+		if errors.Is(err, errFileContentUnavailable) {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.FileContentUnavailableReason, clusterv1.ConditionSeverityWarning, "%v", err)
+		}
+		scope.Info("Failed to get the content of the extra files, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	portOfNodeToConnectTo := defaultClusterAgentPort
-	portOfDqlite := defaultDqlitePort
-	if microk8sConfig.Spec.ClusterConfiguration == nil ||
-		microk8sConfig.Spec.ClusterConfiguration.PortCompatibilityRemap {
-		portOfNodeToConnectTo = remappedClusterAgentPort
-		portOfDqlite = remappedDqlitePort
+	snapRevision, err := r.getSnapRevision(ctx, scope)
+	if err != nil {
+		if errors.Is(err, errSnapRevisionNotPublished) {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.WaitingForSnapRevisionReason, clusterv1.ConditionSeverityInfo, "")
+		}
+		scope.Info("Failed to get the snap revision of the cluster, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	token, err := r.getJoinToken(ctx, scope)
+	progressReport, err := r.getProgressReport(ctx, scope, progress.StepInstall, progress.StepJoin)
 	if err != nil {
-		scope.Info("Failed to get or generate the join token, requeueing")
+		scope.Info("Failed to get the progress token, requeueing", "reason", err.Error())
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
 	controlPlaneInput := &cloudinit.ControlPlaneJoinInput{
 		ControlPlaneEndpoint: scope.Cluster.Spec.ControlPlaneEndpoint.Host,
 		Token:                token,
-		TokenTTL:             microk8sConfig.Spec.InitConfiguration.JoinTokenTTLInSecs,
+		TokenTTL:             initConfig.JoinTokenTTLInSecs,
+		JoinTokenSync:        joinTokenSync,
 		JoinNodeIPs:          ipsOfNodesToConnectTo,
-		KubernetesVersion:    *machine.Spec.Version,
+		KubernetesVersion:    kubernetesVersion,
 		ClusterAgentPort:     portOfNodeToConnectTo,
 		DqlitePort:           portOfDqlite,
-		IPinIP:               microk8sConfig.Spec.InitConfiguration.IPinIP,
-		ContainerdHTTPProxy:  microk8sConfig.Spec.InitConfiguration.HTTPProxy,
-		ContainerdHTTPSProxy: microk8sConfig.Spec.InitConfiguration.HTTPSProxy,
-		ContainerdNoProxy:    microk8sConfig.Spec.InitConfiguration.NoProxy,
-		SnapstoreProxyDomain: microk8sConfig.Spec.InitConfiguration.SnapstoreProxyDomain,
-		SnapstoreProxyId:     microk8sConfig.Spec.InitConfiguration.SnapstoreProxyId,
-		RiskLevel:            microk8sConfig.Spec.InitConfiguration.RiskLevel,
-		Confinement:          microk8sConfig.Spec.InitConfiguration.Confinement,
-		ExtraWriteFiles:      cloudinit.WriteFilesFromAPI(microk8sConfig.Spec.InitConfiguration.ExtraWriteFiles),
-		ExtraKubeletArgs:     microk8sConfig.Spec.InitConfiguration.ExtraKubeletArgs,
-		SnapstoreHTTPProxy:   microk8sConfig.Spec.InitConfiguration.SnapstoreHTTPProxy,
-		SnapstoreHTTPSProxy:  microk8sConfig.Spec.InitConfiguration.SnapstoreHTTPSProxy,
-		BootCommands:         microk8sConfig.Spec.InitConfiguration.BootCommands,
-		PreRunCommands:       microk8sConfig.Spec.InitConfiguration.PreRunCommands,
-		PostRunCommands:      microk8sConfig.Spec.InitConfiguration.PostRunCommands,
+		APIServerPort:        portOfAPIServer,
+		NativeAPIServerPort:  nativeAPIServerPort(microk8sConfig),
+		PodCIDR:              podCIDR(microk8sConfig),
+		ServiceCIDR:          serviceCIDR(microk8sConfig),
+		ClusterDomain:        clusterDomain(microk8sConfig),
+		CNI:                  cni(microk8sConfig),
+		CertSANs:             certSANs(microk8sConfig),
+		IPinIP:               initConfig.IPinIP,
+		ContainerdHTTPProxy:  initConfig.HTTPProxy,
+		ContainerdHTTPSProxy: initConfig.HTTPSProxy,
+		ContainerdNoProxy:    initConfig.NoProxy,
+		SnapstoreProxyDomain: initConfig.SnapstoreProxyDomain,
+		SnapstoreProxyId:     initConfig.SnapstoreProxyId,
+		RiskLevel:            initConfig.RiskLevel,
+		SnapRevision:         snapRevision,
+		Installation:         cloudinit.InstallationFromAPI(initConfig.Installation),
+		SnapRefresh:          cloudinit.SnapRefreshFromAPI(initConfig.SnapRefresh),
+		Confinement:          initConfig.Confinement,
+		ExtraWriteFiles:      writeFiles,
+		ExtraKubeletArgs:     joinConfig.ExtraKubeletArgs,
+		NodeLabels:           joinConfig.NodeLabels,
+		NodeTaints:           cloudinit.TaintsFromAPI(joinConfig.NodeTaints),
+		ExtraServiceArgs:     cloudinit.ServiceArgsFromAPI(initConfig),
+		Registries:           registries,
+		SnapstoreHTTPProxy:   initConfig.SnapstoreHTTPProxy,
+		SnapstoreHTTPSProxy:  initConfig.SnapstoreHTTPSProxy,
+		ProgressReport:       progressReport,
+		BootCommands:         joinConfig.BootCommands,
+		PreRunCommands:       joinConfig.PreRunCommands,
+		PostRunCommands:      joinConfig.PostRunCommands,
 	}
 	if controlPlaneInput.TokenTTL == 0 {
-		controlPlaneInput.TokenTTL = 315569260
+		controlPlaneInput.TokenTTL = bootstrapclusterxk8siov1beta1.DefaultJoinTokenTTLInSecs
 	}
 	bootstrapInitData, err := cloudinit.NewJoinControlPlane(controlPlaneInput)
 	if err != nil {
@@ -434,13 +545,13 @@ func (r *MicroK8sConfigReconciler) handleJoiningControlPlaneNode(ctx context.Con
 		return ctrl.Result{}, err
 	}
 
-	b, err := cloudinit.GenerateCloudConfig(bootstrapInitData)
+	b, err := cloudinit.GenerateBootstrapData(microk8sConfig.Spec.Format, bootstrapInitData)
 	if err != nil {
 		scope.Error(err, "Failed to render user data for joining control plane")
 		return ctrl.Result{}, err
 	}
 
-	if err := r.storeBootstrapData(ctx, scope, b); err != nil {
+	if err := r.storeBootstrapData(ctx, scope, microk8sConfig.Spec.Format, b); err != nil {
 		scope.Error(err, "Failed to store bootstrap data")
 		return ctrl.Result{}, err
 	}
@@ -454,13 +565,29 @@ func (r *MicroK8sConfigReconciler) handleJoiningWorkerNode(ctx context.Context,
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	machine := &clusterv1.Machine{}
-	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(scope.ConfigOwner.Object, machine); err != nil {
-		return ctrl.Result{}, errors.Wrapf(err, "cannot convert %s to Machine", scope.ConfigOwner.GetKind())
+	kubernetesVersion, err := getKubernetesVersion(scope)
+	if err != nil {
+		scope.Error(err, "Failed to get a valid Kubernetes version")
+		return ctrl.Result{}, nil
+	}
+
+	// MachinePools share their bootstrap data between instances, so they cannot use per-machine join tokens
+	if scope.ConfigOwner.IsMachinePool() {
+		perMachineJoinTokens, err := r.JoinTokens.Enabled(ctx, scope.Cluster)
+		if err != nil {
+			scope.Info("Failed to check for per-machine join tokens, requeueing", "reason", err.Error())
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		}
+		if perMachineJoinTokens {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.PerMachineJoinTokensUnsupportedReason, clusterv1.ConditionSeverityError,
+				"MachinePool %s cannot join cluster %s, which uses per-machine join tokens", scope.ConfigOwner.GetName(), scope.Cluster.Name)
+			scope.Info("MachinePools cannot join clusters that use per-machine join tokens")
+			return ctrl.Result{}, nil
+		}
 	}
 
 	// acquire the init lock so that only only one machine joins each time
-	if !r.MicroK8sInitLock.Lock(ctx, scope.Cluster, machine) {
+	if !r.MicroK8sInitLock.Lock(ctx, scope.Cluster, scope.ConfigOwner) {
 		scope.Info("A node is already being handled, requeueing until cluster can be extended with this node")
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
@@ -475,19 +602,11 @@ func (r *MicroK8sConfigReconciler) handleJoiningWorkerNode(ctx context.Context,
 
 	scope.Info("Creating BootstrapData for the joining worker")
 
-	microk8sConfig := &bootstrapclusterxk8siov1beta1.MicroK8sConfig{}
-	if err := r.Client.Get(ctx, client.ObjectKey{
-		Namespace: machine.Spec.Bootstrap.ConfigRef.Namespace,
-		Name:      machine.Spec.Bootstrap.ConfigRef.Name,
-	}, microk8sConfig); err != nil {
-		return ctrl.Result{}, err
-	}
+	microk8sConfig := scope.Config
+	initConfig := initConfiguration(microk8sConfig)
+	joinConfig := joinConfiguration(microk8sConfig)
 
-	portOfNodeToConnectTo := defaultClusterAgentPort
-	if microk8sConfig.Spec.ClusterConfiguration == nil ||
-		microk8sConfig.Spec.ClusterConfiguration.PortCompatibilityRemap {
-		portOfNodeToConnectTo = remappedClusterAgentPort
-	}
+	portOfNodeToConnectTo, _, portOfAPIServer := clusterPorts(microk8sConfig)
 
 	ipOfNodesToConnectTo, err := r.getControlPlaneNodesToJoin(ctx, scope)
 	if err != nil || len(ipOfNodesToConnectTo) == 0 {
@@ -495,37 +614,78 @@ func (r *MicroK8sConfigReconciler) handleJoiningWorkerNode(ctx context.Context,
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	token, err := r.getJoinToken(ctx, scope)
+	token, _, err := r.getJoinTokenForOwner(ctx, scope)
 	if err != nil {
-		scope.Info("Failed to get or generate the join token, requeueing")
+		scope.Info("Failed to get or generate the join token, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	registries, err := r.getRegistries(ctx, scope)
+	if err != nil {
+		if errors.Is(err, errRegistryCredentials) {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.RegistryCredentialsUnavailableReason, clusterv1.ConditionSeverityWarning, "%v", err)
+		}
+		scope.Info("Failed to get the registry credentials, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+	writeFiles, err := r.getWriteFiles(ctx, scope, joinConfig.ExtraWriteFiles)
+	if err != nil {
+		if errors.Is(err, errFileContentUnavailable) {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.FileContentUnavailableReason, clusterv1.ConditionSeverityWarning, "%v", err)
+		}
+		scope.Info("Failed to get the content of the extra files, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	snapRevision, err := r.getSnapRevision(ctx, scope)
+	if err != nil {
+		if errors.Is(err, errSnapRevisionNotPublished) {
+			conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.WaitingForSnapRevisionReason, clusterv1.ConditionSeverityInfo, "")
+		}
+		scope.Info("Failed to get the snap revision of the cluster, requeueing", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	progressReport, err := r.getProgressReport(ctx, scope, progress.StepInstall, progress.StepJoin)
+	if err != nil {
+		scope.Info("Failed to get the progress token, requeueing", "reason", err.Error())
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
 	workerInput := &cloudinit.WorkerInput{
 		ControlPlaneEndpoint: scope.Cluster.Spec.ControlPlaneEndpoint.Host,
 		Token:                token,
-		KubernetesVersion:    *machine.Spec.Version,
+		KubernetesVersion:    kubernetesVersion,
 		ClusterAgentPort:     portOfNodeToConnectTo,
 		JoinNodeIPs:          ipOfNodesToConnectTo,
-	}
-
-	if c := microk8sConfig.Spec.InitConfiguration; c != nil {
-		workerInput.ContainerdHTTPSProxy = c.HTTPSProxy
-		workerInput.ContainerdHTTPProxy = c.HTTPProxy
-		workerInput.ContainerdNoProxy = c.NoProxy
-		workerInput.SnapstoreProxyDomain = c.SnapstoreProxyDomain
-		workerInput.SnapstoreProxyId = c.SnapstoreProxyId
-		workerInput.SnapstoreHTTPProxy = c.SnapstoreHTTPProxy
-		workerInput.SnapstoreHTTPSProxy = c.SnapstoreHTTPSProxy
-
-		workerInput.Confinement = c.Confinement
-		workerInput.RiskLevel = c.RiskLevel
-
-		workerInput.ExtraKubeletArgs = c.ExtraKubeletArgs
-		workerInput.ExtraWriteFiles = cloudinit.WriteFilesFromAPI(c.ExtraWriteFiles)
-		workerInput.BootCommands = c.BootCommands
-		workerInput.PreRunCommands = c.PreRunCommands
-		workerInput.PostRunCommands = c.PostRunCommands
+		APIServerPort:        portOfAPIServer,
+		APIServerProxy:       workerAPIServerProxy(microk8sConfig),
+		PodCIDR:              podCIDR(microk8sConfig),
+		ServiceCIDR:          serviceCIDR(microk8sConfig),
+		ClusterDomain:        clusterDomain(microk8sConfig),
+		CNI:                  cni(microk8sConfig),
+		ContainerdHTTPProxy:  initConfig.HTTPProxy,
+		ContainerdHTTPSProxy: initConfig.HTTPSProxy,
+		ContainerdNoProxy:    initConfig.NoProxy,
+		SnapstoreProxyDomain: initConfig.SnapstoreProxyDomain,
+		SnapstoreProxyId:     initConfig.SnapstoreProxyId,
+		RiskLevel:            initConfig.RiskLevel,
+		SnapRevision:         snapRevision,
+		Installation:         cloudinit.InstallationFromAPI(initConfig.Installation),
+		SnapRefresh:          cloudinit.SnapRefreshFromAPI(initConfig.SnapRefresh),
+		Confinement:          initConfig.Confinement,
+		ExtraWriteFiles:      writeFiles,
+		ExtraKubeletArgs:     joinConfig.ExtraKubeletArgs,
+		NodeLabels:           joinConfig.NodeLabels,
+		NodeTaints:           cloudinit.TaintsFromAPI(joinConfig.NodeTaints),
+		ExtraServiceArgs:     cloudinit.ServiceArgsFromAPI(initConfig),
+		Registries:           registries,
+		SnapstoreHTTPProxy:   initConfig.SnapstoreHTTPProxy,
+		SnapstoreHTTPSProxy:  initConfig.SnapstoreHTTPSProxy,
+		ProgressReport:       progressReport,
+		BootCommands:         joinConfig.BootCommands,
+		PreRunCommands:       joinConfig.PreRunCommands,
+		PostRunCommands:      joinConfig.PostRunCommands,
 	}
 	bootstrapInitData, err := cloudinit.NewJoinWorker(workerInput)
 	if err != nil {
@@ -533,13 +693,13 @@ func (r *MicroK8sConfigReconciler) handleJoiningWorkerNode(ctx context.Context,
 		return ctrl.Result{}, err
 	}
 
-	b, err := cloudinit.GenerateCloudConfig(bootstrapInitData)
+	b, err := cloudinit.GenerateBootstrapData(microk8sConfig.Spec.Format, bootstrapInitData)
 	if err != nil {
 		scope.Error(err, "Failed to render user data for joining worker node")
 		return ctrl.Result{}, err
 	}
 
-	if err := r.storeBootstrapData(ctx, scope, b); err != nil {
+	if err := r.storeBootstrapData(ctx, scope, microk8sConfig.Spec.Format, b); err != nil {
 		scope.Error(err, "Failed to store bootstrap data")
 		return ctrl.Result{}, err
 	}
@@ -547,6 +707,12 @@ func (r *MicroK8sConfigReconciler) handleJoiningWorkerNode(ctx context.Context,
 	return ctrl.Result{}, nil
 }
 
+// clusterPorts returns the ports of the cluster agent, dqlite and the kube-apiserver.
+func clusterPorts(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) (clusterAgentPort string, dqlitePort string, apiServerPort string) {
+	clusterAgent, dqlite, apiServer := bootstrapclusterxk8siov1beta1.ClusterPorts(config.Spec.ClusterConfiguration)
+	return strconv.Itoa(int(clusterAgent)), strconv.Itoa(int(dqlite)), strconv.Itoa(int(apiServer))
+}
+
 func (r *MicroK8sConfigReconciler) getControlPlaneNodesToJoin(ctx context.Context, scope *Scope) ([]string, error) {
 	nodes, err := r.getControlPlaneMachinesForCluster(ctx, util.ObjectKey(scope.Cluster))
 	if err != nil {
@@ -567,22 +733,97 @@ func (r *MicroK8sConfigReconciler) getControlPlaneNodesToJoin(ctx context.Contex
 		}
 	}
 
-	for _, addressType := range preferMachineAddressTypeList {
+	addressTypes := joinAddressTypes(scope.Config)
+	for _, addressType := range addressTypes {
 		if addresses, ok := addressesByType[addressType]; ok && len(addresses) > 0 {
 			return addresses, nil
 		}
 	}
 
 	// if we are here, no addresses were found
-	err = fmt.Errorf("machines do not have any addresses with types %v", preferMachineAddressTypeList)
+	err = fmt.Errorf("machines do not have any addresses with types %v", addressTypes)
 	scope.Error(err, "Lookup control plane node IPs", "addressesByType", addressesByType)
 
 	return nil, err
 }
 
-func (r *MicroK8sConfigReconciler) storeBootstrapData(ctx context.Context, scope *Scope, data []byte) error {
+// getKubernetesVersion returns the Kubernetes version of the config owner, after checking it can be installed.
+// The owner is validated on admission, but the config may have been created or changed after its owner. Invalid
+// versions are reported on the DataSecretAvailable condition.
+func getKubernetesVersion(scope *Scope) (string, error) {
+	kubernetesVersion, err := ownerKubernetesVersion(scope.ConfigOwner)
+	if err == nil {
+		err = bootstrapclusterxk8siov1beta1.ValidateKubernetesVersion(kubernetesVersion, initConfiguration(scope.Config).Confinement)
+	}
+	if err != nil {
+		conditions.MarkFalse(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition, bootstrapclusterxk8siov1beta1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityError, "%v", err)
+		return "", err
+	}
+	return kubernetesVersion, nil
+}
+
+// initConfiguration returns the InitConfiguration of the config. Configs created before the defaulting
+// webhook was introduced may not have one.
+func initConfiguration(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) *bootstrapclusterxk8siov1beta1.InitConfiguration {
+	if config.Spec.InitConfiguration == nil {
+		return &bootstrapclusterxk8siov1beta1.InitConfiguration{}
+	}
+	return config.Spec.InitConfiguration
+}
+
+// joinConfiguration returns the JoinConfiguration of the config, with the fields that are not set taken from
+// the InitConfiguration.
+func joinConfiguration(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) *bootstrapclusterxk8siov1beta1.JoinConfiguration {
+	initConfig := initConfiguration(config)
+	joinConfig := &bootstrapclusterxk8siov1beta1.JoinConfiguration{}
+	if config.Spec.JoinConfiguration != nil {
+		joinConfig = config.Spec.JoinConfiguration.DeepCopy()
+	}
+	if joinConfig.ExtraWriteFiles == nil {
+		joinConfig.ExtraWriteFiles = initConfig.ExtraWriteFiles
+	}
+	if joinConfig.ExtraKubeletArgs == nil {
+		joinConfig.ExtraKubeletArgs = initConfig.ExtraKubeletArgs
+	}
+	if joinConfig.NodeLabels == nil {
+		joinConfig.NodeLabels = initConfig.NodeLabels
+	}
+	if joinConfig.NodeTaints == nil {
+		joinConfig.NodeTaints = initConfig.NodeTaints
+	}
+	if joinConfig.BootCommands == nil {
+		joinConfig.BootCommands = initConfig.BootCommands
+	}
+	if joinConfig.PreRunCommands == nil {
+		joinConfig.PreRunCommands = initConfig.PreRunCommands
+	}
+	if joinConfig.PostRunCommands == nil {
+		joinConfig.PostRunCommands = initConfig.PostRunCommands
+	}
+	return joinConfig
+}
+
+// ownerKubernetesVersion returns the Kubernetes version of a Machine or MachinePool config owner.
+// For MachinePools, the version is taken from the machine template of the pool.
+func ownerKubernetesVersion(owner *bsutil.ConfigOwner) (string, error) {
+	if v := owner.KubernetesVersion(); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("%s %s/%s does not specify a Kubernetes version", owner.GetKind(), owner.GetNamespace(), owner.GetName())
+}
+
+func (r *MicroK8sConfigReconciler) storeBootstrapData(ctx context.Context, scope *Scope, format bootstrapclusterxk8siov1beta1.Format, data []byte) error {
 	log := ctrl.LoggerFrom(ctx)
 
+	if format == "" {
+		format = bootstrapclusterxk8siov1beta1.FormatCloudConfig
+	}
+
+	hash, err := r.computeConfigHash(ctx, scope)
+	if err != nil {
+		return err
+	}
+
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      scope.Config.Name,
@@ -590,6 +831,9 @@ func (r *MicroK8sConfigReconciler) storeBootstrapData(ctx context.Context, scope
 			Labels: map[string]string{
 				clusterv1.ClusterLabelName: scope.Cluster.Name,
 			},
+			Annotations: map[string]string{
+				bootstrapclusterxk8siov1beta1.ConfigHashAnnotation: hash,
+			},
 			OwnerReferences: []metav1.OwnerReference{
 				{
 					APIVersion: bootstrapclusterxk8siov1beta1.GroupVersion.String(),
@@ -602,7 +846,7 @@ func (r *MicroK8sConfigReconciler) storeBootstrapData(ctx context.Context, scope
 		},
 		Data: map[string][]byte{
 			"value":  data,
-			"format": []byte("cloud-config"),
+			"format": []byte(format),
 		},
 		Type: clusterv1.ClusterSecretType,
 	}
@@ -614,13 +858,23 @@ func (r *MicroK8sConfigReconciler) storeBootstrapData(ctx context.Context, scope
 			return errors.Wrapf(err, "failed to create bootstrap data secret for MicroK8sConfig %s/%s", scope.Config.Namespace, scope.Config.Name)
 		}
 		log.Info("bootstrap data secret for MicroK8sConfig already exists, updating", "secret", secret.Name, "MicroK8sConfig", scope.Config.Name)
-		if err := r.Client.Update(ctx, secret); err != nil {
+		existing := &corev1.Secret{}
+		if err := r.Client.Get(ctx, client.ObjectKeyFromObject(secret), existing); err != nil {
+			return errors.Wrapf(err, "failed to get bootstrap data secret for MicroK8sConfig %s/%s", scope.Config.Namespace, scope.Config.Name)
+		}
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		existing.Annotations[bootstrapclusterxk8siov1beta1.ConfigHashAnnotation] = hash
+		existing.Data = secret.Data
+		if err := r.Client.Update(ctx, existing); err != nil {
 			return errors.Wrapf(err, "failed to update bootstrap data secret for MicroK8sConfig %s/%s", scope.Config.Namespace, scope.Config.Name)
 		}
 	}
 	scope.Config.Status.DataSecretName = pointer.StringPtr(secret.Name)
 	scope.Config.Status.Ready = true
 	conditions.MarkTrue(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretAvailableCondition)
+	conditions.MarkTrue(scope.Config, bootstrapclusterxk8siov1beta1.DataSecretUpToDateCondition)
 	return nil
 }
 
@@ -640,12 +894,10 @@ func (r *MicroK8sConfigReconciler) getJoinToken(ctx context.Context, scope *Scop
 	}
 
 	if !found {
-		const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-		b := make([]byte, 32)
-		for i := range b {
-			b[i] = letters[mrand.Intn(len(letters))]
+		token, err := jointoken.Generate()
+		if err != nil {
+			return "", err
 		}
-		token := string(b)
 		tokenSecret := &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace: scope.Cluster.Namespace,
@@ -676,113 +928,131 @@ func (r *MicroK8sConfigReconciler) getJoinToken(ctx context.Context, scope *Scop
 	return string(readTokenSecret.Data["value"]), nil
 }
 
-func (r *MicroK8sConfigReconciler) getCA(ctx context.Context, scope *Scope) (cert *string, key *string, err error) {
-	// See if the CA cert exists. If not create it.
-	secrets := &corev1.SecretList{}
-	err = r.Client.List(ctx, secrets)
+// getJoinTokenForOwner returns the token the config owner uses to join the cluster, and whether the cluster uses
+// per-machine join tokens. In that case, a new short-lived token is issued for the Machine, otherwise the cluster
+// join token is used.
+func (r *MicroK8sConfigReconciler) getJoinTokenForOwner(ctx context.Context, scope *Scope) (string, bool, error) {
+	enabled, err := r.JoinTokens.Enabled(ctx, scope.Cluster)
 	if err != nil {
-		return nil, nil, err
+		return "", false, err
+	}
+	if !enabled {
+		token, err := r.getJoinToken(ctx, scope)
+		return token, false, err
+	}
+	if scope.ConfigOwner.IsMachinePool() {
+		return "", true, fmt.Errorf("per-machine join tokens are not supported for MachinePool %s/%s", scope.ConfigOwner.GetNamespace(), scope.ConfigOwner.GetName())
 	}
 
-	found := false
-	for _, s := range secrets.Items {
-		if s.Name == scope.Cluster.Name+"-ca" {
-			found = true
-		}
+	var ttl int64
+	if c := scope.Config.Spec.ClusterConfiguration; c != nil {
+		ttl = c.PerMachineJoinTokenTTLInSecs
+	}
+	if ttl == 0 {
+		ttl = defaultPerMachineJoinTokenTTLInSecs
 	}
+	token, err := r.JoinTokens.Issue(ctx, scope.Cluster, scope.ConfigOwner.GetName(), time.Duration(ttl)*time.Second)
+	return token, true, err
+}
 
-	if !found {
-		newcrt, newkey, err := r.generateCA()
-		if err != nil {
-			return nil, nil, err
-		}
-		caSecret := &corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: scope.Cluster.Namespace,
-				Name:      scope.Cluster.Name + "-ca",
-			},
-			Data: map[string][]byte{
-				"crt": []byte(*newcrt),
-				"key": []byte(*newkey),
-			},
-		}
-		err = r.Client.Create(ctx, caSecret)
-		if err != nil {
-			return nil, nil, err
-		}
+// revokeJoinToken revokes the per-machine join token of the config owner once the Machine is running.
+func (r *MicroK8sConfigReconciler) revokeJoinToken(ctx context.Context, scope *Scope) error {
+	if scope.ConfigOwner.IsMachinePool() {
+		return nil
+	}
+	if phase, _, _ := unstructured.NestedString(scope.ConfigOwner.Object, "status", "phase"); phase != string(clusterv1.MachinePhaseRunning) {
+		return nil
 	}
+	return r.JoinTokens.Revoke(ctx, scope.Cluster, scope.ConfigOwner.GetName())
+}
 
-	readCASecret := &corev1.Secret{}
-	err = r.Client.Get(ctx,
-		types.NamespacedName{
-			Namespace: scope.Cluster.Namespace,
-			Name:      scope.Cluster.Name + "-ca",
-		},
-		readCASecret,
-	)
+// getProgressReport returns how the machine of the config reports its bootstrap progress, and marks the
+// conditions of the reported steps as waiting for the machine if they are not set yet. MachinePools share their
+// bootstrap data between instances, so their progress is not reported.
+func (r *MicroK8sConfigReconciler) getProgressReport(ctx context.Context, scope *Scope, steps ...string) (cloudinit.ProgressReport, error) {
+	if r.ProgressURL == "" || scope.ConfigOwner.IsMachinePool() {
+		return cloudinit.ProgressReport{}, nil
+	}
+	token, err := progress.IssueToken(ctx, r.Client, scope.Config, scope.Cluster.Name)
 	if err != nil {
-		return nil, nil, err
+		return cloudinit.ProgressReport{}, err
 	}
+	for _, step := range steps {
+		if conditionType := progress.StepConditions[step]; !conditions.Has(scope.Config, conditionType) {
+			conditions.MarkFalse(scope.Config, conditionType, bootstrapclusterxk8siov1beta1.WaitingForProgressReportReason, clusterv1.ConditionSeverityInfo, "")
+		}
+	}
+	return cloudinit.ProgressReport{
+		URL:   progress.URL(r.ProgressURL, scope.Config),
+		Token: token,
+	}, nil
+}
 
-	certstr := string(readCASecret.Data["crt"])
-	keystr := string(readCASecret.Data["key"])
-	return &certstr, &keystr, nil
+// nativeAPIServerPort returns true if the config sets the apiserver port without iptables rules.
+func nativeAPIServerPort(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) bool {
+	return config.Spec.ClusterConfiguration != nil && config.Spec.ClusterConfiguration.NativeAPIServerPort
 }
 
-func (r *MicroK8sConfigReconciler) generateCA() (cert *string, key *string, err error) {
-	// set up our CA certificate
-	ca := &x509.Certificate{
-		SerialNumber: big.NewInt(2019),
-		Subject: pkix.Name{
-			Organization:  []string{"Canonical"},
-			Country:       []string{"GB"},
-			Province:      []string{""},
-			Locality:      []string{"Canonical"},
-			StreetAddress: []string{"Canonical"},
-			CommonName:    "10.152.183.1",
-		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(10, 0, 0),
-		IsCA:                  true,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		BasicConstraintsValid: true,
+// workerAPIServerProxy returns the mode of the apiserver proxy of the worker nodes.
+func workerAPIServerProxy(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) string {
+	if c := config.Spec.ClusterConfiguration; c != nil {
+		return c.WorkerAPIServerProxy
 	}
+	return ""
+}
 
-	// create our private and public key
-	caPrivKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, nil, err
+// podCIDR returns the pod CIDR of the config, or an empty string to use the default of MicroK8s.
+func podCIDR(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) string {
+	if c := config.Spec.ClusterConfiguration; c != nil {
+		return c.PodCIDR
 	}
+	return ""
+}
 
-	// create the CA
-	caBytes, err := x509.CreateCertificate(rand.Reader, ca, ca, &caPrivKey.PublicKey, caPrivKey)
-	if err != nil {
-		return nil, nil, err
+// serviceCIDR returns the service CIDR of the config, or an empty string to use the default of MicroK8s.
+func serviceCIDR(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) string {
+	if c := config.Spec.ClusterConfiguration; c != nil {
+		return c.ServiceCIDR
 	}
+	return ""
+}
 
-	// pem encode
-	caPEM := new(bytes.Buffer)
-	err = pem.Encode(caPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: caBytes,
-	})
-	if err != nil {
-		return nil, nil, err
+// clusterDomain returns the DNS domain of the config, or an empty string to use the default of MicroK8s.
+func clusterDomain(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) string {
+	if c := config.Spec.ClusterConfiguration; c != nil {
+		return c.ClusterDomain
+	}
+	return ""
+}
+
+// cni returns the CNI of the cluster, or an empty string for Calico.
+func cni(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) string {
+	if c := config.Spec.ClusterConfiguration; c != nil {
+		return c.CNI
 	}
+	return ""
+}
 
-	caPrivKeyPEM := new(bytes.Buffer)
-	err = pem.Encode(caPrivKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(caPrivKey),
-	})
-	if err != nil {
-		return nil, nil, err
+// certSANs returns the extra subject alternative names of the server certificate of the control plane nodes.
+func certSANs(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) []string {
+	if c := config.Spec.ClusterConfiguration; c != nil {
+		return c.CertSANs
 	}
+	return nil
+}
 
-	certstr := caPEM.String()
-	keystr := caPrivKeyPEM.String()
-	return &certstr, &keystr, nil
+// joinAddressTypes returns the types of the machine addresses to join the cluster through, in order of preference.
+func joinAddressTypes(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) []clusterv1.MachineAddressType {
+	if c := config.Spec.ClusterConfiguration; c != nil && len(c.JoinAddressTypes) > 0 {
+		return c.JoinAddressTypes
+	}
+	return defaultJoinAddressTypes
+}
+
+// perMachineJoinTokens returns true if the config enables per-machine join tokens. This only applies to the
+// config of the control plane node that initializes the cluster.
+func perMachineJoinTokens(config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) bool {
+	return config.Spec.ClusterConfiguration != nil && config.Spec.ClusterConfiguration.PerMachineJoinTokens
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -790,6 +1060,17 @@ func (r *MicroK8sConfigReconciler) SetupWithManager(ctx context.Context, mgr ctr
 	if r.MicroK8sInitLock == nil {
 		r.MicroK8sInitLock = locking.NewControlPlaneInitMutex(ctrl.LoggerFrom(ctx).WithName("init-locker"), mgr.GetClient())
 	}
+	if r.WorkloadClient == nil {
+		if r.Tracker == nil {
+			return errors.New("a ClusterCacheTracker is required to access the workload clusters")
+		}
+		r.WorkloadClient = func(ctx context.Context, cluster *clusterv1.Cluster) (client.Client, error) {
+			return r.Tracker.GetClient(ctx, util.ObjectKey(cluster))
+		}
+	}
+	if r.JoinTokens == nil {
+		r.JoinTokens = jointoken.NewManager(ctrl.LoggerFrom(ctx).WithName("join-tokens"), mgr.GetClient(), r.WorkloadClient)
+	}
 
 	b := ctrl.NewControllerManagedBy(mgr).
 		For(&bootstrapclusterxk8siov1beta1.MicroK8sConfig{}).
@@ -801,7 +1082,7 @@ func (r *MicroK8sConfigReconciler) SetupWithManager(ctx context.Context, mgr ctr
 	if feature.Gates.Enabled(feature.MachinePool) {
 		b = b.Watches(
 			&source.Kind{Type: &expv1.MachinePool{}},
-			handler.EnqueueRequestsFromMapFunc(r.MachineToBootstrapMapFunc),
+			handler.EnqueueRequestsFromMapFunc(r.MachinePoolToBootstrapMapFunc),
 		).WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(ctrl.LoggerFrom(ctx), r.WatchFilterValue))
 	}
 
@@ -884,6 +1165,21 @@ func (r *MicroK8sConfigReconciler) MachineToBootstrapMapFunc(o client.Object) []
 	return result
 }
 
+func (r *MicroK8sConfigReconciler) MachinePoolToBootstrapMapFunc(o client.Object) []ctrl.Request {
+	m, ok := o.(*expv1.MachinePool)
+	if !ok {
+		panic(fmt.Sprintf("Expected a MachinePool but got a %T", o))
+	}
+
+	result := []ctrl.Request{}
+	configRef := m.Spec.Template.Spec.Bootstrap.ConfigRef
+	if configRef != nil && configRef.GroupVersionKind().GroupKind() == v1beta1.GroupVersion.WithKind("MicroK8sConfig").GroupKind() {
+		name := client.ObjectKey{Namespace: m.Namespace, Name: configRef.Name}
+		result = append(result, ctrl.Request{NamespacedName: name})
+	}
+	return result
+}
+
 func (r *MicroK8sConfigReconciler) getControlPlaneMachinesForCluster(ctx context.Context,
 	cluster client.ObjectKey) ([]clusterv1.Machine, error) {
 	selector := map[string]string{
@@ -0,0 +1,432 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	bsutil "sigs.k8s.io/cluster-api/bootstrap/util"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+func TestOwnerKubernetesVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		owner     client.Object
+		expected  string
+		expectErr bool
+	}{
+		{
+			name: "Machine",
+			owner: &clusterv1.Machine{
+				TypeMeta: metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine"},
+				Spec:     clusterv1.MachineSpec{Version: pointer.String("v1.25.2")},
+			},
+			expected: "v1.25.2",
+		},
+		{
+			name: "MachinePool",
+			owner: &expv1.MachinePool{
+				TypeMeta: metav1.TypeMeta{APIVersion: expv1.GroupVersion.String(), Kind: "MachinePool"},
+				Spec: expv1.MachinePoolSpec{
+					Template: clusterv1.MachineTemplateSpec{
+						Spec: clusterv1.MachineSpec{Version: pointer.String("v1.24.3")},
+					},
+				},
+			},
+			expected: "v1.24.3",
+		},
+		{
+			name: "MachineWithoutVersion",
+			owner: &clusterv1.Machine{
+				TypeMeta: metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine"},
+			},
+			expectErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.owner)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			v, err := ownerKubernetesVersion(&bsutil.ConfigOwner{Unstructured: &unstructured.Unstructured{Object: obj}})
+			if tc.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(v).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestMachinePoolToBootstrapMapFunc(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &MicroK8sConfigReconciler{}
+	pool := &expv1.MachinePool{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pool"},
+		Spec: expv1.MachinePoolSpec{
+			Template: clusterv1.MachineTemplateSpec{
+				Spec: clusterv1.MachineSpec{
+					Bootstrap: clusterv1.Bootstrap{
+						ConfigRef: &corev1.ObjectReference{
+							APIVersion: v1beta1.GroupVersion.String(),
+							Kind:       "MicroK8sConfig",
+							Name:       "pool-config",
+						},
+					},
+				},
+			},
+		},
+	}
+	g.Expect(r.MachinePoolToBootstrapMapFunc(pool)).To(ConsistOf(ctrl.Request{
+		NamespacedName: client.ObjectKey{Namespace: "default", Name: "pool-config"},
+	}))
+
+	pool.Spec.Template.Spec.Bootstrap.ConfigRef.Kind = "KubeadmConfig"
+	g.Expect(r.MachinePoolToBootstrapMapFunc(pool)).To(BeEmpty())
+}
+
+type fakeJoinTokenManager struct {
+	enabled bool
+	issued  map[string]time.Duration
+	revoked []string
+}
+
+func (m *fakeJoinTokenManager) Enable(_ context.Context, _ *clusterv1.Cluster) error {
+	m.enabled = true
+	return nil
+}
+
+func (m *fakeJoinTokenManager) Enabled(_ context.Context, _ *clusterv1.Cluster) (bool, error) {
+	return m.enabled, nil
+}
+
+func (m *fakeJoinTokenManager) Issue(_ context.Context, _ *clusterv1.Cluster, machineName string, ttl time.Duration) (string, error) {
+	if m.issued == nil {
+		m.issued = map[string]time.Duration{}
+	}
+	m.issued[machineName] = ttl
+	return "token-" + machineName, nil
+}
+
+func (m *fakeJoinTokenManager) Revoke(_ context.Context, _ *clusterv1.Cluster, machineName string) error {
+	m.revoked = append(m.revoked, machineName)
+	return nil
+}
+
+func TestPerMachineJoinTokens(t *testing.T) {
+	newScope := func(g *WithT, owner client.Object) *Scope {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(owner)
+		g.Expect(err).NotTo(HaveOccurred())
+		return &Scope{
+			Logger: ctrl.Log,
+			Config: &v1beta1.MicroK8sConfig{
+				Spec: v1beta1.MicroK8sConfigSpec{
+					ClusterConfiguration: &v1beta1.ClusterConfiguration{},
+				},
+			},
+			ConfigOwner: &bsutil.ConfigOwner{Unstructured: &unstructured.Unstructured{Object: obj}},
+			Cluster:     &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}},
+		}
+	}
+
+	t.Run("Issue", func(t *testing.T) {
+		g := NewWithT(t)
+		m := &fakeJoinTokenManager{enabled: true}
+		r := &MicroK8sConfigReconciler{JoinTokens: m}
+
+		// the cluster decides, not the config of the joining machine
+		scope := newScope(g, &clusterv1.Machine{
+			TypeMeta:   metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+		})
+		token, joinTokenSync, err := r.getJoinTokenForOwner(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(token).To(Equal("token-machine"))
+		g.Expect(joinTokenSync).To(BeTrue())
+		g.Expect(m.issued).To(HaveKeyWithValue("machine", time.Hour))
+
+		scope.Config.Spec.ClusterConfiguration.PerMachineJoinTokenTTLInSecs = 600
+		_, _, err = r.getJoinTokenForOwner(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(m.issued).To(HaveKeyWithValue("machine", 10*time.Minute))
+	})
+
+	t.Run("MachinePool", func(t *testing.T) {
+		g := NewWithT(t)
+		m := &fakeJoinTokenManager{enabled: true}
+		r := &MicroK8sConfigReconciler{JoinTokens: m}
+
+		scope := newScope(g, &expv1.MachinePool{
+			TypeMeta:   metav1.TypeMeta{APIVersion: expv1.GroupVersion.String(), Kind: "MachinePool"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pool"},
+		})
+		_, _, err := r.getJoinTokenForOwner(context.Background(), scope)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(m.issued).To(BeEmpty())
+	})
+
+	t.Run("SharedJoinToken", func(t *testing.T) {
+		g := NewWithT(t)
+		scheme := runtime.NewScheme()
+		_ = corev1.AddToScheme(scheme)
+		m := &fakeJoinTokenManager{}
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), JoinTokens: m}
+
+		// the joining machine cannot opt in if the cluster was initialized without per-machine join tokens
+		scope := newScope(g, &clusterv1.Machine{
+			TypeMeta:   metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+		})
+		scope.Config.Spec.ClusterConfiguration.PerMachineJoinTokens = true
+		token, joinTokenSync, err := r.getJoinTokenForOwner(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(token).To(HaveLen(32))
+		g.Expect(joinTokenSync).To(BeFalse())
+		g.Expect(m.issued).To(BeEmpty())
+	})
+
+	t.Run("MachinePoolCondition", func(t *testing.T) {
+		g := NewWithT(t)
+		m := &fakeJoinTokenManager{enabled: true}
+		r := &MicroK8sConfigReconciler{JoinTokens: m}
+
+		scope := newScope(g, &expv1.MachinePool{
+			TypeMeta:   metav1.TypeMeta{APIVersion: expv1.GroupVersion.String(), Kind: "MachinePool"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pool"},
+			Spec: expv1.MachinePoolSpec{Template: clusterv1.MachineTemplateSpec{
+				Spec: clusterv1.MachineSpec{Version: pointer.String("v1.25.2")},
+			}},
+		})
+		result, err := r.handleJoiningWorkerNode(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.Requeue || result.RequeueAfter > 0).To(BeFalse())
+		g.Expect(conditions.GetReason(scope.Config, v1beta1.DataSecretAvailableCondition)).To(Equal(v1beta1.PerMachineJoinTokensUnsupportedReason))
+	})
+
+	t.Run("RevokeWhenRunning", func(t *testing.T) {
+		g := NewWithT(t)
+		m := &fakeJoinTokenManager{}
+		r := &MicroK8sConfigReconciler{JoinTokens: m}
+
+		machine := &clusterv1.Machine{
+			TypeMeta:   metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+			Status:     clusterv1.MachineStatus{Phase: string(clusterv1.MachinePhaseProvisioned)},
+		}
+		g.Expect(r.revokeJoinToken(context.Background(), newScope(g, machine))).To(Succeed())
+		g.Expect(m.revoked).To(BeEmpty())
+
+		machine.Status.Phase = string(clusterv1.MachinePhaseRunning)
+		g.Expect(r.revokeJoinToken(context.Background(), newScope(g, machine))).To(Succeed())
+		g.Expect(m.revoked).To(ConsistOf("machine"))
+	})
+}
+
+func TestProgressReport(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+
+	newScope := func(g *WithT, owner client.Object) *Scope {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(owner)
+		g.Expect(err).NotTo(HaveOccurred())
+		return &Scope{
+			Logger:      ctrl.Log,
+			Config:      &v1beta1.MicroK8sConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config", UID: "uid"}},
+			ConfigOwner: &bsutil.ConfigOwner{Unstructured: &unstructured.Unstructured{Object: obj}},
+			Cluster:     &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}},
+		}
+	}
+	machine := &clusterv1.Machine{
+		TypeMeta:   metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		g := NewWithT(t)
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build()}
+
+		scope := newScope(g, machine)
+		report, err := r.getProgressReport(context.Background(), scope, "install", "join")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(report.URL).To(BeEmpty())
+		g.Expect(scope.Config.GetConditions()).To(BeEmpty())
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		g := NewWithT(t)
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), ProgressURL: "http://10.0.0.10:8082"}
+
+		scope := newScope(g, machine)
+		conditions.MarkTrue(scope.Config, v1beta1.InstallSucceededCondition)
+		report, err := r.getProgressReport(context.Background(), scope, "install", "join")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(report.URL).To(Equal("http://10.0.0.10:8082/v1/progress/default/config"))
+		g.Expect(report.Token).To(HaveLen(32))
+
+		// conditions that were already reported are kept
+		g.Expect(conditions.IsTrue(scope.Config, v1beta1.InstallSucceededCondition)).To(BeTrue())
+		g.Expect(conditions.GetReason(scope.Config, v1beta1.JoinSucceededCondition)).To(Equal(v1beta1.WaitingForProgressReportReason))
+		g.Expect(conditions.Has(scope.Config, v1beta1.AddonsEnabledCondition)).To(BeFalse())
+
+		// the token is reused when the bootstrap data is regenerated
+		again, err := r.getProgressReport(context.Background(), scope, "install", "join")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(again).To(Equal(report))
+	})
+
+	t.Run("MachinePool", func(t *testing.T) {
+		g := NewWithT(t)
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), ProgressURL: "http://10.0.0.10:8082"}
+
+		scope := newScope(g, &expv1.MachinePool{
+			TypeMeta:   metav1.TypeMeta{APIVersion: expv1.GroupVersion.String(), Kind: "MachinePool"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pool"},
+		})
+		report, err := r.getProgressReport(context.Background(), scope, "install", "join")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(report.URL).To(BeEmpty())
+		g.Expect(scope.Config.GetConditions()).To(BeEmpty())
+	})
+}
+
+func TestJoinConfiguration(t *testing.T) {
+	initConfig := &v1beta1.InitConfiguration{
+		ExtraKubeletArgs: []string{"--max-pods=250"},
+		NodeLabels:       map[string]string{"pool": "default"},
+		PreRunCommands:   []string{"echo init"},
+		PostRunCommands:  []string{"echo done"},
+	}
+
+	t.Run("Nil", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(joinConfiguration(&v1beta1.MicroK8sConfig{})).To(Equal(&v1beta1.JoinConfiguration{}))
+	})
+
+	t.Run("FallbackToInitConfiguration", func(t *testing.T) {
+		g := NewWithT(t)
+
+		config := &v1beta1.MicroK8sConfig{Spec: v1beta1.MicroK8sConfigSpec{InitConfiguration: initConfig}}
+		g.Expect(joinConfiguration(config)).To(Equal(&v1beta1.JoinConfiguration{
+			ExtraKubeletArgs: []string{"--max-pods=250"},
+			NodeLabels:       map[string]string{"pool": "default"},
+			PreRunCommands:   []string{"echo init"},
+			PostRunCommands:  []string{"echo done"},
+		}))
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		g := NewWithT(t)
+
+		config := &v1beta1.MicroK8sConfig{Spec: v1beta1.MicroK8sConfigSpec{
+			InitConfiguration: initConfig,
+			JoinConfiguration: &v1beta1.JoinConfiguration{
+				NodeLabels:     map[string]string{"pool": "gpu"},
+				NodeTaints:     []corev1.Taint{{Key: "gpu", Effect: corev1.TaintEffectNoSchedule}},
+				PreRunCommands: []string{},
+			},
+		}}
+		g.Expect(joinConfiguration(config)).To(Equal(&v1beta1.JoinConfiguration{
+			ExtraKubeletArgs: []string{"--max-pods=250"},
+			NodeLabels:       map[string]string{"pool": "gpu"},
+			NodeTaints:       []corev1.Taint{{Key: "gpu", Effect: corev1.TaintEffectNoSchedule}},
+			PreRunCommands:   []string{},
+			PostRunCommands:  []string{"echo done"},
+		}))
+		// the config is not modified
+		g.Expect(config.Spec.JoinConfiguration.ExtraKubeletArgs).To(BeNil())
+	})
+}
+
+func TestGetControlPlaneNodesToJoin(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clusterv1.AddToScheme(scheme)
+
+	newMachine := func(name string, phase clusterv1.MachinePhase, addresses ...clusterv1.MachineAddress) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				Labels:    map[string]string{clusterv1.ClusterLabelName: "cluster", clusterv1.MachineControlPlaneLabelName: ""},
+			},
+			Spec:   clusterv1.MachineSpec{ClusterName: "cluster", ProviderID: pointer.String("provider://" + name)},
+			Status: clusterv1.MachineStatus{Phase: string(phase), Addresses: addresses},
+		}
+	}
+	r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newMachine("cp-1", clusterv1.MachinePhaseRunning,
+			clusterv1.MachineAddress{Type: clusterv1.MachineInternalIP, Address: "fd00::10"},
+			clusterv1.MachineAddress{Type: clusterv1.MachineInternalDNS, Address: "cp-1.internal"},
+		),
+		newMachine("cp-2", clusterv1.MachinePhaseProvisioning,
+			clusterv1.MachineAddress{Type: clusterv1.MachineInternalIP, Address: "fd00::11"},
+		),
+	).Build()}
+
+	for _, tc := range []struct {
+		name             string
+		joinAddressTypes []clusterv1.MachineAddressType
+		expected         []string
+		expectErr        bool
+	}{
+		{name: "Default", expected: []string{"fd00::10"}},
+		{name: "InternalDNS", joinAddressTypes: []clusterv1.MachineAddressType{clusterv1.MachineInternalDNS, clusterv1.MachineInternalIP}, expected: []string{"cp-1.internal"}},
+		{name: "Fallback", joinAddressTypes: []clusterv1.MachineAddressType{clusterv1.MachineExternalDNS, clusterv1.MachineInternalIP}, expected: []string{"fd00::10"}},
+		{name: "NoAddresses", joinAddressTypes: []clusterv1.MachineAddressType{clusterv1.MachineExternalDNS}, expectErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := &Scope{
+				Logger: ctrl.Log,
+				Config: &v1beta1.MicroK8sConfig{
+					Spec: v1beta1.MicroK8sConfigSpec{
+						ClusterConfiguration: &v1beta1.ClusterConfiguration{JoinAddressTypes: tc.joinAddressTypes},
+					},
+				},
+				Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}},
+			}
+			addresses, err := r.getControlPlaneNodesToJoin(context.Background(), scope)
+			if tc.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(addresses).To(Equal(tc.expected))
+		})
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package progress implements receiving the bootstrap progress that machines report to the manager.
+package progress
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+// Steps of the bootstrap process that machines report.
+const (
+	// StepInstall installs MicroK8s on the machine.
+	StepInstall = "install"
+	// StepJoin joins the machine to the cluster.
+	StepJoin = "join"
+	// StepAddons enables the addons on the control plane node that initializes the cluster.
+	StepAddons = "addons"
+)
+
+// Statuses of a reported step.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+const (
+	// Path is the path of the endpoint that machines report their progress to. It is followed by the namespace
+	// and the name of the MicroK8sConfig of the machine.
+	Path = "/v1/progress/"
+
+	maxRequestBytes   = 4096
+	maxMessageLength  = 1024
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 10 * time.Second
+)
+
+// StepConditions are the conditions of the MicroK8sConfig that the steps are reported on.
+var StepConditions = map[string]clusterv1.ConditionType{
+	StepInstall: bootstrapclusterxk8siov1beta1.InstallSucceededCondition,
+	StepJoin:    bootstrapclusterxk8siov1beta1.JoinSucceededCondition,
+	StepAddons:  bootstrapclusterxk8siov1beta1.AddonsEnabledCondition,
+}
+
+// Server receives the progress reports of machines and surfaces them as conditions of their MicroK8sConfig.
+// Machines authenticate with the per-machine token of their config, see IssueToken.
+type Server struct {
+	log    logr.Logger
+	client client.Client
+	addr   string
+}
+
+// NewServer returns a server that listens for progress reports on the given address.
+func NewServer(log logr.Logger, client client.Client, addr string) *Server {
+	return &Server{
+		log:    log,
+		client: client,
+		addr:   addr,
+	}
+}
+
+// NeedLeaderElection returns false, so that all replicas of the manager receive progress reports.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves progress reports until the context is done.
+func (s *Server) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, s)
+	srv := &http.Server{
+		Addr:              s.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.log.Info("Serving progress reports", "address", s.addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return errors.Wrap(err, "failed to serve progress reports")
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// ServeHTTP handles a progress report of a machine. The report is a form with the step, its status and an
+// optional message.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	namespace, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, Path), "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	log := s.log.WithValues("namespace", namespace, "MicroK8sConfig", name)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid report", http.StatusBadRequest)
+		return
+	}
+	step, status, message := r.PostForm.Get("step"), r.PostForm.Get("status"), r.PostForm.Get("message")
+	conditionType, ok := StepConditions[step]
+	if !ok || (status != StatusSucceeded && status != StatusFailed) {
+		http.Error(w, "invalid report", http.StatusBadRequest)
+		return
+	}
+	if len(message) > maxMessageLength {
+		message = message[:maxMessageLength]
+	}
+
+	var token string
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	authorized, err := s.authorize(r.Context(), client.ObjectKey{Namespace: namespace, Name: name}, token)
+	if err != nil {
+		log.Error(err, "Failed to authorize progress report")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !authorized {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.report(r.Context(), client.ObjectKey{Namespace: namespace, Name: name}, conditionType, status, message); err != nil {
+		log.Error(err, "Failed to record progress report", "step", step, "status", status)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Info("Received progress report", "step", step, "status", status, "message", message)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize returns true if the token is the progress token of the config.
+func (s *Server) authorize(ctx context.Context, key client.ObjectKey, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	secret := &corev1.Secret{}
+	err := s.client.Get(ctx, client.ObjectKey{Namespace: key.Namespace, Name: tokenSecretName(key.Name)}, secret)
+	switch {
+	case apierrors.IsNotFound(err):
+		return false, nil
+	case err != nil:
+		return false, errors.Wrap(err, "failed to get progress token")
+	}
+	expected := secret.Data[tokenKey]
+	return len(expected) > 0 && subtle.ConstantTimeCompare(expected, []byte(token)) == 1, nil
+}
+
+// report sets the condition of the step on the config.
+func (s *Server) report(ctx context.Context, key client.ObjectKey, conditionType clusterv1.ConditionType, status string, message string) error {
+	config := &bootstrapclusterxk8siov1beta1.MicroK8sConfig{}
+	if err := s.client.Get(ctx, key, config); err != nil {
+		return errors.Wrap(err, "failed to get MicroK8sConfig")
+	}
+	patchHelper, err := patch.NewHelper(config, s.client)
+	if err != nil {
+		return err
+	}
+	if status == StatusSucceeded {
+		conditions.MarkTrue(config, conditionType)
+	} else {
+		conditions.MarkFalse(config, conditionType, bootstrapclusterxk8siov1beta1.BootstrapStepFailedReason, clusterv1.ConditionSeverityWarning, "%s", message)
+	}
+	if err := patchHelper.Patch(ctx, config, patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{conditionType}}); err != nil {
+		return errors.Wrap(err, "failed to patch MicroK8sConfig")
+	}
+	return nil
+}
+
+// URL returns the URL that the machine of the config reports its progress to, given the URL that the manager
+// is reachable at from the machines.
+func URL(baseURL string, config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) string {
+	return fmt.Sprintf("%s%s%s/%s", strings.TrimSuffix(baseURL, "/"), Path, config.Namespace, config.Name)
+}
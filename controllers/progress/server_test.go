@@ -0,0 +1,217 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package progress
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+// node reports progress like the 00-report-progress.sh script of a machine.
+type node struct {
+	url   string
+	token string
+}
+
+func (n *node) report(method string, step string, status string, message string) (int, error) {
+	form := url.Values{"step": {step}, "status": {status}, "message": {message}}
+	req, err := http.NewRequest(method, n.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestServer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = bootstrapclusterxk8siov1beta1.AddToScheme(scheme)
+
+	setup := func(t *testing.T) (client.Client, *bootstrapclusterxk8siov1beta1.MicroK8sConfig, *node) {
+		g := NewWithT(t)
+
+		config := &bootstrapclusterxk8siov1beta1.MicroK8sConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config", UID: "uid"}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build()
+
+		token, err := IssueToken(context.Background(), c, config, "cluster")
+		g.Expect(err).NotTo(HaveOccurred())
+
+		srv := httptest.NewServer(NewServer(logr.Discard(), c, ""))
+		t.Cleanup(srv.Close)
+
+		return c, config, &node{url: URL(srv.URL, config), token: token}
+	}
+
+	getConfig := func(g Gomega, c client.Client, config *bootstrapclusterxk8siov1beta1.MicroK8sConfig) *bootstrapclusterxk8siov1beta1.MicroK8sConfig {
+		result := &bootstrapclusterxk8siov1beta1.MicroK8sConfig{}
+		g.Expect(c.Get(context.Background(), client.ObjectKeyFromObject(config), result)).To(Succeed())
+		return result
+	}
+
+	t.Run("Succeeded", func(t *testing.T) {
+		g := NewWithT(t)
+		c, config, n := setup(t)
+
+		for _, step := range []string{StepInstall, StepJoin, StepAddons} {
+			code, err := n.report(http.MethodPost, step, StatusSucceeded, "")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(code).To(Equal(http.StatusNoContent))
+		}
+
+		config = getConfig(g, c, config)
+		g.Expect(conditions.IsTrue(config, bootstrapclusterxk8siov1beta1.InstallSucceededCondition)).To(BeTrue())
+		g.Expect(conditions.IsTrue(config, bootstrapclusterxk8siov1beta1.JoinSucceededCondition)).To(BeTrue())
+		g.Expect(conditions.IsTrue(config, bootstrapclusterxk8siov1beta1.AddonsEnabledCondition)).To(BeTrue())
+	})
+
+	t.Run("FailedThenSucceeded", func(t *testing.T) {
+		g := NewWithT(t)
+		c, config, n := setup(t)
+
+		code, err := n.report(http.MethodPost, StepJoin, StatusFailed, "Failed to join MicroK8s cluster, will retry")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(code).To(Equal(http.StatusNoContent))
+
+		condition := conditions.Get(getConfig(g, c, config), bootstrapclusterxk8siov1beta1.JoinSucceededCondition)
+		g.Expect(condition).NotTo(BeNil())
+		g.Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		g.Expect(condition.Reason).To(Equal(bootstrapclusterxk8siov1beta1.BootstrapStepFailedReason))
+		g.Expect(condition.Severity).To(Equal(clusterv1.ConditionSeverityWarning))
+		g.Expect(condition.Message).To(Equal("Failed to join MicroK8s cluster, will retry"))
+
+		code, err = n.report(http.MethodPost, StepJoin, StatusSucceeded, "")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(code).To(Equal(http.StatusNoContent))
+
+		g.Expect(conditions.IsTrue(getConfig(g, c, config), bootstrapclusterxk8siov1beta1.JoinSucceededCondition)).To(BeTrue())
+	})
+
+	t.Run("LongMessage", func(t *testing.T) {
+		g := NewWithT(t)
+		c, config, n := setup(t)
+
+		code, err := n.report(http.MethodPost, StepInstall, StatusFailed, strings.Repeat("a", 2000))
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(code).To(Equal(http.StatusNoContent))
+
+		g.Expect(conditions.GetMessage(getConfig(g, c, config), bootstrapclusterxk8siov1beta1.InstallSucceededCondition)).To(HaveLen(maxMessageLength))
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		c, config, n := setup(t)
+
+		for _, tc := range []struct {
+			name string
+			node *node
+		}{
+			{name: "NoToken", node: &node{url: n.url}},
+			{name: "WrongToken", node: &node{url: n.url, token: "wrongtoken"}},
+			{name: "OtherConfig", node: &node{url: strings.TrimSuffix(n.url, "config") + "other", token: n.token}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				code, err := tc.node.report(http.MethodPost, StepInstall, StatusSucceeded, "")
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(code).To(Equal(http.StatusUnauthorized))
+
+				g.Expect(conditions.Has(getConfig(g, c, config), bootstrapclusterxk8siov1beta1.InstallSucceededCondition)).To(BeFalse())
+			})
+		}
+	})
+
+	t.Run("InvalidReport", func(t *testing.T) {
+		_, _, n := setup(t)
+
+		for _, tc := range []struct {
+			name         string
+			method       string
+			step         string
+			status       string
+			expectedCode int
+		}{
+			{name: "InvalidStep", method: http.MethodPost, step: "reboot", status: StatusSucceeded, expectedCode: http.StatusBadRequest},
+			{name: "InvalidStatus", method: http.MethodPost, step: StepInstall, status: "running", expectedCode: http.StatusBadRequest},
+			{name: "InvalidMethod", method: http.MethodGet, step: StepInstall, status: StatusSucceeded, expectedCode: http.StatusMethodNotAllowed},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				code, err := n.report(tc.method, tc.step, tc.status, "")
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(code).To(Equal(tc.expectedCode))
+			})
+		}
+	})
+}
+
+func TestIssueToken(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = bootstrapclusterxk8siov1beta1.AddToScheme(scheme)
+
+	config := &bootstrapclusterxk8siov1beta1.MicroK8sConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config", UID: "uid"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	token, err := IssueToken(context.Background(), c, config, "cluster")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(token).NotTo(BeEmpty())
+
+	secret := &corev1.Secret{}
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "config-progress-token"}, secret)).To(Succeed())
+	g.Expect(secret.Labels).To(HaveKeyWithValue(clusterv1.ClusterLabelName, "cluster"))
+	g.Expect(secret.OwnerReferences).To(ConsistOf(HaveField("UID", config.UID)))
+
+	again, err := IssueToken(context.Background(), c, config, "cluster")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(again).To(Equal(token))
+}
+
+func TestURL(t *testing.T) {
+	g := NewWithT(t)
+
+	config := &bootstrapclusterxk8siov1beta1.MicroK8sConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"}}
+	g.Expect(URL("http://10.0.0.10:8082", config)).To(Equal("http://10.0.0.10:8082/v1/progress/default/config"))
+	g.Expect(URL("http://10.0.0.10:8082/", config)).To(Equal("http://10.0.0.10:8082/v1/progress/default/config"))
+}
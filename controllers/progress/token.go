@@ -0,0 +1,76 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package progress
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/jointoken"
+)
+
+// tokenKey is the key of the secret that holds the progress token of a config.
+const tokenKey = "value"
+
+// IssueToken returns the token that the machine of the config authenticates its progress reports with. The
+// token is stored in a secret owned by the config, and reused when the bootstrap data is regenerated.
+func IssueToken(ctx context.Context, c client.Client, config *bootstrapclusterxk8siov1beta1.MicroK8sConfig, clusterName string) (string, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: config.Namespace, Name: tokenSecretName(config.Name)}, secret)
+	switch {
+	case err == nil && len(secret.Data[tokenKey]) > 0:
+		return string(secret.Data[tokenKey]), nil
+	case err != nil && !apierrors.IsNotFound(err):
+		return "", errors.Wrap(err, "failed to get progress token")
+	}
+
+	token, err := jointoken.Generate()
+	if err != nil {
+		return "", err
+	}
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: config.Namespace,
+			Name:      tokenSecretName(config.Name),
+			Labels: map[string]string{
+				clusterv1.ClusterLabelName: clusterName,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(config, bootstrapclusterxk8siov1beta1.GroupVersion.WithKind("MicroK8sConfig")),
+			},
+		},
+		Data: map[string][]byte{
+			tokenKey: []byte(token),
+		},
+	}
+	if err := c.Create(ctx, secret); err != nil {
+		return "", errors.Wrap(err, "failed to store progress token")
+	}
+	return token, nil
+}
+
+func tokenSecretName(configName string) string {
+	return fmt.Sprintf("%s-progress-token", configName)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/cloudinit"
+)
+
+// errRegistryCredentials is returned when the credentials of a registry cannot be read.
+var errRegistryCredentials = errors.New("registry credentials unavailable")
+
+// getRegistries returns the container registries of the config, with the credentials resolved from the
+// secrets referenced by credentialsSecretRef.
+func (r *MicroK8sConfigReconciler) getRegistries(ctx context.Context, scope *Scope) ([]cloudinit.Registry, error) {
+	registries := initConfiguration(scope.Config).Registries
+	if len(registries) == 0 {
+		return nil, nil
+	}
+
+	result := make([]cloudinit.Registry, 0, len(registries))
+	for _, registry := range registries {
+		item := cloudinit.Registry{
+			Host:       registry.Host,
+			Mirrors:    registry.Mirrors,
+			CABundle:   registry.CABundle,
+			SkipVerify: registry.InsecureSkipVerify,
+		}
+		if ref := registry.CredentialsSecretRef; ref != nil {
+			secret := &corev1.Secret{}
+			if err := r.Client.Get(ctx, types.NamespacedName{Namespace: scope.Config.Namespace, Name: ref.Name}, secret); err != nil {
+				if apierrors.IsNotFound(err) {
+					return nil, errors.Wrapf(errRegistryCredentials, "secret %s/%s of registry %q not found", scope.Config.Namespace, ref.Name, registry.Host)
+				}
+				return nil, err
+			}
+			item.Username = string(secret.Data[corev1.BasicAuthUsernameKey])
+			item.Password = string(secret.Data[corev1.BasicAuthPasswordKey])
+			if item.Username == "" || item.Password == "" {
+				return nil, errors.Wrapf(errRegistryCredentials, "secret %s/%s of registry %q must have a %q and a %q", secret.Namespace, secret.Name, registry.Host, corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey)
+			}
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/cloudinit"
+)
+
+func TestGetRegistries(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	newScope := func(registries ...v1beta1.Registry) *Scope {
+		return &Scope{
+			Config: &v1beta1.MicroK8sConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"},
+				Spec: v1beta1.MicroK8sConfigSpec{InitConfiguration: &v1beta1.InitConfiguration{
+					Registries: registries,
+				}},
+			},
+		}
+	}
+	harbor := v1beta1.Registry{
+		Host:                 "docker.io",
+		Mirrors:              []string{"https://harbor.example.com/v2/dockerhub"},
+		CABundle:             "CA",
+		CredentialsSecretRef: &corev1.LocalObjectReference{Name: "harbor"},
+	}
+
+	t.Run("None", func(t *testing.T) {
+		g := NewWithT(t)
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build()}
+
+		registries, err := r.getRegistries(context.Background(), newScope())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(registries).To(BeEmpty())
+	})
+
+	t.Run("Credentials", func(t *testing.T) {
+		g := NewWithT(t)
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "harbor"},
+				Data:       map[string][]byte{"username": []byte("robot"), "password": []byte("secret")},
+			},
+		).Build()}
+
+		registries, err := r.getRegistries(context.Background(), newScope(harbor, v1beta1.Registry{Host: "quay.io", InsecureSkipVerify: true}))
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(registries).To(Equal([]cloudinit.Registry{
+			{
+				Host:     "docker.io",
+				Mirrors:  []string{"https://harbor.example.com/v2/dockerhub"},
+				CABundle: "CA",
+				Username: "robot",
+				Password: "secret",
+			},
+			{Host: "quay.io", SkipVerify: true},
+		}))
+	})
+
+	t.Run("SecretNotFound", func(t *testing.T) {
+		g := NewWithT(t)
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build()}
+
+		_, err := r.getRegistries(context.Background(), newScope(harbor))
+		g.Expect(errors.Is(err, errRegistryCredentials)).To(BeTrue())
+	})
+
+	t.Run("SecretIncomplete", func(t *testing.T) {
+		g := NewWithT(t)
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "harbor"},
+				Data:       map[string][]byte{"username": []byte("robot")},
+			},
+		).Build()}
+
+		_, err := r.getRegistries(context.Background(), newScope(harbor))
+		g.Expect(errors.Is(err, errRegistryCredentials)).To(BeTrue())
+	})
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// snapRevisionConfigMapNamespace and snapRevisionConfigMapName are the workload cluster configmap that the
+	// machine that initialized the cluster publishes its snap revision in, see 20-publish-snap-revision.sh.
+	snapRevisionConfigMapNamespace = "kube-system"
+	snapRevisionConfigMapName      = "capi-microk8s-snap-revision"
+	snapRevisionKey                = "revision"
+
+	// snapRevisionTimeout is how long joining machines wait for the snap revision to be published after the
+	// control plane is initialized. Clusters that were initialized by an earlier version of the bootstrap
+	// provider never publish it, their joining machines install the latest revision of the channel instead.
+	snapRevisionTimeout = 10 * time.Minute
+)
+
+// errSnapRevisionNotPublished is returned when the snap revision of the cluster is not published yet.
+var errSnapRevisionNotPublished = errors.New("snap revision not published")
+
+// getSnapRevision returns the revision of the MicroK8s snap that a joining machine installs, and records it in
+// the status of the config, so that it is reused when the bootstrap data is regenerated. This is the revision of
+// the spec if set, or else the revision that was installed on the machine that initialized the cluster. The
+// latest revision of the channel is installed if zero.
+func (r *MicroK8sConfigReconciler) getSnapRevision(ctx context.Context, scope *Scope) (int64, error) {
+	initConfig := initConfiguration(scope.Config)
+	switch {
+	case initConfig.SnapRevision != 0:
+		scope.Config.Status.SnapRevision = initConfig.SnapRevision
+		return initConfig.SnapRevision, nil
+	case initConfig.Installation != nil && initConfig.Installation.Snap != "":
+		return 0, nil
+	case scope.Config.Status.SnapRevision != 0:
+		return scope.Config.Status.SnapRevision, nil
+	}
+
+	workloadClient, err := r.WorkloadClient(ctx, scope.Cluster)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get workload cluster client")
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := workloadClient.Get(ctx, client.ObjectKey{Namespace: snapRevisionConfigMapNamespace, Name: snapRevisionConfigMapName}, configMap); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return 0, errors.Wrap(err, "failed to get the snap revision of the cluster")
+		}
+		if initialized := conditions.GetLastTransitionTime(scope.Cluster, clusterv1.ControlPlaneInitializedCondition); initialized != nil && time.Since(initialized.Time) > snapRevisionTimeout {
+			scope.Info("The snap revision of the cluster was not published, installing the latest revision of the channel")
+			return 0, nil
+		}
+		return 0, errSnapRevisionNotPublished
+	}
+
+	revision, err := strconv.ParseInt(configMap.Data[snapRevisionKey], 10, 64)
+	if err != nil || revision <= 0 {
+		scope.Info("Ignoring invalid snap revision of the cluster, installing the latest revision of the channel", "revision", configMap.Data[snapRevisionKey])
+		return 0, nil
+	}
+	scope.Config.Status.SnapRevision = revision
+	return revision, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+)
+
+func TestGetSnapRevision(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	newReconciler := func(objs ...client.Object) *MicroK8sConfigReconciler {
+		workloadClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+		return &MicroK8sConfigReconciler{
+			WorkloadClient: func(context.Context, *clusterv1.Cluster) (client.Client, error) {
+				return workloadClient, nil
+			},
+		}
+	}
+	newScope := func(initConfig *v1beta1.InitConfiguration, initializedAt time.Time) *Scope {
+		return &Scope{
+			Logger: ctrl.Log,
+			Config: &v1beta1.MicroK8sConfig{Spec: v1beta1.MicroK8sConfigSpec{InitConfiguration: initConfig}},
+			Cluster: &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+				Status: clusterv1.ClusterStatus{Conditions: clusterv1.Conditions{{
+					Type:               clusterv1.ControlPlaneInitializedCondition,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(initializedAt),
+				}}},
+			},
+		}
+	}
+	published := func(revision string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "capi-microk8s-snap-revision"},
+			Data:       map[string]string{"revision": revision},
+		}
+	}
+
+	t.Run("Published", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newReconciler(published("4390"))
+
+		scope := newScope(nil, time.Now())
+		revision, err := r.getSnapRevision(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(revision).To(Equal(int64(4390)))
+		g.Expect(scope.Config.Status.SnapRevision).To(Equal(int64(4390)))
+	})
+
+	t.Run("Spec", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newReconciler(published("4390"))
+
+		scope := newScope(&v1beta1.InitConfiguration{SnapRevision: 4200}, time.Now())
+		revision, err := r.getSnapRevision(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(revision).To(Equal(int64(4200)))
+		g.Expect(scope.Config.Status.SnapRevision).To(Equal(int64(4200)))
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newReconciler(published("4390"))
+
+		// the revision is kept when the bootstrap data is regenerated
+		scope := newScope(nil, time.Now())
+		scope.Config.Status.SnapRevision = 4300
+		revision, err := r.getSnapRevision(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(revision).To(Equal(int64(4300)))
+	})
+
+	t.Run("SnapFile", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newReconciler(published("x1"))
+
+		scope := newScope(&v1beta1.InitConfiguration{Installation: &v1beta1.Installation{Snap: "/opt/microk8s.snap"}}, time.Now())
+		revision, err := r.getSnapRevision(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(revision).To(BeZero())
+		g.Expect(scope.Config.Status.SnapRevision).To(BeZero())
+	})
+
+	t.Run("NotPublished", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newReconciler()
+
+		_, err := r.getSnapRevision(context.Background(), newScope(nil, time.Now()))
+		g.Expect(err).To(MatchError(errSnapRevisionNotPublished))
+
+		// clusters initialized by an earlier version of the bootstrap provider never publish the revision
+		scope := newScope(nil, time.Now().Add(-time.Hour))
+		revision, err := r.getSnapRevision(context.Background(), scope)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(revision).To(BeZero())
+		g.Expect(scope.Config.Status.SnapRevision).To(BeZero())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newReconciler(published("x1"))
+
+		revision, err := r.getSnapRevision(context.Background(), newScope(nil, time.Now()))
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(revision).To(BeZero())
+	})
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	bootstrapclusterxk8siov1beta1 "github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/cloudinit"
+)
+
+// errFileContentUnavailable is returned when the content of a file cannot be read from its source.
+var errFileContentUnavailable = errors.New("file content unavailable")
+
+// getWriteFiles returns the extra files, with the content of the files that use contentFrom read from the
+// referenced secret or configmap in the namespace of the config.
+func (r *MicroK8sConfigReconciler) getWriteFiles(ctx context.Context, scope *Scope, files []bootstrapclusterxk8siov1beta1.CloudInitWriteFile) ([]cloudinit.File, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	resolved := make([]bootstrapclusterxk8siov1beta1.CloudInitWriteFile, 0, len(files))
+	for _, f := range files {
+		if f.ContentFrom != nil {
+			content, err := r.getFileContent(ctx, scope.Config.Namespace, f.ContentFrom)
+			if err != nil {
+				return nil, errors.Wrapf(err, "file %q", f.Path)
+			}
+			f.Content = content
+			f.ContentFrom = nil
+		}
+		resolved = append(resolved, f)
+	}
+	return cloudinit.WriteFilesFromAPI(resolved), nil
+}
+
+// getFileContent reads the content of a file from a secret or a configmap.
+func (r *MicroK8sConfigReconciler) getFileContent(ctx context.Context, namespace string, source *bootstrapclusterxk8siov1beta1.FileSource) (string, error) {
+	switch {
+	case source.Secret != nil:
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: source.Secret.Name}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", errors.Wrapf(errFileContentUnavailable, "secret %s/%s not found", namespace, source.Secret.Name)
+			}
+			return "", err
+		}
+		content, ok := secret.Data[source.Secret.Key]
+		if !ok {
+			return "", errors.Wrapf(errFileContentUnavailable, "secret %s/%s has no key %q", namespace, source.Secret.Name, source.Secret.Key)
+		}
+		return string(content), nil
+	case source.ConfigMap != nil:
+		configMap := &corev1.ConfigMap{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: source.ConfigMap.Name}, configMap); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", errors.Wrapf(errFileContentUnavailable, "configmap %s/%s not found", namespace, source.ConfigMap.Name)
+			}
+			return "", err
+		}
+		if content, ok := configMap.Data[source.ConfigMap.Key]; ok {
+			return content, nil
+		}
+		if content, ok := configMap.BinaryData[source.ConfigMap.Key]; ok {
+			return string(content), nil
+		}
+		return "", errors.Wrapf(errFileContentUnavailable, "configmap %s/%s has no key %q", namespace, source.ConfigMap.Name, source.ConfigMap.Key)
+	default:
+		return "", errors.Wrap(errFileContentUnavailable, "contentFrom must reference a secret or a configmap")
+	}
+}
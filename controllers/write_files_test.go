@@ -0,0 +1,90 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/apis/v1beta1"
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/cloudinit"
+)
+
+func TestGetWriteFiles(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	scope := &Scope{
+		Config: &v1beta1.MicroK8sConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"}},
+	}
+	objects := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tls"},
+			Data:       map[string][]byte{"tls.key": []byte("KEY")},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"},
+			Data:       map[string]string{"config.yaml": "key: value"},
+			BinaryData: map[string][]byte{"config.gz": []byte("H4sI")},
+		},
+	}
+
+	t.Run("ContentFrom", func(t *testing.T) {
+		g := NewWithT(t)
+		r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objects...).Build()}
+
+		files, err := r.getWriteFiles(context.Background(), scope, []v1beta1.CloudInitWriteFile{
+			{Path: "/etc/inline", Content: "inline", Permissions: "0644", Owner: "root:root"},
+			{Path: "/etc/tls.key", ContentFrom: &v1beta1.FileSource{Secret: &v1beta1.FileSourceKey{Name: "tls", Key: "tls.key"}}, Permissions: "0600"},
+			{Path: "/etc/config.yaml", ContentFrom: &v1beta1.FileSource{ConfigMap: &v1beta1.FileSourceKey{Name: "config", Key: "config.yaml"}}},
+			{Path: "/etc/config.gz", ContentFrom: &v1beta1.FileSource{ConfigMap: &v1beta1.FileSourceKey{Name: "config", Key: "config.gz"}}, Encoding: v1beta1.GzipBase64},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(files).To(Equal([]cloudinit.File{
+			{Path: "/etc/inline", Content: "inline", Permissions: "0644", Owner: "root:root"},
+			{Path: "/etc/tls.key", Content: "KEY", Permissions: "0600"},
+			{Path: "/etc/config.yaml", Content: "key: value"},
+			{Path: "/etc/config.gz", Content: "H4sI", Encoding: "gzip+base64"},
+		}))
+	})
+
+	for _, tc := range []struct {
+		name   string
+		source *v1beta1.FileSource
+	}{
+		{name: "SecretNotFound", source: &v1beta1.FileSource{Secret: &v1beta1.FileSourceKey{Name: "other", Key: "tls.key"}}},
+		{name: "SecretKeyNotFound", source: &v1beta1.FileSource{Secret: &v1beta1.FileSourceKey{Name: "tls", Key: "tls.crt"}}},
+		{name: "ConfigMapNotFound", source: &v1beta1.FileSource{ConfigMap: &v1beta1.FileSourceKey{Name: "other", Key: "config.yaml"}}},
+		{name: "ConfigMapKeyNotFound", source: &v1beta1.FileSource{ConfigMap: &v1beta1.FileSourceKey{Name: "config", Key: "other"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &MicroK8sConfigReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objects...).Build()}
+
+			_, err := r.getWriteFiles(context.Background(), scope, []v1beta1.CloudInitWriteFile{{Path: "/etc/file", ContentFrom: tc.source}})
+			g.Expect(errors.Is(err, errFileContentUnavailable)).To(BeTrue())
+			g.Expect(err.Error()).To(ContainSubstring(`file "/etc/file"`))
+		})
+	}
+}
@@ -28,6 +28,7 @@ import (
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers"
+	"github.com/canonical/cluster-api-bootstrap-provider-microk8s/controllers/progress"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/klog/v2/klogr"
 
@@ -36,8 +37,10 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/remote"
+	"sigs.k8s.io/cluster-api/feature"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -74,17 +77,31 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var featureGates string
+	var progressAddr string
+	var progressURL string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&featureGates, "feature-gates", "",
+		"A set of key=value pairs that describe feature gates for alpha/experimental features, e.g. MachinePool=true.")
+	flag.StringVar(&progressAddr, "progress-bind-address", "",
+		"The address the endpoint that machines report their bootstrap progress to binds to. Progress is not reported if empty.")
+	flag.StringVar(&progressURL, "progress-url", "",
+		"The URL that machines reach the progress endpoint at, e.g. http://10.0.0.10:8082. Required with --progress-bind-address.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	if err := feature.MutableGates.Set(featureGates); err != nil {
+		setupLog.Error(err, "unable to set feature gates")
+		os.Exit(1)
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 	restConfig := ctrl.GetConfigOrDie()
 	restConfig.UserAgent = remote.DefaultClusterAPIUserAgent("cluster-api-microk8s-bootstrap-manager")
@@ -104,13 +121,50 @@ func main() {
 		os.Exit(1)
 	}
 
+	trackerLog := ctrl.Log.WithName("remote").WithName("ClusterCacheTracker")
+	tracker, err := remote.NewClusterCacheTracker(mgr, remote.ClusterCacheTrackerOptions{Log: &trackerLog})
+	if err != nil {
+		setupLog.Error(err, "unable to create cluster cache tracker")
+		os.Exit(1)
+	}
+	if err = (&remote.ClusterCacheReconciler{
+		Client:  mgr.GetClient(),
+		Tracker: tracker,
+	}).SetupWithManager(context.TODO(), mgr, controller.Options{}); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterCacheReconciler")
+		os.Exit(1)
+	}
+
+	if (progressAddr == "") != (progressURL == "") {
+		setupLog.Error(nil, "--progress-bind-address and --progress-url must be set together")
+		os.Exit(1)
+	}
+	if progressAddr != "" {
+		if err := mgr.Add(progress.NewServer(ctrl.Log.WithName("progress"), mgr.GetClient(), progressAddr)); err != nil {
+			setupLog.Error(err, "unable to create progress server")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.MicroK8sConfigReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Tracker:     tracker,
+		ProgressURL: progressURL,
 	}).SetupWithManager(context.TODO(), mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MicroK8sConfig")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&bootstrapclusterxk8siov1beta1.MicroK8sConfig{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MicroK8sConfig")
+			os.Exit(1)
+		}
+		if err = (&bootstrapclusterxk8siov1beta1.MicroK8sConfigTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MicroK8sConfigTemplate")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {